@@ -0,0 +1,60 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceSelectorAnnotation holds the match expressions of the namespace selector of a quota created or updated
+// through an API version whose selector cannot be expressed by the labels of LabelSelector.  They apply together
+// with LabelSelector, which holds the match labels of the selector, so that updates of LabelSelector are not lost.
+// An annotation without match expressions keeps a selector without match labels, which selects no namespace.
+const NamespaceSelectorAnnotation = "quota.caih.com/namespace-selector"
+
+// Hub marks v1 as the version the other versions of SharedQuota are converted through.
+func (*SharedQuota) Hub() {}
+
+// NamespaceSelector returns the selector of the namespaces sharing the quota, or nil if it selects no namespace.
+func (q *SharedQuota) NamespaceSelector() (labels.Selector, error) {
+	namespaceSelector, err := q.LabelSelectorWithExpressions()
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaceSelector.MatchLabels) == 0 && len(namespaceSelector.MatchExpressions) == 0 {
+		return nil, nil
+	}
+	return metav1.LabelSelectorAsSelector(namespaceSelector)
+}
+
+// LabelSelectorWithExpressions returns LabelSelector as the match labels of a selector, with the match expressions
+// of the NamespaceSelectorAnnotation.  The match labels of the annotation are ignored, LabelSelector holds them.
+func (q *SharedQuota) LabelSelectorWithExpressions() (*metav1.LabelSelector, error) {
+	namespaceSelector := &metav1.LabelSelector{}
+	if data, found := q.Annotations[NamespaceSelectorAnnotation]; found {
+		if err := json.Unmarshal([]byte(data), namespaceSelector); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", NamespaceSelectorAnnotation, err)
+		}
+	}
+	namespaceSelector.MatchLabels = maps.Clone(q.Spec.LabelSelector)
+	return namespaceSelector, nil
+}
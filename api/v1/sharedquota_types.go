@@ -34,8 +34,52 @@ type SharedQuotaSpec struct {
 
 	// Quota defines the desired quota
 	Quota corev1.ResourceQuotaSpec `json:"quota" protobuf:"bytes,2,opt,name=quota"`
+
+	// FailurePolicy is how admissions matching the quota are handled when they cannot be evaluated,
+	// Open admits them and Closed rejects them.  Defaults to the failure policy of the webhook.
+	// +optional
+	FailurePolicy FailurePolicyType `json:"failurePolicy,omitempty" protobuf:"bytes,3,opt,name=failurePolicy,casttype=FailurePolicyType"`
+
+	// DeletionPolicy is whether the quota can be deleted while it is in use, Block keeps enforcing it until its usage
+	// drops to zero or it is annotated with quota.caih.com/force-delete=true.  Defaults to Allow.
+	// +optional
+	DeletionPolicy DeletionPolicyType `json:"deletionPolicy,omitempty" protobuf:"bytes,4,opt,name=deletionPolicy,casttype=DeletionPolicyType"`
 }
 
+// FailurePolicyType is how admissions are handled when they cannot be evaluated.
+// +kubebuilder:validation:Enum=Open;Closed
+type FailurePolicyType string
+
+const (
+	// FailOpen admits the object and marks it as unverified.
+	FailOpen FailurePolicyType = "Open"
+	// FailClosed rejects the object.
+	FailClosed FailurePolicyType = "Closed"
+)
+
+// DeletionPolicyType is whether a quota can be deleted while it is in use.
+// +kubebuilder:validation:Enum=Block;Allow
+type DeletionPolicyType string
+
+const (
+	// DeletionBlock defers the deletion of the quota until its usage is zero.
+	DeletionBlock DeletionPolicyType = "Block"
+	// DeletionAllow deletes the quota regardless of its usage.
+	DeletionAllow DeletionPolicyType = "Allow"
+)
+
+const (
+	// CleanupFinalizer is added to every quota so that the objects and the state derived from it are removed before
+	// it is deleted.
+	CleanupFinalizer = "quota.caih.com/cleanup"
+	// ForceDeleteAnnotation set to true deletes a quota whose deletion is blocked by its DeletionPolicy.
+	ForceDeleteAnnotation = "quota.caih.com/force-delete"
+)
+
+// UnverifiedAnnotation is set on objects admitted by the Open failure policy without being evaluated, its value is
+// the reason the evaluation was skipped.
+const UnverifiedAnnotation = "quota.caih.com/unverified"
+
 // SharedQuotaStatus defines the observed state of SharedQuota.
 type SharedQuotaStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -43,24 +87,57 @@ type SharedQuotaStatus struct {
 	// Total defines the actual enforced quota and its current usage across all projects
 	Total corev1.ResourceQuotaStatus `json:"total" protobuf:"bytes,1,opt,name=total"`
 
-	// Namespaces slices the usage by project.
-	Namespaces ResourceQuotasStatusByNamespace `json:"namespaces" protobuf:"bytes,2,rep,name=namespaces"`
+	// Namespaces slices the usage by project, sorted by namespace.
+	// Deprecated: the usage of every namespace is recorded in the SharedQuotaUsage of the same name in the namespace,
+	// this field mirrors it.
+	// +optional
+	// +listType=map
+	// +listMapKey=namespace
+	Namespaces ResourceQuotasStatusByNamespace `json:"namespaces,omitempty" protobuf:"bytes,2,rep,name=namespaces"`
+
+	// NamespaceCount is the number of namespaces selected by the quota.
+	// +optional
+	NamespaceCount int32 `json:"namespaceCount,omitempty" protobuf:"varint,4,opt,name=namespaceCount"`
+
+	// Conditions describe the latest observations of the quota.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,3,rep,name=conditions"`
 }
 
+const (
+	// ConditionUsageCalculated is True when the usage of the quota was calculated in every selected namespace.  While
+	// it is False the usage in the status is stale and admissions matching the quota are rejected.
+	ConditionUsageCalculated = "UsageCalculated"
+
+	// ReasonCalculated is the reason of a True UsageCalculated condition.
+	ReasonCalculated = "Calculated"
+	// ReasonScopeMatchFailed is the reason of a False UsageCalculated condition when objects could not be matched
+	// against the scopes of the quota.
+	ReasonScopeMatchFailed = "ScopeMatchFailed"
+	// ReasonInvalidNamespaceSelector is the reason of a False UsageCalculated condition when the namespace selector
+	// of the quota is invalid.  The namespaces selected before keep matching the quota.
+	ReasonInvalidNamespaceSelector = "InvalidNamespaceSelector"
+)
+
 // ResourceQuotasStatusByNamespace bundles multiple ResourceQuotaStatusByNamespace
 type ResourceQuotasStatusByNamespace []ResourceQuotaStatusByNamespace
 
-// ResourceQuotaStatusByNamespace gives status for a particular project
+// ResourceQuotaStatusByNamespace gives the usage of a particular project, the hard limits are those of the total.
 type ResourceQuotaStatusByNamespace struct {
-	corev1.ResourceQuotaStatus `json:",inline"`
-
 	// Namespace the project this status applies to
 	Namespace string `json:"namespace" protobuf:"bytes,1,opt,name=namespace"`
+
+	// Used is the usage of the quota in the namespace.
+	// +optional
+	Used corev1.ResourceList `json:"used,omitempty" protobuf:"bytes,2,rep,name=used,casttype=k8s.io/api/core/v1.ResourceList,castkey=k8s.io/api/core/v1.ResourceName"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster
+// +kubebuilder:storageversion
 
 // SharedQuota is the Schema for the sharedquotas API.
 type SharedQuota struct {
@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SharedQuotaLedgerSpec defines the usage reserved by admission.
+type SharedQuotaLedgerSpec struct {
+	// Reservations is the usage admitted since the SharedQuota status was last recalculated.
+	// +optional
+	// +listType=atomic
+	Reservations []Reservation `json:"reservations,omitempty"`
+}
+
+// Reservation is the usage admitted for an object, or for the objects admitted together in a second when the object
+// is not known.
+type Reservation struct {
+	// Object is the object the usage was admitted for.  The reservation is dropped as soon as a recalculation of the
+	// SharedQuota status counts the object.
+	// +optional
+	Object *ReservedObject `json:"object,omitempty"`
+
+	// Used is the usage of the admitted objects.
+	Used corev1.ResourceList `json:"used"`
+
+	// Timestamp is when the objects were admitted.  The reservation is dropped by the first recalculation of the
+	// SharedQuota status that started long enough after it for the objects to be counted, or to have never appeared.
+	Timestamp metav1.Time `json:"timestamp"`
+}
+
+// ReservedObject identifies the object a reservation was admitted for, and the version the admitted operation
+// applies to.
+type ReservedObject struct {
+	// Group is the API group of the resource.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Resource is the resource of the object.
+	Resource string `json:"resource"`
+
+	// Name is the name of the object.
+	Name string `json:"name"`
+
+	// UID is the UID of the object, empty for a creation since it is assigned after admission.
+	// +optional
+	UID types.UID `json:"uid,omitempty"`
+
+	// ResourceVersion is the version of the object the admitted update or deletion applies to, empty for a creation.
+	// +optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// Deleted is true if the usage was released by the deletion of the object.
+	// +optional
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaLedger records the usage admitted in its namespace against the SharedQuota of the same name that is not
+// yet reflected in its status.  Admission appends to the ledger of the namespace instead of updating the status of
+// the SharedQuota, which is large and also written by the controller, so that admissions in different namespaces do
+// not conflict.
+type SharedQuotaLedger struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SharedQuotaLedgerSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaLedgerList contains a list of SharedQuotaLedger.
+type SharedQuotaLedgerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedQuotaLedger `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SharedQuotaLedger{}, &SharedQuotaLedgerList{})
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SharedQuotaLabel is set on every SharedQuotaUsage, every SharedQuotaLedger, and every ResourceQuota mirroring a
+// SharedQuota, to the name of its SharedQuota.
+const SharedQuotaLabel = "quota.caih.com/sharedquota"
+
+// SharedQuotaUsageStatus defines the usage of a SharedQuota in a namespace.
+type SharedQuotaUsageStatus struct {
+	// Used is the current observed usage of the quota in the namespace.
+	// +optional
+	Used corev1.ResourceList `json:"used,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaUsage records the usage of the SharedQuota of the same name in its namespace.  It is maintained by the
+// controller for every namespace selected by the quota, so that the status of a SharedQuota spanning many namespaces
+// only holds its totals.
+type SharedQuotaUsage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status SharedQuotaUsageStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaUsageList contains a list of SharedQuotaUsage.
+type SharedQuotaUsageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedQuotaUsage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SharedQuotaUsage{}, &SharedQuotaUsageList{})
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SharedQuotaViewName is the name of the SharedQuotaView of every namespace.
+const SharedQuotaViewName = "sharedquotas"
+
+// SharedQuotaViewStatus defines the SharedQuotas applying to a namespace.
+type SharedQuotaViewStatus struct {
+	// Quotas are the SharedQuotas selecting the namespace.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Quotas []AppliedSharedQuota `json:"quotas,omitempty"`
+}
+
+// AppliedSharedQuota is a SharedQuota as seen from a namespace it selects.
+type AppliedSharedQuota struct {
+	// Name of the SharedQuota.
+	Name string `json:"name"`
+
+	// Scopes are the scopes of the quota, only the objects matching them are counted.
+	// +optional
+	Scopes []corev1.ResourceQuotaScope `json:"scopes,omitempty"`
+
+	// ScopeSelector is the scope selector of the quota, only the objects matching it are counted.
+	// +optional
+	ScopeSelector *corev1.ScopeSelector `json:"scopeSelector,omitempty"`
+
+	// Hard is the set of hard limits of the quota across all the namespaces it selects.
+	// +optional
+	Hard corev1.ResourceList `json:"hard,omitempty"`
+
+	// Used is the usage of the quota across all the namespaces it selects.
+	// +optional
+	Used corev1.ResourceList `json:"used,omitempty"`
+
+	// NamespaceUsed is the usage of the quota in the namespace.
+	// +optional
+	NamespaceUsed corev1.ResourceList `json:"namespaceUsed,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaView lists the SharedQuotas applying to its namespace.  It is maintained by the controller in every
+// namespace selected by a SharedQuota, so that the users of a namespace can see its quotas without reading the
+// cluster-scoped SharedQuotas.
+type SharedQuotaView struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status SharedQuotaViewStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaViewList contains a list of SharedQuotaView.
+type SharedQuotaViewList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedQuotaView `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SharedQuotaView{}, &SharedQuotaViewList{})
+}
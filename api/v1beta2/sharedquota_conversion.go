@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"encoding/json"
+	"maps"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// ConvertTo converts this SharedQuota to the Hub version (v1).
+func (src *SharedQuota) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*quotav1.SharedQuota)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(dst.Annotations, quotav1.NamespaceSelectorAnnotation)
+
+	// v1 only selects namespaces by the values of their labels, the match expressions are kept in an annotation
+	dst.Spec.LabelSelector = nil
+	if namespaceSelector := src.Spec.NamespaceSelector; namespaceSelector != nil {
+		dst.Spec.LabelSelector = maps.Clone(namespaceSelector.MatchLabels)
+		if len(namespaceSelector.MatchLabels) == 0 || len(namespaceSelector.MatchExpressions) > 0 {
+			data, err := json.Marshal(&metav1.LabelSelector{MatchExpressions: namespaceSelector.MatchExpressions})
+			if err != nil {
+				return err
+			}
+			if dst.Annotations == nil {
+				dst.Annotations = map[string]string{}
+			}
+			dst.Annotations[quotav1.NamespaceSelectorAnnotation] = string(data)
+		}
+	}
+	dst.Spec.Quota = *src.Spec.Quota.DeepCopy()
+	dst.Spec.FailurePolicy = quotav1.FailurePolicyType(src.Spec.FailurePolicy)
+	dst.Spec.DeletionPolicy = quotav1.DeletionPolicyType(src.Spec.DeletionPolicy)
+
+	dst.Status.Total = *src.Status.Total.DeepCopy()
+	dst.Status.Namespaces = nil
+	if src.Status.Namespaces != nil {
+		dst.Status.Namespaces = make(quotav1.ResourceQuotasStatusByNamespace, 0, len(src.Status.Namespaces))
+		for _, namespaceUsage := range src.Status.Namespaces {
+			dst.Status.Namespaces = append(dst.Status.Namespaces, quotav1.ResourceQuotaStatusByNamespace{
+				Namespace: namespaceUsage.Namespace,
+				Used:      namespaceUsage.Used.DeepCopy(),
+			})
+		}
+	}
+	dst.Status.NamespaceCount = src.Status.NamespaceCount
+	dst.Status.Conditions = copyConditions(src.Status.Conditions)
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version.
+func (dst *SharedQuota) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*quotav1.SharedQuota)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(dst.Annotations, quotav1.NamespaceSelectorAnnotation)
+
+	// the match labels updated through v1 apply together with the match expressions kept in the annotation
+	dst.Spec.NamespaceSelector = nil
+	if _, found := src.Annotations[quotav1.NamespaceSelectorAnnotation]; found {
+		namespaceSelector, err := src.LabelSelectorWithExpressions()
+		if err != nil {
+			return err
+		}
+		dst.Spec.NamespaceSelector = namespaceSelector
+	} else if len(src.Spec.LabelSelector) > 0 {
+		dst.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: maps.Clone(src.Spec.LabelSelector)}
+	}
+	dst.Spec.Quota = *src.Spec.Quota.DeepCopy()
+	dst.Spec.FailurePolicy = FailurePolicyType(src.Spec.FailurePolicy)
+	dst.Spec.DeletionPolicy = DeletionPolicyType(src.Spec.DeletionPolicy)
+
+	dst.Status.Total = *src.Status.Total.DeepCopy()
+	dst.Status.Namespaces = nil
+	if src.Status.Namespaces != nil {
+		dst.Status.Namespaces = make([]NamespaceUsage, 0, len(src.Status.Namespaces))
+		for _, namespaceStatus := range src.Status.Namespaces {
+			dst.Status.Namespaces = append(dst.Status.Namespaces, NamespaceUsage{
+				Namespace: namespaceStatus.Namespace,
+				Used:      namespaceStatus.Used.DeepCopy(),
+			})
+		}
+	}
+	dst.Status.NamespaceCount = src.Status.NamespaceCount
+	dst.Status.Conditions = copyConditions(src.Status.Conditions)
+	return nil
+}
+
+func copyConditions(conditions []metav1.Condition) []metav1.Condition {
+	if conditions == nil {
+		return nil
+	}
+	out := make([]metav1.Condition, len(conditions))
+	for i := range conditions {
+		conditions[i].DeepCopyInto(&out[i])
+	}
+	return out
+}
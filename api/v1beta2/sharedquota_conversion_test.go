@@ -0,0 +1,242 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"math/rand"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// fuzzerFuncs keep the fuzzed objects to the values the API server accepts.
+var fuzzerFuncs = []interface{}{
+	func(q *resource.Quantity, c fuzz.Continue) {
+		*q = *resource.NewMilliQuantity(c.Int63n(1_000_000), resource.DecimalSI)
+	},
+}
+
+func newFuzzer(fuzzer *fuzz.Fuzzer) *fuzz.Fuzzer {
+	return fuzzer.NilChance(0.2).NumElements(0, 3).Funcs(fuzzerFuncs...)
+}
+
+// roundTrip converts a fuzzed object of each version to the other one and back, and reports any difference.
+func roundTrip(t *testing.T, fuzzer *fuzz.Fuzzer) {
+	t.Helper()
+
+	// the type meta is set by the conversion webhook
+	original := &SharedQuota{}
+	fuzzer.Fuzz(original)
+	original.TypeMeta = metav1.TypeMeta{}
+	hub := &quotav1.SharedQuota{}
+	if err := original.ConvertTo(hub); err != nil {
+		t.Fatalf("failed to convert to v1: %v", err)
+	}
+	roundTripped := &SharedQuota{}
+	if err := roundTripped.ConvertFrom(hub); err != nil {
+		t.Fatalf("failed to convert from v1: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(original, roundTripped) {
+		t.Fatalf("v1beta2 changed in a round trip through v1:\n%s", diff.ObjectReflectDiff(original, roundTripped))
+	}
+
+	originalHub := &quotav1.SharedQuota{}
+	fuzzer.Fuzz(originalHub)
+	originalHub.TypeMeta = metav1.TypeMeta{}
+	spoke := &SharedQuota{}
+	if err := spoke.ConvertFrom(originalHub); err != nil {
+		t.Fatalf("failed to convert from v1: %v", err)
+	}
+	roundTrippedHub := &quotav1.SharedQuota{}
+	if err := spoke.ConvertTo(roundTrippedHub); err != nil {
+		t.Fatalf("failed to convert to v1: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(originalHub, roundTrippedHub) {
+		t.Fatalf("v1 changed in a round trip through v1beta2:\n%s", diff.ObjectReflectDiff(originalHub, roundTrippedHub))
+	}
+}
+
+func TestSharedQuotaRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 1000; seed++ {
+		roundTrip(t, newFuzzer(fuzz.New().RandSource(rand.NewSource(seed))))
+	}
+}
+
+func FuzzSharedQuotaRoundTrip(f *testing.F) {
+	f.Add([]byte("sharedquota"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		roundTrip(t, newFuzzer(fuzz.NewFromGoFuzz(data)))
+	})
+}
+
+func TestSharedQuotaConvertibility(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := quotav1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []runtime.Object{&quotav1.SharedQuota{}, &SharedQuota{}} {
+		if convertible, err := conversion.IsConvertible(scheme, obj); err != nil || !convertible {
+			t.Errorf("expected %T to be convertible, got %v", obj, err)
+		}
+	}
+}
+
+func TestSharedQuotaConvertToKeepsSetBasedSelectors(t *testing.T) {
+	sharedQuota := &SharedQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota"},
+		Spec: SharedQuotaSpec{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"tenant": "a"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      "team",
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   []string{"b"},
+				}},
+			},
+		},
+	}
+	hub := &quotav1.SharedQuota{}
+	if err := sharedQuota.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	selector, err := hub.NamespaceSelector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for namespaceLabels, expected := range map[string]bool{
+		"tenant=a":        true,
+		"tenant=a,team=c": true,
+		"tenant=a,team=b": false,
+		"team=c":          false,
+	} {
+		set, err := labels.ConvertSelectorToLabelsMap(namespaceLabels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selector.Matches(set) != expected {
+			t.Errorf("expected the selector %s to match %s: %v", selector, namespaceLabels, expected)
+		}
+	}
+}
+
+// TestSharedQuotaV1SelectorUpdate checks that the labels of the selector updated through v1 apply together with the
+// match expressions set through v1beta2.
+func TestSharedQuotaV1SelectorUpdate(t *testing.T) {
+	notTeamB := metav1.LabelSelectorRequirement{Key: "team", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"b"}}
+	testCases := map[string]struct {
+		selector       *metav1.LabelSelector
+		v1Selector     map[string]string
+		expectSelector *metav1.LabelSelector
+		expectMatches  map[string]bool
+	}{
+		"labels updated": {
+			selector: &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"tenant": "a"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{notTeamB},
+			},
+			v1Selector: map[string]string{"tenant": "c"},
+			expectSelector: &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"tenant": "c"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{notTeamB},
+			},
+			expectMatches: map[string]bool{
+				"tenant=a":        false,
+				"tenant=c":        true,
+				"tenant=c,team=b": false,
+			},
+		},
+		"labels added to expressions": {
+			selector:   &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{notTeamB}},
+			v1Selector: map[string]string{"tenant": "a"},
+			expectSelector: &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"tenant": "a"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{notTeamB},
+			},
+			expectMatches: map[string]bool{
+				"team=c":          false,
+				"tenant=a":        true,
+				"tenant=a,team=b": false,
+			},
+		},
+		"labels removed": {
+			selector: &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"tenant": "a"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{notTeamB},
+			},
+			expectSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{notTeamB}},
+			expectMatches: map[string]bool{
+				"tenant=c": true,
+				"team=b":   false,
+			},
+		},
+		"labels set on a selector selecting no namespace": {
+			selector:       &metav1.LabelSelector{},
+			v1Selector:     map[string]string{"tenant": "a"},
+			expectSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+			expectMatches: map[string]bool{
+				"tenant=a": true,
+				"tenant=c": false,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sharedQuota := &SharedQuota{
+				ObjectMeta: metav1.ObjectMeta{Name: "quota"},
+				Spec:       SharedQuotaSpec{NamespaceSelector: tc.selector},
+			}
+			hub := &quotav1.SharedQuota{}
+			if err := sharedQuota.ConvertTo(hub); err != nil {
+				t.Fatal(err)
+			}
+			hub.Spec.LabelSelector = tc.v1Selector
+
+			selector, err := hub.NamespaceSelector()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for namespaceLabels, expected := range tc.expectMatches {
+				set, err := labels.ConvertSelectorToLabelsMap(namespaceLabels)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if selector.Matches(set) != expected {
+					t.Errorf("expected the selector %s to match %s: %v", selector, namespaceLabels, expected)
+				}
+			}
+			updated := &SharedQuota{}
+			if err := updated.ConvertFrom(hub); err != nil {
+				t.Fatal(err)
+			}
+			if !equality.Semantic.DeepEqual(updated.Spec.NamespaceSelector, tc.expectSelector) {
+				t.Errorf("expected selector %v, got %v", tc.expectSelector, updated.Spec.NamespaceSelector)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SharedQuotaSpec defines the desired state of SharedQuota.
+type SharedQuotaSpec struct {
+	// NamespaceSelector selects the namespaces sharing the quota.  A quota without selector, or with an empty one,
+	// selects no namespace.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Quota defines the desired quota
+	Quota corev1.ResourceQuotaSpec `json:"quota"`
+
+	// FailurePolicy is how admissions matching the quota are handled when they cannot be evaluated,
+	// Open admits them and Closed rejects them.  Defaults to the failure policy of the webhook.
+	// +optional
+	FailurePolicy FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// DeletionPolicy is whether the quota can be deleted while it is in use, Block keeps enforcing it until its usage
+	// drops to zero or it is annotated with quota.caih.com/force-delete=true.  Defaults to Allow.
+	// +optional
+	DeletionPolicy DeletionPolicyType `json:"deletionPolicy,omitempty"`
+}
+
+// FailurePolicyType is how admissions are handled when they cannot be evaluated.
+// +kubebuilder:validation:Enum=Open;Closed
+type FailurePolicyType string
+
+const (
+	// FailOpen admits the object and marks it as unverified.
+	FailOpen FailurePolicyType = "Open"
+	// FailClosed rejects the object.
+	FailClosed FailurePolicyType = "Closed"
+)
+
+// DeletionPolicyType is whether a quota can be deleted while it is in use.
+// +kubebuilder:validation:Enum=Block;Allow
+type DeletionPolicyType string
+
+const (
+	// DeletionBlock defers the deletion of the quota until its usage is zero.
+	DeletionBlock DeletionPolicyType = "Block"
+	// DeletionAllow deletes the quota regardless of its usage.
+	DeletionAllow DeletionPolicyType = "Allow"
+)
+
+// SharedQuotaStatus defines the observed state of SharedQuota.
+type SharedQuotaStatus struct {
+	// Total defines the enforced quota and its current usage across all selected namespaces.
+	// +optional
+	Total corev1.ResourceQuotaStatus `json:"total,omitempty"`
+
+	// Namespaces slices the usage by namespace, sorted by namespace.  The hard limits are those of the total.
+	// +optional
+	// +listType=map
+	// +listMapKey=namespace
+	Namespaces []NamespaceUsage `json:"namespaces,omitempty"`
+
+	// NamespaceCount is the number of namespaces selected by the quota.
+	// +optional
+	NamespaceCount int32 `json:"namespaceCount,omitempty"`
+
+	// Conditions describe the latest observations of the quota.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// NamespaceUsage is the usage of the quota in a namespace.
+type NamespaceUsage struct {
+	// Namespace is the namespace the usage applies to.
+	Namespace string `json:"namespace"`
+
+	// Used is the current observed usage of the quota in the namespace.
+	// +optional
+	Used corev1.ResourceList `json:"used,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// SharedQuota is the Schema for the sharedquotas API.
+type SharedQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SharedQuotaSpec   `json:"spec,omitempty"`
+	Status SharedQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedQuotaList contains a list of SharedQuota.
+type SharedQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SharedQuota{}, &SharedQuotaList{})
+}
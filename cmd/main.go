@@ -17,10 +17,17 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,6 +35,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
@@ -38,8 +46,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	quotav1 "caih.com/api/v1"
+	quotav1beta2 "caih.com/api/v1beta2"
 	"caih.com/internal/controller"
 	webhookcorev1 "caih.com/internal/webhook/v1"
+	"caih.com/pkg/config"
+	configv1alpha1 "caih.com/pkg/config/v1alpha1"
+	"caih.com/pkg/quota"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -52,6 +64,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(quotav1.AddToScheme(scheme))
+	utilruntime.Must(quotav1beta2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -64,6 +77,12 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var featureGates string
+	var workloadAdmission string
+	var quotaLock string
+	var forwardToOwner bool
+	var webhookServiceName string
+	var configFile string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -82,6 +101,22 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&workloadAdmission, "workload-admission", string(webhookcorev1.WorkloadAdmissionDisabled),
+		"How Deployments, StatefulSets, ReplicaSets, Jobs and CronJobs whose projected usage exceeds the remaining "+
+			"SharedQuota are handled. One of Disabled, Warn or Deny.")
+	flag.StringVar(&quotaLock, "quota-lock", string(webhookcorev1.QuotaLockInProcess),
+		"How webhook replicas serialize the evaluation of a SharedQuota. InProcess only serializes within a replica, "+
+			"Lease uses a coordination.k8s.io Lease per quota in POD_NAMESPACE and is required to run several replicas.")
+	flag.BoolVar(&forwardToOwner, "forward-to-owner", false,
+		"If set, admission requests are forwarded to the replica owning the quotas of the namespace. Requires --quota-lock=Lease.")
+	flag.StringVar(&webhookServiceName, "webhook-service-name", "sharedquota-webhook.kube-system.svc",
+		"The name in the webhook certificate, used to verify replicas when forwarding to quota owners.")
+	flag.StringVar(&configFile, "config", "",
+		"The path of a SharedQuotaConfiguration (config.quota.caih.com/v1alpha1) file. Changes to the timeouts and "+
+			"the resync period are applied without restart.")
+	flag.StringVar(&featureGates, "feature-gates", "",
+		"A set of key=value pairs that describe feature gates for alpha/experimental features. Options are:\n"+
+			strings.Join(utilfeature.DefaultFeatureGate.KnownFeatures(), "\n"))
 	opts := zap.Options{
 		Development: true,
 	}
@@ -90,6 +125,23 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if err := utilfeature.DefaultMutableFeatureGate.Set(featureGates); err != nil {
+		setupLog.Error(err, "unable to parse feature gates")
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load configuration", "config", configFile)
+		os.Exit(1)
+	}
+
+	resourceQuotaCfg, err := config.LoadResourceQuotaConfiguration(cfg.Webhook.ResourceQuotaConfigurationFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load resource quota configuration", "config", cfg.Webhook.ResourceQuotaConfigurationFile)
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -130,6 +182,40 @@ func main() {
 		})
 	}
 
+	// replicas verify each other with the CA of the webhook certificate, and present the webhook certificate to the
+	// replicas they forward requests to
+	var forwardTLSConfig *tls.Config
+	if forwardToOwner {
+		certDir := webhookCertPath
+		if len(certDir) == 0 {
+			certDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+		}
+		caCert, err := os.ReadFile(filepath.Join(certDir, "ca.crt"))
+		if err != nil {
+			setupLog.Error(err, "unable to read webhook CA certificate")
+			os.Exit(1)
+		}
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(caCert)
+		forwardTLSConfig = &tls.Config{RootCAs: rootCAs, ServerName: webhookServiceName}
+		if webhookCertWatcher != nil {
+			forwardTLSConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return webhookCertWatcher.GetCertificate(nil)
+			}
+		} else {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(certDir, webhookCertName), filepath.Join(certDir, webhookCertKey))
+			if err != nil {
+				setupLog.Error(err, "unable to read webhook certificate")
+				os.Exit(1)
+			}
+			forwardTLSConfig.Certificates = []tls.Certificate{cert}
+		}
+		// forwarded requests are authenticated by their handler, the apiserver does not present a certificate
+		webhookTLSOpts = append(webhookTLSOpts, func(config *tls.Config) {
+			config.ClientAuth = tls.RequestClientCert
+		})
+	}
+
 	webhookServer := webhook.NewServer(webhook.Options{
 		TLSOpts: webhookTLSOpts,
 	})
@@ -203,22 +289,85 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.SharedQuotaReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	// the controller and the webhook map namespaces to quotas from the same index
+	mappingCache, err := quota.NewQuotaMappingCache(context.Background(), mgr.GetCache())
+	if err != nil {
+		setupLog.Error(err, "unable to create quota mapping cache")
+		os.Exit(1)
+	}
+
+	reconciler := &controller.SharedQuotaReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		MappingCache:            mappingCache,
+		MaxConcurrentReconciles: int(*cfg.Controller.MaxConcurrentReconciles),
+		ResyncPeriod:            cfg.Controller.ResyncPeriod.Duration,
+		ResourceQuotaViews:      *cfg.Controller.ResourceQuotaViews,
+	}
+	ctx := ctrl.SetupSignalHandler()
+	if err = reconciler.SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SharedQuota")
 		os.Exit(1)
 	}
+	if err = (&controller.SharedQuotaViewReconciler{
+		Client:                  mgr.GetClient(),
+		MappingCache:            mappingCache,
+		MaxConcurrentReconciles: int(*cfg.Controller.MaxConcurrentReconciles),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SharedQuotaView")
+		os.Exit(1)
+	}
+	var sharedQuotaAdmission *webhookcorev1.SharedQuotaAdmission
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = webhookcorev1.SetupWithManager(mgr); err != nil {
+		if sharedQuotaAdmission, err = webhookcorev1.SetupWithManager(mgr, webhookcorev1.Options{
+			WorkloadAdmission:          webhookcorev1.WorkloadAdmissionMode(workloadAdmission),
+			QuotaLock:                  webhookcorev1.QuotaLockMode(quotaLock),
+			ForwardToOwner:             forwardToOwner,
+			LeaseNamespace:             os.Getenv("POD_NAMESPACE"),
+			Identity:                   webhookIdentity(),
+			ForwardTLSConfig:           forwardTLSConfig,
+			MappingCache:               mappingCache,
+			EvaluatorWorkers:           int(*cfg.Webhook.EvaluatorWorkers),
+			EvaluationTimeout:          cfg.Webhook.EvaluationTimeout.Duration,
+			QuotaLookupTimeout:         cfg.Webhook.QuotaLookupTimeout.Duration,
+			QuotaCacheSize:             int(*cfg.Webhook.QuotaCacheSize),
+			ResourceQuotaConfiguration: resourceQuotaCfg,
+			FailurePolicy:              cfg.Webhook.FailurePolicy,
+			CircuitBreakerThreshold:    int(*cfg.Webhook.CircuitBreaker.FailureThreshold),
+			CircuitBreakerOpenDuration: cfg.Webhook.CircuitBreaker.OpenDuration.Duration,
+		}); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
 			os.Exit(1)
 		}
+		if err = webhookcorev1.SetupConversionWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SharedQuota")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
+	if len(configFile) > 0 {
+		configWatcher, err := config.NewWatcher(configFile, cfg)
+		if err != nil {
+			setupLog.Error(err, "unable to watch configuration", "config", configFile)
+			os.Exit(1)
+		}
+		configWatcher.AddListener(func(cfg *configv1alpha1.SharedQuotaConfiguration) {
+			reconciler.SetResyncPeriod(cfg.Controller.ResyncPeriod.Duration)
+			if sharedQuotaAdmission != nil {
+				sharedQuotaAdmission.SetTimeouts(cfg.Webhook.EvaluationTimeout.Duration, cfg.Webhook.QuotaLookupTimeout.Duration)
+				sharedQuotaAdmission.SetFailurePolicy(cfg.Webhook.FailurePolicy)
+				sharedQuotaAdmission.SetCircuitBreaker(int(*cfg.Webhook.CircuitBreaker.FailureThreshold),
+					cfg.Webhook.CircuitBreaker.OpenDuration.Duration)
+			}
+		})
+		if err := mgr.Add(configWatcher); err != nil {
+			setupLog.Error(err, "unable to add configuration watcher to manager")
+			os.Exit(1)
+		}
+	}
+
 	if metricsCertWatcher != nil {
 		setupLog.Info("Adding metrics certificate watcher to manager")
 		if err := mgr.Add(metricsCertWatcher); err != nil {
@@ -239,14 +388,34 @@ func main() {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	// the apiserver must not route admissions to a replica whose caches are cold, they would wait for the
+	// namespace and its quotas to be observed
+	if err := mgr.AddReadyzCheck("readyz", func(req *http.Request) error {
+		if !mappingCache.HasSynced() {
+			return fmt.Errorf("shared quota mapping cache is not synced")
+		}
+		if sharedQuotaAdmission != nil {
+			return mgr.GetWebhookServer().StartedChecker()(req)
+		}
+		return nil
+	}); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// webhookIdentity returns the address other replicas reach this replica's webhook server on, empty if POD_IP is
+// not set.
+func webhookIdentity() string {
+	podIP := os.Getenv("POD_IP")
+	if len(podIP) == 0 {
+		return ""
+	}
+	return net.JoinHostPort(podIP, strconv.Itoa(webhook.DefaultPort))
+}
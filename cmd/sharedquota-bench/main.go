@@ -0,0 +1,273 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command sharedquota-bench measures the admission throughput of the shared quota webhook.  It drives
+// SharedQuotaAdmission.Handle in-process with synthetic pod admissions across namespaces sharing quotas, backed by
+// an in-memory quota accessor, and reports latencies, denials, conflicts and status writes.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	quotav1 "caih.com/api/v1"
+	webhookv1 "caih.com/internal/webhook/v1"
+	fakeaccessor "caih.com/internal/webhook/v1/fake"
+)
+
+type options struct {
+	namespaces   int
+	quotas       int
+	requests     int
+	concurrency  int
+	workers      int
+	podsPerQuota int
+	deleteRatio  float64
+	conflictRate float64
+	latency      time.Duration
+	seed         int64
+}
+
+// outcome is the result of an admission.
+type outcome int
+
+const (
+	admitted outcome = iota
+	denied
+	errored
+)
+
+func main() {
+	opts := options{}
+	flag.IntVar(&opts.namespaces, "namespaces", 1000, "The number of namespaces.")
+	flag.IntVar(&opts.quotas, "quotas", 100, "The number of shared quotas, namespace i is selected by quota i modulo quotas.")
+	flag.IntVar(&opts.requests, "requests", 100000, "The number of admission requests.")
+	flag.IntVar(&opts.concurrency, "concurrency", 200, "The number of admission requests in flight.")
+	flag.IntVar(&opts.workers, "evaluator-workers", 10, "The number of namespaces evaluated in parallel.")
+	flag.IntVar(&opts.podsPerQuota, "pods-per-quota", 1000, "The number of pods each quota admits.")
+	flag.Float64Var(&opts.deleteRatio, "delete-ratio", 0.3, "The fraction of requests deleting an admitted pod.")
+	flag.Float64Var(&opts.conflictRate, "conflict-rate", 0, "The fraction of quota status writes failing with an injected conflict.")
+	flag.DurationVar(&opts.latency, "latency", 0, "The latency of every quota lookup and status write.")
+	flag.Int64Var(&opts.seed, "seed", 1, "The seed of the synthetic traffic.")
+	flag.Parse()
+
+	// every denial and conflict is logged by the evaluator
+	klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(klogFlags)
+	_ = klogFlags.Set("logtostderr", "false")
+	_ = klogFlags.Set("stderrthreshold", "FATAL")
+	klog.SetOutput(io.Discard)
+
+	if err := run(opts, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options, out io.Writer) error {
+	if opts.namespaces <= 0 || opts.quotas <= 0 || opts.requests <= 0 || opts.concurrency <= 0 {
+		return fmt.Errorf("namespaces, quotas, requests and concurrency must be positive")
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(quotav1.AddToScheme(scheme))
+
+	accessor := fakeaccessor.NewQuotaAccessor()
+	quotaNamespaces := make([][]string, opts.quotas)
+	namespaces := make([]string, opts.namespaces)
+	for i := range namespaces {
+		namespaces[i] = fmt.Sprintf("namespace-%d", i)
+		quotaNamespaces[i%opts.quotas] = append(quotaNamespaces[i%opts.quotas], namespaces[i])
+	}
+	for i, selected := range quotaNamespaces {
+		accessor.AddQuota(fmt.Sprintf("quota-%d", i), corev1.ResourceList{
+			corev1.ResourcePods:        *resource.NewQuantity(int64(opts.podsPerQuota), resource.DecimalSI),
+			corev1.ResourceRequestsCPU: *resource.NewMilliQuantity(int64(opts.podsPerQuota)*500, resource.DecimalSI),
+		}, selected...)
+	}
+	if opts.conflictRate > 0 {
+		var lock sync.Mutex
+		conflictRand := rand.New(rand.NewSource(opts.seed + 1))
+		accessor.Conflict = func(string, string) bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return conflictRand.Float64() < opts.conflictRate
+		}
+	}
+	if opts.latency > 0 {
+		accessor.Latency = func() time.Duration { return opts.latency }
+	}
+
+	sharedQuotaAdmission, err := webhookv1.NewSharedQuotaAdmission(fake.NewClientBuilder().WithScheme(scheme).Build(),
+		scheme, accessor, webhookv1.Options{EvaluatorWorkers: opts.workers})
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(opts.seed))
+	requests := make(chan admission.Request)
+	go func() {
+		defer close(requests)
+		for i := 0; i < opts.requests; i++ {
+			namespace := namespaces[rng.Intn(len(namespaces))]
+			operation := admissionv1.Create
+			if rng.Float64() < opts.deleteRatio {
+				operation = admissionv1.Delete
+			}
+			requests <- newRequest(i, namespace, int64(100*(1+rng.Intn(10))), operation)
+		}
+	}()
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		latencies = make([]time.Duration, 0, opts.requests)
+		outcomes  = map[admissionv1.Operation][]int{admissionv1.Create: make([]int, 3), admissionv1.Delete: make([]int, 3)}
+		// admittedPods holds the admitted pods of every namespace, requests deleting a pod delete one of them
+		admittedPods = map[string][]admission.Request{}
+	)
+	start := time.Now()
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range requests {
+				if req.Operation == admissionv1.Delete {
+					lock.Lock()
+					pods := admittedPods[req.Namespace]
+					if len(pods) == 0 {
+						lock.Unlock()
+						continue
+					}
+					pod := pods[len(pods)-1]
+					req.Name, req.OldObject, req.Object = pod.Name, pod.Object, runtime.RawExtension{}
+					admittedPods[req.Namespace] = pods[:len(pods)-1]
+					lock.Unlock()
+				}
+				requestStart := time.Now()
+				resp := sharedQuotaAdmission.Handle(context.Background(), req)
+				latency := time.Since(requestStart)
+
+				lock.Lock()
+				latencies = append(latencies, latency)
+				result := classify(resp)
+				outcomes[req.Operation][result]++
+				if req.Operation == admissionv1.Create && result == admitted {
+					admittedPods[req.Namespace] = append(admittedPods[req.Namespace], req)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats := accessor.Stats()
+	fmt.Fprintf(out, "namespaces:          %d\n", opts.namespaces)
+	fmt.Fprintf(out, "quotas:              %d\n", opts.quotas)
+	fmt.Fprintf(out, "requests:            %d in %v (%.0f/s)\n", len(latencies), elapsed.Round(time.Millisecond),
+		float64(len(latencies))/elapsed.Seconds())
+	fmt.Fprintf(out, "latency:             p50 %v, p90 %v, p99 %v, max %v\n", percentile(latencies, 0.50),
+		percentile(latencies, 0.90), percentile(latencies, 0.99), percentile(latencies, 1))
+	fmt.Fprintf(out, "creates:             %d admitted, %d denied, %d errored\n", outcomes[admissionv1.Create][admitted],
+		outcomes[admissionv1.Create][denied], outcomes[admissionv1.Create][errored])
+	fmt.Fprintf(out, "deletes:             %d admitted, %d errored\n", outcomes[admissionv1.Delete][admitted],
+		outcomes[admissionv1.Delete][errored])
+	fmt.Fprintf(out, "quota lookups:       %d\n", stats.Gets)
+	fmt.Fprintf(out, "conflict retries:    %d\n", stats.Conflicts)
+	fmt.Fprintf(out, "status writes:       %d (%.0f/s)\n", stats.Updates, float64(stats.Updates)/elapsed.Seconds())
+	return nil
+}
+
+// classify returns the outcome of an admission response.
+func classify(resp webhook.AdmissionResponse) outcome {
+	switch {
+	case resp.Allowed:
+		return admitted
+	case resp.Result != nil && resp.Result.Code == http.StatusForbidden:
+		return denied
+	}
+	return errored
+}
+
+// percentile returns the latency below which the fraction p of the sorted latencies fall.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(p*float64(len(sorted))+0.5) - 1
+	index = max(0, min(index, len(sorted)-1))
+	return sorted[index]
+}
+
+// newRequest returns the admission request of a pod requesting the given cpu.  Deletions get the pod to delete
+// once it is chosen among the admitted pods.
+func newRequest(i int, namespace string, milliCPU int64, operation admissionv1.Operation) admission.Request {
+	name := "pod-" + strconv.Itoa(i)
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "app",
+				Image: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: *resource.NewMilliQuantity(milliCPU, resource.DecimalSI)},
+				},
+			}},
+		},
+	}
+	raw, _ := json.Marshal(pod)
+	podKind := metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podResource := metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
+	dryRun := false
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		UID:             types.UID(name),
+		Kind:            podKind,
+		Resource:        podResource,
+		RequestKind:     &podKind,
+		RequestResource: &podResource,
+		Namespace:       namespace,
+		Name:            name,
+		Operation:       operation,
+		Object:          runtime.RawExtension{Raw: raw},
+		DryRun:          &dryRun,
+	}}
+}
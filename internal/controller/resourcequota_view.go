@@ -0,0 +1,221 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quotav1 "caih.com/api/v1"
+	"caih.com/pkg/apis/core/v1/helper"
+	quotapkg "caih.com/pkg/quota"
+)
+
+// syncResourceQuotaViews mirrors the quota into a ResourceQuota in every namespace of namespaceUsed, and deletes the
+// views of the other namespaces, or all of them when views are disabled or the quota cannot be mirrored.  A view is a
+// real ResourceQuota that the ResourceQuota admission of the API server enforces too, so its hard limits are those of
+// the quota: the usage of a namespace never exceeds the usage of the quota, and the view never denies an object first.
+// The headroom left in the quota, from its status, is shown by the annotations of the views.
+func (r *SharedQuotaReconciler) syncResourceQuotaViews(ctx context.Context, quota *quotav1.SharedQuota,
+	namespaceUsed map[string]corev1.ResourceList) error {
+	views, err := r.listResourceQuotaViews(ctx, quota.Name)
+	if err != nil {
+		return err
+	}
+	if spec, ok := resourceQuotaViewSpec(quota.Spec.Quota); r.ResourceQuotaViews && ok {
+		resourceNames := quotapkg.ResourceNames(spec.Hard)
+		annotations, err := resourceQuotaViewAnnotations(spec.Hard, quotapkg.Mask(quota.Status.Total.Used, resourceNames))
+		if err != nil {
+			return err
+		}
+		for namespace, used := range namespaceUsed {
+			view := views[namespace]
+			delete(views, namespace)
+			if err := r.writeResourceQuotaView(ctx, quota, namespace, view, spec, annotations, quotapkg.Mask(used, resourceNames)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, view := range views {
+		klog.V(6).Infof("delete resource quota view: %s/%s", view.Namespace, view.Name)
+		if err := r.Delete(ctx, view); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceQuotaViewSpec returns the spec of the views of a quota of the given spec, and false if the quota cannot be
+// mirrored.  The API server rejects a ResourceQuota with custom scopes, or limiting unprefixed resources that are
+// not standard or resources that its scopes do not apply to: the hard limits are filtered to the resources the
+// views can limit, and a quota with custom scopes, invalid scope selectors or no such resource is not mirrored.
+func resourceQuotaViewSpec(spec corev1.ResourceQuotaSpec) (corev1.ResourceQuotaSpec, bool) {
+	scopes := sets.New(spec.Scopes...)
+	if spec.ScopeSelector != nil {
+		for _, req := range spec.ScopeSelector.MatchExpressions {
+			if !isValidScopeSelectorRequirement(req) {
+				return corev1.ResourceQuotaSpec{}, false
+			}
+			scopes.Insert(req.ScopeName)
+		}
+	}
+	for scope := range scopes {
+		if !helper.IsStandardResourceQuotaScope(scope) {
+			return corev1.ResourceQuotaSpec{}, false
+		}
+	}
+	if scopes.HasAll(corev1.ResourceQuotaScopeBestEffort, corev1.ResourceQuotaScopeNotBestEffort) ||
+		scopes.HasAll(corev1.ResourceQuotaScopeTerminating, corev1.ResourceQuotaScopeNotTerminating) {
+		return corev1.ResourceQuotaSpec{}, false
+	}
+	hard := corev1.ResourceList{}
+	for name, quantity := range spec.Hard {
+		if isValidResourceQuotaViewResource(name, scopes) {
+			hard[name] = quantity
+		}
+	}
+	if len(hard) == 0 {
+		return corev1.ResourceQuotaSpec{}, false
+	}
+	return corev1.ResourceQuotaSpec{Hard: hard, Scopes: spec.Scopes, ScopeSelector: spec.ScopeSelector}, true
+}
+
+// resourceQuotaViewAnnotations returns the annotations of the views of a quota with the given hard limits and total
+// usage: the usage and the headroom of the quota, which the status of a view cannot show.
+func resourceQuotaViewAnnotations(hard, totalUsed corev1.ResourceList) (map[string]string, error) {
+	used, err := json.Marshal(totalUsed)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := json.Marshal(quotapkg.SubtractWithNonNegativeResult(hard, totalUsed))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		quotapkg.ResourceQuotaViewUsedAnnotation:      string(used),
+		quotapkg.ResourceQuotaViewRemainingAnnotation: string(remaining),
+	}, nil
+}
+
+// isValidResourceQuotaViewResource returns true if a ResourceQuota with the given scopes can limit the resource.
+func isValidResourceQuotaViewResource(name corev1.ResourceName, scopes sets.Set[corev1.ResourceQuotaScope]) bool {
+	if !helper.IsValidQuotaResourceName(name) {
+		return false
+	}
+	if !helper.IsStandardQuotaResourceName(name) {
+		return true
+	}
+	for scope := range scopes {
+		if !helper.IsResourceQuotaScopeValidForResource(scope, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidScopeSelectorRequirement returns true if the API server accepts the requirement in the scope selector of a
+// ResourceQuota: only the PriorityClass scope takes values, with the In and NotIn operators.
+func isValidScopeSelectorRequirement(req corev1.ScopedResourceSelectorRequirement) bool {
+	switch req.Operator {
+	case corev1.ScopeSelectorOpIn, corev1.ScopeSelectorOpNotIn:
+		return req.ScopeName == corev1.ResourceQuotaScopePriorityClass && len(req.Values) != 0
+	case corev1.ScopeSelectorOpExists, corev1.ScopeSelectorOpDoesNotExist:
+		return len(req.Values) == 0
+	default:
+		return false
+	}
+}
+
+// deleteResourceQuotaViews deletes the views of the quota of the given name.
+func (r *SharedQuotaReconciler) deleteResourceQuotaViews(ctx context.Context, name string) error {
+	views, err := r.listResourceQuotaViews(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, view := range views {
+		if err := r.Delete(ctx, view); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listResourceQuotaViews returns the views of the quota of the given name by namespace.  ResourceQuotas that only
+// carry the label of the quota are not views, and are never deleted.
+func (r *SharedQuotaReconciler) listResourceQuotaViews(ctx context.Context, name string) (map[string]*corev1.ResourceQuota, error) {
+	viewList := &corev1.ResourceQuotaList{}
+	if err := r.List(ctx, viewList, client.MatchingLabels{quotav1.SharedQuotaLabel: name}); err != nil {
+		return nil, err
+	}
+	views := make(map[string]*corev1.ResourceQuota, len(viewList.Items))
+	for i := range viewList.Items {
+		if quotapkg.IsResourceQuotaViewOf(&viewList.Items[i], name) {
+			views[viewList.Items[i].Namespace] = &viewList.Items[i]
+		}
+	}
+	return views, nil
+}
+
+// writeResourceQuotaView applies the view of the quota in the namespace, which is nil if it does not exist yet.  The
+// ResourceQuota admission of the API server rejects every object of the namespace until the status of a new view is
+// set, the status is set from the usage of the namespace until the ResourceQuota controller recalculates it.
+func (r *SharedQuotaReconciler) writeResourceQuotaView(ctx context.Context, quota *quotav1.SharedQuota, namespace string,
+	view *corev1.ResourceQuota, spec corev1.ResourceQuotaSpec, annotations map[string]string, used corev1.ResourceList) error {
+	if view == nil || !equality.Semantic.DeepEqual(view.Spec, spec) || !hasAnnotations(view, annotations) {
+		applied := &corev1.ResourceQuota{
+			TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "ResourceQuota"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        quotapkg.ResourceQuotaViewPrefix + quota.Name,
+				Namespace:   namespace,
+				Labels:      map[string]string{quotav1.SharedQuotaLabel: quota.Name},
+				Annotations: annotations,
+				// the view is garbage collected with its quota
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(quota, quotav1.GroupVersion.WithKind("SharedQuota"))},
+			},
+			Spec: spec,
+		}
+		klog.V(6).Infof("apply resource quota view: %+v", applied)
+		if err := r.Patch(ctx, applied, client.Apply, client.FieldOwner(controllerName), client.ForceOwnership); err != nil {
+			return err
+		}
+		view = applied
+	}
+	if view.Status.Hard != nil {
+		return nil
+	}
+	original := view.DeepCopy()
+	view.Status = corev1.ResourceQuotaStatus{Hard: spec.Hard, Used: used}
+	klog.V(6).Infof("initialize resource quota view status: %s/%s", view.Namespace, view.Name)
+	return r.Status().Patch(ctx, view, client.MergeFrom(original))
+}
+
+// hasAnnotations returns true if the object carries the given annotations.
+func hasAnnotations(obj metav1.Object, annotations map[string]string) bool {
+	for key, value := range annotations {
+		if current, found := obj.GetAnnotations()[key]; !found || current != value {
+			return false
+		}
+	}
+	return true
+}
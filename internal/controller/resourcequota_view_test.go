@@ -0,0 +1,256 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	quotav1 "caih.com/api/v1"
+	quotapkg "caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+)
+
+func TestResourceQuotaViewSpec(t *testing.T) {
+	hard := corev1.ResourceList{
+		corev1.ResourcePods:           resource.MustParse("10"),
+		corev1.ResourceRequestsCPU:    resource.MustParse("4"),
+		corev1.ResourceServices:       resource.MustParse("5"),
+		"count/deployments.apps":      resource.MustParse("3"),
+		"requests.example.com/gpu":    resource.MustParse("2"),
+		"gpu":                         resource.MustParse("1"),
+		"count/Invalid_Name.apps/foo": resource.MustParse("1"),
+	}
+	testCases := map[string]struct {
+		spec     corev1.ResourceQuotaSpec
+		expected *corev1.ResourceQuotaSpec
+	}{
+		"unscoped": {
+			spec: corev1.ResourceQuotaSpec{Hard: hard},
+			expected: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+				corev1.ResourcePods:        resource.MustParse("10"),
+				corev1.ResourceRequestsCPU: resource.MustParse("4"),
+				corev1.ResourceServices:    resource.MustParse("5"),
+				"count/deployments.apps":   resource.MustParse("3"),
+				"requests.example.com/gpu": resource.MustParse("2"),
+			}},
+		},
+		"scopes": {
+			spec: corev1.ResourceQuotaSpec{Hard: hard, Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort}},
+			expected: &corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					corev1.ResourcePods:        resource.MustParse("10"),
+					"count/deployments.apps":   resource.MustParse("3"),
+					"requests.example.com/gpu": resource.MustParse("2"),
+				},
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+			},
+		},
+		"scope selector": {
+			spec: corev1.ResourceQuotaSpec{
+				Hard: hard,
+				ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{
+					{ScopeName: corev1.ResourceQuotaScopePriorityClass, Operator: corev1.ScopeSelectorOpIn, Values: []string{"high"}},
+				}},
+			},
+			expected: &corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					corev1.ResourcePods:        resource.MustParse("10"),
+					corev1.ResourceRequestsCPU: resource.MustParse("4"),
+					"count/deployments.apps":   resource.MustParse("3"),
+					"requests.example.com/gpu": resource.MustParse("2"),
+				},
+				ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{
+					{ScopeName: corev1.ResourceQuotaScopePriorityClass, Operator: corev1.ScopeSelectorOpIn, Values: []string{"high"}},
+				}},
+			},
+		},
+		"no resource": {
+			spec: corev1.ResourceQuotaSpec{
+				Hard:   corev1.ResourceList{corev1.ResourceServices: resource.MustParse("5"), "gpu": resource.MustParse("1")},
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeTerminating},
+			},
+		},
+		"custom scope": {
+			spec: corev1.ResourceQuotaSpec{Hard: hard, Scopes: []corev1.ResourceQuotaScope{core.ResourceQuotaScopeIngressClass}},
+		},
+		"custom scope selector": {
+			spec: corev1.ResourceQuotaSpec{
+				Hard: hard,
+				ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{
+					{ScopeName: core.ResourceQuotaScopeLoadBalancerClass, Operator: corev1.ScopeSelectorOpIn, Values: []string{"metallb"}},
+				}},
+			},
+		},
+		"invalid scope selector": {
+			spec: corev1.ResourceQuotaSpec{
+				Hard: hard,
+				ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{
+					{ScopeName: corev1.ResourceQuotaScopeTerminating, Operator: corev1.ScopeSelectorOpIn, Values: []string{"true"}},
+				}},
+			},
+		},
+		"conflicting scopes": {
+			spec: corev1.ResourceQuotaSpec{
+				Hard:   hard,
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+				ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{
+					{ScopeName: corev1.ResourceQuotaScopeNotBestEffort, Operator: corev1.ScopeSelectorOpExists},
+				}},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			spec, ok := resourceQuotaViewSpec(tc.spec)
+			if tc.expected == nil {
+				if ok {
+					t.Fatalf("expected no view, got %+v", spec)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected a view")
+			}
+			if !equality.Semantic.DeepEqual(spec, *tc.expected) {
+				t.Errorf("expected %+v, got %+v", *tc.expected, spec)
+			}
+		})
+	}
+}
+
+func TestSyncResourceQuotaViews(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = quotav1.AddToScheme(testScheme)
+
+	quota := &quotav1.SharedQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", UID: "uid"},
+		Spec: quotav1.SharedQuotaSpec{Quota: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourcePods: resource.MustParse("10"),
+			"gpu":               resource.MustParse("1"),
+		}}},
+		Status: quotav1.SharedQuotaStatus{Total: corev1.ResourceQuotaStatus{Used: corev1.ResourceList{
+			corev1.ResourcePods: resource.MustParse("3"),
+			"gpu":               resource.MustParse("1"),
+		}}},
+	}
+	stale := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{
+		Name:            quotapkg.ResourceQuotaViewPrefix + "quota",
+		Namespace:       "stale",
+		Labels:          map[string]string{quotav1.SharedQuotaLabel: "quota"},
+		OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(quota, quotav1.GroupVersion.WithKind("SharedQuota"))},
+	}}
+	// ResourceQuotas of the users that only carry the label of the quota are not views
+	labelled := []client.Object{
+		&corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{
+			Name:      "compute",
+			Namespace: "stale",
+			Labels:    map[string]string{quotav1.SharedQuotaLabel: "quota"},
+		}},
+		&corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{
+			Name:      quotapkg.ResourceQuotaViewPrefix + "quota",
+			Namespace: "unowned",
+			Labels:    map[string]string{quotav1.SharedQuotaLabel: "quota"},
+		}},
+	}
+	// the fake client does not support server-side apply, applied views are created or updated
+	c := clientfake.NewClientBuilder().
+		WithScheme(testScheme).
+		WithObjects(stale).
+		WithObjects(labelled...).
+		WithStatusSubresource(&corev1.ResourceQuota{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if patch != client.Apply {
+					return c.Patch(ctx, obj, patch, opts...)
+				}
+				if err := c.Create(ctx, obj.DeepCopyObject().(client.Object)); !apierrors.IsAlreadyExists(err) {
+					return err
+				}
+				return c.Update(ctx, obj.DeepCopyObject().(client.Object))
+			},
+		}).
+		Build()
+	r := &SharedQuotaReconciler{Client: c, ResourceQuotaViews: true}
+	ctx := context.Background()
+
+	namespaceUsed := map[string]corev1.ResourceList{
+		"namespace": {corev1.ResourcePods: resource.MustParse("2"), "gpu": resource.MustParse("1")},
+	}
+	if err := r.syncResourceQuotaViews(ctx, quota, namespaceUsed); err != nil {
+		t.Fatal(err)
+	}
+	view := &corev1.ResourceQuota{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "namespace", Name: quotapkg.ResourceQuotaViewPrefix + "quota"}, view); err != nil {
+		t.Fatal(err)
+	}
+	hard := corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}
+	if !equality.Semantic.DeepEqual(view.Spec.Hard, hard) {
+		t.Errorf("expected the hard limits %v, got %v", hard, view.Spec.Hard)
+	}
+	status := corev1.ResourceQuotaStatus{Hard: hard, Used: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")}}
+	if !equality.Semantic.DeepEqual(view.Status, status) {
+		t.Errorf("expected the status %+v, got %+v", status, view.Status)
+	}
+	annotations := map[string]string{
+		quotapkg.ResourceQuotaViewUsedAnnotation:      `{"pods":"3"}`,
+		quotapkg.ResourceQuotaViewRemainingAnnotation: `{"pods":"7"}`,
+	}
+	if !maps.Equal(view.Annotations, annotations) {
+		t.Errorf("expected the annotations %v, got %v", annotations, view.Annotations)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(stale), &corev1.ResourceQuota{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the view of a namespace that no longer matches to be deleted, got %v", err)
+	}
+	for _, obj := range labelled {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), &corev1.ResourceQuota{}); err != nil {
+			t.Errorf("expected the resource quota %s/%s that is not a view to be kept, got %v", obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+
+	quota.Status.Total.Used[corev1.ResourcePods] = resource.MustParse("12")
+	if err := r.syncResourceQuotaViews(ctx, quota, namespaceUsed); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(view), view); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := view.Annotations[quotapkg.ResourceQuotaViewRemainingAnnotation]; remaining != `{"pods":"0"}` {
+		t.Errorf("expected no headroom left in a quota over its limits, got %s", remaining)
+	}
+
+	quota.Spec.Quota.Scopes = []corev1.ResourceQuotaScope{core.ResourceQuotaScopeGatewayClass}
+	if err := r.syncResourceQuotaViews(ctx, quota, namespaceUsed); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(view), &corev1.ResourceQuota{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the view of a quota with custom scopes to be deleted, got %v", err)
+	}
+}
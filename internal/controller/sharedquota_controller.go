@@ -18,21 +18,38 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
-	"k8s.io/apimachinery/pkg/labels"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/csaupgrade"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
-	"k8s.io/utils/strings/slices"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -41,6 +58,7 @@ import (
 
 	quotav1 "caih.com/api/v1"
 	quotapkg "caih.com/pkg/quota"
+	"caih.com/pkg/quota/accounting"
 	evaluatorcore "caih.com/pkg/quota/evaluator/core"
 	"caih.com/pkg/quota/generic"
 	"caih.com/pkg/quota/install"
@@ -63,28 +81,61 @@ type SharedQuotaReconciler struct {
 	// Knows how to calculate usage
 	registry                quotapkg.Registry
 	MaxConcurrentReconciles int
-	// Controls full recalculation of quota usage
+	// Controls full recalculation of quota usage, changed after setup with SetResyncPeriod
 	ResyncPeriod time.Duration
+	resyncPeriod atomic.Int64
+	// MappingCache maps namespaces to the quotas selecting them, created from the manager's cache if not set
+	MappingCache *quotapkg.QuotaMappingCache
+	// Maintains quota usage from informer events between full recalculations
+	engine *accounting.Engine
+	// lastRecalculated holds the time of the last full recalculation of every quota
+	lastRecalculated sync.Map
+	// ResourceQuotaViews mirrors every quota into a ResourceQuota in each namespace it selects
+	ResourceQuotaViews bool
 }
 
 func (r *SharedQuotaReconciler) Name() string {
 	return controllerName
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *SharedQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// SetResyncPeriod sets the period of the full recalculation of quota usage.  It is safe to call while reconciling.
+func (r *SharedQuotaReconciler) SetResyncPeriod(period time.Duration) {
+	r.resyncPeriod.Store(int64(period))
+}
+
+func (r *SharedQuotaReconciler) getResyncPeriod() time.Duration {
+	return time.Duration(r.resyncPeriod.Load())
+}
+
+// SetupWithManager sets up the controller with the Manager, ctx is the context the manager is started with.
+func (r *SharedQuotaReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
 	r.logger = ctrl.Log.WithName("controllers").WithName(controllerName)
 	r.recorder = mgr.GetEventRecorderFor(controllerName)
-	r.registry = generic.NewRegistry(install.NewQuotaConfigurationForControllers(mgr.GetClient()).Evaluators())
-	r.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
-	r.ResyncPeriod = DefaultResyncPeriod
+	r.registry = generic.NewRegistry(install.NewQuotaConfigurationForControllers(mgr.GetClient(), mgr.GetAPIReader()).Evaluators())
+	if r.MaxConcurrentReconciles <= 0 {
+		r.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
+	}
+	if r.ResyncPeriod <= 0 {
+		r.ResyncPeriod = DefaultResyncPeriod
+	}
+	r.SetResyncPeriod(r.ResyncPeriod)
+	r.engine = accounting.NewEngine(r.registry)
+	if r.MappingCache == nil {
+		mappingCache, err := quotapkg.NewQuotaMappingCache(ctx, mgr.GetCache())
+		if err != nil {
+			return err
+		}
+		r.MappingCache = mappingCache
+	}
 	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&quotav1.SharedQuota{}).
 		Named(controllerName).
 		WithOptions(controller.Options{
-			MaxConcurrentReconciles: DefaultMaxConcurrentReconciles,
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
 		}).
-		WithEventFilter(predicate.GenerationChangedPredicate{
+		// the deletion of a quota changes its generation, forcing it and selecting namespaces by expressions are
+		// annotations
+		WithEventFilter(predicate.Or(predicate.GenerationChangedPredicate{
 			TypedFuncs: predicate.Funcs{
 				UpdateFunc: func(e event.UpdateEvent) bool {
 					oldQuota := e.ObjectOld.(*quotav1.SharedQuota)
@@ -92,7 +143,7 @@ func (r *SharedQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					return !equality.Semantic.DeepEqual(oldQuota.Spec, newQuota.Spec)
 				},
 			},
-		}).
+		}, predicate.AnnotationChangedPredicate{})).
 		Build(r)
 	if err != nil {
 		return err
@@ -102,51 +153,170 @@ func (r *SharedQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		&corev1.Pod{},
 		&corev1.Service{},
 		&corev1.PersistentVolumeClaim{},
+		&networkingv1.Ingress{},
 	}
 	realClock := clock.RealClock{}
 	for _, resource := range resources {
-		p := predicate.GenerationChangedPredicate{
-			TypedFuncs: predicate.Funcs{
-				GenericFunc: func(e event.GenericEvent) bool {
-					return false
-				},
-				CreateFunc: func(e event.CreateEvent) bool {
-					return false
-				},
-				UpdateFunc: func(e event.UpdateEvent) bool {
-					notifyChange := false
-					// we only want to queue the updates we care about though as too much noise will overwhelm queue.
-					switch e.ObjectOld.(type) {
-					case *corev1.Pod:
-						oldPod := e.ObjectOld.(*corev1.Pod)
-						newPod := e.ObjectNew.(*corev1.Pod)
-						notifyChange = evaluatorcore.QuotaV1Pod(oldPod, realClock) && !evaluatorcore.QuotaV1Pod(newPod, realClock)
-					case *corev1.Service:
-						oldService := e.ObjectOld.(*corev1.Service)
-						newService := e.ObjectNew.(*corev1.Service)
-						notifyChange = evaluatorcore.GetQuotaServiceType(oldService) != evaluatorcore.GetQuotaServiceType(newService)
-					case *corev1.PersistentVolumeClaim:
-						notifyChange = true
-					}
-					return notifyChange
-				},
-				DeleteFunc: func(e event.DeleteEvent) bool {
-					return true
-				},
+		if err = r.trackResource(mgr, resource); err != nil {
+			return err
+		}
+		// pods reaching a terminal phase release usage without a generation change.  Created objects are reserved by
+		// admission, their reservations are dropped once they are counted.
+		p := predicate.Funcs{
+			GenericFunc: func(e event.GenericEvent) bool {
+				return false
+			},
+			CreateFunc: func(e event.CreateEvent) bool {
+				return r.hasReservations(ctx, e.Object.GetNamespace())
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				notifyChange := false
+				// we only want to queue the updates we care about though as too much noise will overwhelm queue.
+				switch e.ObjectOld.(type) {
+				case *corev1.Pod:
+					oldPod := e.ObjectOld.(*corev1.Pod)
+					newPod := e.ObjectNew.(*corev1.Pod)
+					notifyChange = evaluatorcore.QuotaV1Pod(oldPod, realClock) && !evaluatorcore.QuotaV1Pod(newPod, realClock)
+				case *corev1.Service:
+					oldService := e.ObjectOld.(*corev1.Service)
+					newService := e.ObjectNew.(*corev1.Service)
+					notifyChange = evaluatorcore.GetQuotaServiceType(oldService) != evaluatorcore.GetQuotaServiceType(newService)
+				case *corev1.PersistentVolumeClaim, *networkingv1.Ingress:
+					notifyChange = e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
+				}
+				return notifyChange
+			},
+			DeleteFunc: func(e event.DeleteEvent) bool {
+				return true
 			},
 		}
 		if err = c.Watch(source.Kind(mgr.GetCache(), resource, handler.EnqueueRequestsFromMapFunc(r.mapper), p)); err != nil {
 			return err
 		}
 	}
+
+	// reservations are folded once the admitted objects are counted, the ledgers are only updated by admission until
+	// then.  A ledger has the name of its quota.
+	ledgerPredicate := predicate.Funcs{
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return len(e.ObjectOld.(*quotav1.SharedQuotaLedger).Spec.Reservations) == 0 &&
+				len(e.ObjectNew.(*quotav1.SharedQuotaLedger).Spec.Reservations) > 0
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+	}
+	if err = c.Watch(source.Kind(mgr.GetCache(), client.Object(&quotav1.SharedQuotaLedger{}), handler.EnqueueRequestsFromMapFunc(
+		func(ctx context.Context, obj client.Object) []reconcile.Request {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetName()}}}
+		}), ledgerPredicate)); err != nil {
+		return err
+	}
+
+	if r.ResourceQuotaViews {
+		// the views are restored when they are edited or deleted, their status is updated by every admission
+		viewPredicate := predicate.Funcs{
+			GenericFunc: func(e event.GenericEvent) bool {
+				return false
+			},
+			CreateFunc: func(e event.CreateEvent) bool {
+				return false
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				name, found := e.ObjectOld.GetLabels()[quotav1.SharedQuotaLabel]
+				return found && (name != e.ObjectNew.GetLabels()[quotav1.SharedQuotaLabel] ||
+					!equality.Semantic.DeepEqual(e.ObjectOld.(*corev1.ResourceQuota).Spec, e.ObjectNew.(*corev1.ResourceQuota).Spec))
+			},
+			DeleteFunc: func(e event.DeleteEvent) bool {
+				_, found := e.Object.GetLabels()[quotav1.SharedQuotaLabel]
+				return found
+			},
+		}
+		if err = c.Watch(source.Kind(mgr.GetCache(), client.Object(&corev1.ResourceQuota{}), handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetLabels()[quotav1.SharedQuotaLabel]}}}
+			}), viewPredicate)); err != nil {
+			return err
+		}
+	}
+
+	// these resources are served by CRDs that may not be installed, only watch them when the API exists.
+	optionalResources := map[schema.GroupVersionKind][]string{
+		// the restore size is only known once the snapshot controller reports it
+		evaluatorcore.VolumeSnapshotGroupVersionKind: {"status", "restoreSize"},
+		evaluatorcore.GatewayGroupVersionKind:        {"spec", "gatewayClassName"},
+		evaluatorcore.HTTPRouteGroupVersionKind:      {"spec", "hostnames"},
+	}
+	for gvk, field := range optionalResources {
+		if err = r.watchOptionalResource(mgr, c, gvk, field); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// watchOptionalResource watches a resource served by a CRD when its API exists.  Updates are only queued when the
+// field that affects usage changes.
+func (r *SharedQuotaReconciler) watchOptionalResource(mgr ctrl.Manager, c controller.Controller, gvk schema.GroupVersionKind, field []string) error {
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		r.logger.Info("API not found, usage is only recalculated on resync", "gvk", gvk)
+		return nil
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := r.trackResource(mgr, obj); err != nil {
+		return err
+	}
+	p := predicate.Funcs{
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldValue, _, _ := unstructured.NestedFieldNoCopy(e.ObjectOld.(*unstructured.Unstructured).Object, field...)
+			newValue, _, _ := unstructured.NestedFieldNoCopy(e.ObjectNew.(*unstructured.Unstructured).Object, field...)
+			return !equality.Semantic.DeepEqual(oldValue, newValue)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return true
+		},
+	}
+	return c.Watch(source.Kind(mgr.GetCache(), client.Object(obj), handler.EnqueueRequestsFromMapFunc(r.mapper), p))
+}
+
+// trackResource feeds the objects of the resource observed by the cache to the accounting engine.
+func (r *SharedQuotaReconciler) trackResource(mgr ctrl.Manager, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mapping, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	informer, err := mgr.GetCache().GetInformer(context.Background(), obj)
+	if err != nil {
+		return err
+	}
+	sharedInformer, ok := informer.(toolscache.SharedInformer)
+	if !ok {
+		// only informers of the manager's cache are expected
+		r.logger.Info("informer cannot be tracked, usage is recalculated on every sync", "gvk", gvk)
+		return nil
+	}
+	return r.engine.Track(mapping.Resource.GroupResource(), sharedInformer)
+}
+
 func (r *SharedQuotaReconciler) mapper(ctx context.Context, h client.Object) []reconcile.Request {
 	// check if the quota controller can evaluate this kind, if not, ignore it altogether...
 	var result []reconcile.Request
 	evaluators := r.registry.List()
-	resourceQuotaNames, err := quotapkg.ResourceQuotaNamesFor(ctx, r.Client, h.GetNamespace())
+	resourceQuotaNames, err := r.MappingCache.ResourceQuotaNamesFor(h.GetNamespace())
 	if err != nil {
 		klog.Errorf("failed to get resource quota names for: %v %T %v, err: %v", h.GetNamespace(), h, h.GetName(), err)
 		return result
@@ -174,6 +344,10 @@ func (r *SharedQuotaReconciler) mapper(ctx context.Context, h client.Object) []r
 // +kubebuilder:rbac:groups=quota.caih.com,resources=sharedquotas,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=quota.caih.com,resources=sharedquotas/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=quota.caih.com,resources=sharedquotas/finalizers,verbs=update
+// +kubebuilder:rbac:groups=quota.caih.com,resources=sharedquotaledgers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=quota.caih.com,resources=sharedquotausages,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=resourcequotas,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=resourcequotas/status,verbs=get;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -189,29 +363,266 @@ func (r *SharedQuotaReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	rootCtx := klog.NewContext(ctx, logger)
 	sharedQuota := &quotav1.SharedQuota{}
 	if err := r.Get(rootCtx, req.NamespacedName, sharedQuota); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.engine.Forget(req.Name)
+			r.lastRecalculated.Delete(req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	if !sharedQuota.DeletionTimestamp.IsZero() {
+		return r.finalize(rootCtx, logger, sharedQuota)
+	}
+	if !controllerutil.ContainsFinalizer(sharedQuota, quotav1.CleanupFinalizer) {
+		patch := client.MergeFromWithOptions(sharedQuota.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		controllerutil.AddFinalizer(sharedQuota, quotav1.CleanupFinalizer)
+		if err := r.Patch(rootCtx, sharedQuota, patch); err != nil {
+			logger.Error(err, "failed to add finalizer")
+			return ctrl.Result{}, client.IgnoreNotFound(err)
+		}
+	}
 
-	if err := r.syncQuotaForNamespaces(sharedQuota); err != nil {
+	// reservations made before the objects they are for are observed by the cache must survive this recalculation,
+	// the objects observed before it are counted by it
+	counted, err := r.countedReservations(rootCtx, sharedQuota.Name)
+	if err != nil {
+		logger.Error(err, "failed to list reservations")
+		return ctrl.Result{}, err
+	}
+	syncStart := time.Now()
+	if _, err := r.syncQuotaForNamespaces(sharedQuota); err != nil {
+		if selectorErr := (namespaceSelectorError{}); errors.As(err, &selectorErr) {
+			// retrying does not help until the selector is fixed, which updates the quota
+			logger.Error(err, "invalid namespace selector of quota")
+			r.recorder.Event(sharedQuota, corev1.EventTypeWarning, quotav1.ReasonInvalidNamespaceSelector, selectorErr.Error())
+			return ctrl.Result{RequeueAfter: r.getResyncPeriod()}, nil
+		}
+		if generic.IsScopeMatchError(err) {
+			// retrying does not help until the quota or the objects are fixed, the reservations are kept since the
+			// usage of the status is stale
+			logger.Error(err, "invalid scopes of quota")
+			r.recorder.Event(sharedQuota, corev1.EventTypeWarning, quotav1.ReasonScopeMatchFailed, err.Error())
+			return ctrl.Result{RequeueAfter: r.getResyncPeriod()}, nil
+		}
 		logger.Error(err, "failed to sync quota")
 		return ctrl.Result{}, err
 	}
+	pending, err := r.foldReservations(rootCtx, sharedQuota.Name, syncStart.Add(-quotapkg.DefaultReservationGracePeriod), counted)
+	if err != nil {
+		logger.Error(err, "failed to fold reservations")
+		return ctrl.Result{}, err
+	}
 
 	r.recorder.Event(sharedQuota, corev1.EventTypeNormal, "Synced", "Synced successfully")
-	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+	if pending {
+		// fold the remaining reservations once they are old enough
+		return ctrl.Result{RequeueAfter: min(quotapkg.DefaultReservationGracePeriod, r.getResyncPeriod())}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.getResyncPeriod()}, nil
+}
+
+// finalize removes the objects and the state derived from the deleted quota, then its finalizer.  A quota whose
+// DeletionPolicy is Block is kept, and enforced, while it is in use unless its deletion is forced.
+func (r *SharedQuotaReconciler) finalize(ctx context.Context, logger logr.Logger, sharedQuota *quotav1.SharedQuota) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(sharedQuota, quotav1.CleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if sharedQuota.Spec.DeletionPolicy == quotav1.DeletionBlock && sharedQuota.Annotations[quotav1.ForceDeleteAnnotation] != "true" {
+		counted, err := r.countedReservations(ctx, sharedQuota.Name)
+		if err != nil {
+			logger.Error(err, "failed to list reservations")
+			return ctrl.Result{}, err
+		}
+		syncStart := time.Now()
+		used, err := r.syncQuotaForNamespaces(sharedQuota)
+		if err != nil && !generic.IsScopeMatchError(err) {
+			logger.Error(err, "failed to sync quota")
+			return ctrl.Result{}, err
+		}
+		// the usage is stale while the scopes cannot be matched
+		inUse := err != nil || !quotapkg.IsZero(used)
+		if !inUse {
+			pending, err := r.foldReservations(ctx, sharedQuota.Name, syncStart.Add(-quotapkg.DefaultReservationGracePeriod), counted)
+			if err != nil {
+				logger.Error(err, "failed to fold reservations")
+				return ctrl.Result{}, err
+			}
+			inUse = pending
+		}
+		if inUse {
+			r.recorder.Eventf(sharedQuota, corev1.EventTypeWarning, "DeletionBlocked",
+				"Deletion is blocked while the quota is in use, annotate it with %s=true to force it", quotav1.ForceDeleteAnnotation)
+			return ctrl.Result{RequeueAfter: min(quotapkg.DefaultReservationGracePeriod, r.getResyncPeriod())}, nil
+		}
+	}
+
+	namespaces, err := r.cleanup(ctx, sharedQuota.Name)
+	if err != nil {
+		logger.Error(err, "failed to clean up quota")
+		return ctrl.Result{}, err
+	}
+	r.recorder.Eventf(sharedQuota, corev1.EventTypeNormal, "Deleted",
+		"Stopped enforcing the quota and removed its usage in %d namespaces", namespaces)
+	patch := client.MergeFromWithOptions(sharedQuota.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(sharedQuota, quotav1.CleanupFinalizer)
+	if err := r.Patch(ctx, sharedQuota, patch); err != nil {
+		logger.Error(err, "failed to remove finalizer")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return ctrl.Result{}, nil
 }
 
-func (r *SharedQuotaReconciler) syncQuotaForNamespaces(originalQuota *quotav1.SharedQuota) error {
+// cleanup deletes the usages and the ledgers of the quota, and forgets the usage tracked for it.  It returns the
+// number of namespaces whose usage was deleted.
+func (r *SharedQuotaReconciler) cleanup(ctx context.Context, name string) (int, error) {
+	usageList := &quotav1.SharedQuotaUsageList{}
+	if err := r.List(ctx, usageList, client.MatchingLabels{quotav1.SharedQuotaLabel: name}); err != nil {
+		return 0, err
+	}
+	for i := range usageList.Items {
+		if err := r.Delete(ctx, &usageList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+	}
+	if err := r.deleteResourceQuotaViews(ctx, name); err != nil {
+		return 0, err
+	}
+	ledgerList := &quotav1.SharedQuotaLedgerList{}
+	if err := r.List(ctx, ledgerList, client.MatchingLabels{quotav1.SharedQuotaLabel: name}); err != nil {
+		return 0, err
+	}
+	for i := range ledgerList.Items {
+		if err := r.Delete(ctx, &ledgerList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+	}
+	r.engine.Forget(name)
+	r.lastRecalculated.Delete(name)
+	return len(usageList.Items), nil
+}
+
+// hasReservations returns true if usage is reserved for a quota in the namespace, or if the ledgers cannot be listed
+// so that the reservations are not left unfolded.
+func (r *SharedQuotaReconciler) hasReservations(ctx context.Context, namespace string) bool {
+	ledgerList := &quotav1.SharedQuotaLedgerList{}
+	if err := r.List(ctx, ledgerList, client.InNamespace(namespace)); err != nil {
+		klog.Errorf("failed to list ledgers of namespace %s: %v", namespace, err)
+		return true
+	}
+	for i := range ledgerList.Items {
+		if len(ledgerList.Items[i].Spec.Reservations) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// countedReservations returns the objects of the reservations of the quota that are counted by a recalculation of
+// its usage from now on, by namespace.
+func (r *SharedQuotaReconciler) countedReservations(ctx context.Context, name string) (map[string]sets.Set[quotav1.ReservedObject], error) {
+	ledgerList := &quotav1.SharedQuotaLedgerList{}
+	if err := r.List(ctx, ledgerList, client.MatchingLabels{quotav1.SharedQuotaLabel: name}); err != nil {
+		return nil, err
+	}
+	counted := map[string]sets.Set[quotav1.ReservedObject]{}
+	for _, ledger := range ledgerList.Items {
+		for _, reservation := range ledger.Spec.Reservations {
+			if reservation.Object == nil {
+				continue
+			}
+			groupResource := schema.GroupResource{Group: reservation.Object.Group, Resource: reservation.Object.Resource}
+			// the reservations of resources that are not tracked are only dropped once they are old enough
+			observed, known := r.engine.Observed(groupResource, ledger.Namespace, reservation.Object.Name)
+			if !known || !quotapkg.ObjectCounted(*reservation.Object, observed) {
+				continue
+			}
+			if counted[ledger.Namespace] == nil {
+				counted[ledger.Namespace] = sets.New[quotav1.ReservedObject]()
+			}
+			counted[ledger.Namespace].Insert(*reservation.Object)
+		}
+	}
+	return counted, nil
+}
+
+// foldReservations removes the reservations made before the given time, and the counted reservations, from the
+// ledgers of the quota.  The status was recalculated from the objects they were made for, or the objects never
+// appeared.  It returns true if reservations remain.
+func (r *SharedQuotaReconciler) foldReservations(ctx context.Context, name string, before time.Time, counted map[string]sets.Set[quotav1.ReservedObject]) (bool, error) {
+	ledgerList := &quotav1.SharedQuotaLedgerList{}
+	if err := r.List(ctx, ledgerList, client.MatchingLabels{quotav1.SharedQuotaLabel: name}); err != nil {
+		return false, err
+	}
+	pending := false
+	for i := range ledgerList.Items {
+		key := client.ObjectKeyFromObject(&ledgerList.Items[i])
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			ledger := &quotav1.SharedQuotaLedger{}
+			if err := r.Get(ctx, key, ledger); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			ledger = ledger.DeepCopy()
+			// a reservation merged with another one since is kept
+			changed := quotapkg.PruneReservations(ledger, before, func(object quotav1.ReservedObject) bool {
+				return counted[key.Namespace].Has(object)
+			})
+			if len(ledger.Spec.Reservations) > 0 {
+				pending = true
+			}
+			if !changed {
+				return nil
+			}
+			// an update replaces the reservations applied by admission, an apply could not remove those it does not own
+			return r.Update(ctx, ledger)
+		})
+		if err != nil {
+			return pending, err
+		}
+	}
+	return pending, nil
+}
+
+// namespaceSelectorError is returned by syncQuotaForNamespaces when the namespace selector of the quota is invalid.
+type namespaceSelectorError struct {
+	error
+}
+
+func (r *SharedQuotaReconciler) syncQuotaForNamespaces(originalQuota *quotav1.SharedQuota) (corev1.ResourceList, error) {
 	quota := originalQuota.DeepCopy()
 	ctx := context.TODO()
 	// get the list of namespaces that match this cluster quota
+	selector, err := quota.NamespaceSelector()
+	if err != nil {
+		// the usage of the status is stale, admission rejects the requests of the namespaces selected before
+		meta.SetStatusCondition(&quota.Status.Conditions, metav1.Condition{
+			Type:               quotav1.ConditionUsageCalculated,
+			Status:             metav1.ConditionFalse,
+			Reason:             quotav1.ReasonInvalidNamespaceSelector,
+			Message:            err.Error(),
+			ObservedGeneration: quota.Generation,
+		})
+		if !equality.Semantic.DeepEqual(quota, originalQuota) {
+			if err := r.applyStatus(ctx, originalQuota, &quota.Status); err != nil {
+				return nil, err
+			}
+		}
+		return nil, namespaceSelectorError{err}
+	}
 	matchingNamespaceList := corev1.NamespaceList{}
-	if err := r.List(ctx, &matchingNamespaceList, &client.ListOptions{LabelSelector: labels.SelectorFromSet(quota.Spec.LabelSelector)}); err != nil {
-		return err
+	// a quota without selector selects no namespace
+	if selector != nil {
+		if err := r.List(ctx, &matchingNamespaceList, &client.ListOptions{LabelSelector: selector}); err != nil {
+			return nil, err
+		}
 	}
 
-	if quota.Status.Namespaces == nil {
-		quota.Status.Namespaces = make([]quotav1.ResourceQuotaStatusByNamespace, 0)
+	// the usage of every namespace, including the namespaces that are no longer selected
+	usageList := &quotav1.SharedQuotaUsageList{}
+	if err := r.List(ctx, usageList, client.MatchingLabels{quotav1.SharedQuotaLabel: quota.Name}); err != nil {
+		return nil, err
+	}
+	usages := make(map[string]*quotav1.SharedQuotaUsage, len(usageList.Items))
+	for i := range usageList.Items {
+		usages[usageList.Items[i].Namespace] = &usageList.Items[i]
 	}
 
 	matchingNamespaceNames := make([]string, 0)
@@ -219,51 +630,188 @@ func (r *SharedQuotaReconciler) syncQuotaForNamespaces(originalQuota *quotav1.Sh
 		matchingNamespaceNames = append(matchingNamespaceNames, namespace.Name)
 	}
 
-	for _, namespace := range matchingNamespaceList.Items {
-		namespaceName := namespace.Name
-		namespaceTotals, _ := quotapkg.GetResourceQuotasStatusByNamespace(quota.Status.Namespaces, namespaceName)
+	// the usage is maintained from informer events, a full recalculation once per resync period corrects any drift
+	syncStart := time.Now()
+	recalculate := true
+	if lastRecalculated, found := r.lastRecalculated.Load(quota.Name); found {
+		recalculate = syncStart.Sub(lastRecalculated.(time.Time)) >= r.getResyncPeriod()
+	}
+
+	var scopeErrs []error
+	totalUsed := corev1.ResourceList{}
+	namespaceUsed := make(map[string]corev1.ResourceList, len(matchingNamespaceNames))
+	for _, namespaceName := range matchingNamespaceNames {
+		usage := usages[namespaceName]
+		delete(usages, namespaceName)
 
-		actualUsage, err := quotaUsageCalculationFunc(namespaceName, quota.Spec.Quota.Scopes, quota.Spec.Quota.Hard, r.registry, quota.Spec.Quota.ScopeSelector)
+		var actualUsage corev1.ResourceList
+		var err error
+		if recalculate {
+			actualUsage, err = quotaUsageCalculationFunc(namespaceName, quota.Spec.Quota.Scopes, quota.Spec.Quota.Hard, r.registry, quota.Spec.Quota.ScopeSelector)
+		} else {
+			actualUsage, err = r.engine.Usage(quota.Name, quota.Spec.Quota, namespaceName)
+		}
+		if generic.IsScopeMatchError(err) {
+			// the usage misses the objects that could not be matched, keep the last usage of the namespace
+			scopeErrs = append(scopeErrs, fmt.Errorf("namespace %s: %w", namespaceName, err))
+			var lastUsed corev1.ResourceList
+			if usage != nil {
+				lastUsed = usage.Status.Used
+			}
+			totalUsed = quotapkg.Add(totalUsed, lastUsed)
+			namespaceUsed[namespaceName] = lastUsed
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
-		recalculatedStatus := corev1.ResourceQuotaStatus{
-			Used: actualUsage,
-			Hard: quota.Spec.Quota.Hard,
+		if recalculate {
+			if _, err := r.engine.Correct(quota.Name, quota.Spec.Quota, namespaceName, actualUsage); err != nil {
+				klog.Errorf("failed to compare usage of quota %s in namespace %s: %v", quota.Name, namespaceName, err)
+			}
 		}
-
-		// subtract old usage, add new usage
-		quota.Status.Total.Used = quotapkg.Subtract(quota.Status.Total.Used, namespaceTotals.Used)
-		quota.Status.Total.Used = quotapkg.Add(quota.Status.Total.Used, recalculatedStatus.Used)
-		quotapkg.InsertResourceQuotasStatus(&quota.Status.Namespaces, quotav1.ResourceQuotaStatusByNamespace{
-			Namespace:           namespaceName,
-			ResourceQuotaStatus: recalculatedStatus,
-		})
+		if err := r.writeUsage(ctx, quota, namespaceName, usage, actualUsage); err != nil {
+			return nil, err
+		}
+		totalUsed = quotapkg.Add(totalUsed, actualUsage)
+		namespaceUsed[namespaceName] = actualUsage
 	}
 
-	// Remove any namespaces from quota.status that no longer match.
-	statusCopy := quota.Status.Namespaces.DeepCopy()
-	for _, namespaceTotals := range statusCopy {
-		namespaceName := namespaceTotals.Namespace
-		if !slices.Contains(matchingNamespaceNames, namespaceName) {
-			quota.Status.Total.Used = quotapkg.Subtract(quota.Status.Total.Used, namespaceTotals.Used)
-			quotapkg.RemoveResourceQuotasStatusByNamespace(&quota.Status.Namespaces, namespaceName)
+	// Remove the usage of the namespaces that no longer match.
+	for _, usage := range usages {
+		if err := r.Delete(ctx, usage); client.IgnoreNotFound(err) != nil {
+			return nil, err
 		}
+		r.engine.Forget(quota.Name, usage.Namespace)
 	}
 
+	quota.Status.Total.Used = totalUsed
+	quota.Status.NamespaceCount = int32(len(matchingNamespaceNames))
+	// the deprecated per-namespace status mirrors the SharedQuotaUsage objects
+	quota.Status.Namespaces = namespaceStatuses(namespaceUsed)
 	quota.Status.Total.Hard = quota.Spec.Quota.Hard
 
-	// if there's no change, no update, return early.  NewAggregate returns nil on empty input
-	if equality.Semantic.DeepEqual(quota, originalQuota) {
-		return nil
+	if err := r.syncResourceQuotaViews(ctx, quota, namespaceUsed); err != nil {
+		return nil, err
+	}
+
+	// NewAggregate returns nil on empty input
+	scopeErr := utilerrors.NewAggregate(scopeErrs)
+	condition := metav1.Condition{
+		Type:               quotav1.ConditionUsageCalculated,
+		Status:             metav1.ConditionTrue,
+		Reason:             quotav1.ReasonCalculated,
+		Message:            "Usage is calculated in every selected namespace",
+		ObservedGeneration: quota.Generation,
+	}
+	if scopeErr != nil {
+		scopeMatchErrorsTotal.WithLabelValues(quota.Name).Add(float64(len(scopeErrs)))
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = quotav1.ReasonScopeMatchFailed
+		condition.Message = scopeErr.Error()
+	}
+	meta.SetStatusCondition(&quota.Status.Conditions, condition)
+
+	// if there's no change, no update, return early.
+	if !equality.Semantic.DeepEqual(quota, originalQuota) {
+		if err := r.applyStatus(ctx, originalQuota, &quota.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	if scopeErr != nil {
+		// recalculate on the next sync
+		return totalUsed, scopeErr
+	}
+	if recalculate {
+		r.lastRecalculated.Store(quota.Name, syncStart)
+	}
+	return totalUsed, nil
+}
+
+// applyStatus applies the status of the quota.  The fields the controller no longer sets, such as the resources
+// removed from the hard limits, are removed from the status.
+func (r *SharedQuotaReconciler) applyStatus(ctx context.Context, quota *quotav1.SharedQuota, status *quotav1.SharedQuotaStatus) error {
+	if err := r.upgradeManagedFields(ctx, quota, "status"); err != nil {
+		return err
 	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return err
+	}
+	// the spec is left out of the applied configuration, a typed quota would serialize its empty fields
+	applied := &unstructured.Unstructured{Object: map[string]interface{}{"status": content}}
+	applied.SetGroupVersionKind(quotav1.GroupVersion.WithKind("SharedQuota"))
+	applied.SetName(quota.Name)
+	klog.V(6).Infof("apply resource quota status: %+v", applied)
+	return r.Status().Patch(ctx, applied, client.Apply, client.FieldOwner(controllerName), client.ForceOwnership)
+}
+
+// writeUsage records the usage of the quota in the namespace in its SharedQuotaUsage, which is nil if it does not
+// exist yet.
+func (r *SharedQuotaReconciler) writeUsage(ctx context.Context, quota *quotav1.SharedQuota, namespace string,
+	usage *quotav1.SharedQuotaUsage, used corev1.ResourceList) error {
+	if usage != nil {
+		if equality.Semantic.DeepEqual(usage.Status.Used, used) {
+			return nil
+		}
+		if err := r.upgradeManagedFields(ctx, usage, ""); err != nil {
+			return err
+		}
+	}
+	// the usage is applied whole, whether it was observed or not
+	applied := &quotav1.SharedQuotaUsage{
+		TypeMeta: metav1.TypeMeta{APIVersion: quotav1.GroupVersion.String(), Kind: "SharedQuotaUsage"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      quota.Name,
+			Namespace: namespace,
+			Labels:    map[string]string{quotav1.SharedQuotaLabel: quota.Name},
+			// the usage is garbage collected with its quota
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(quota, quotav1.GroupVersion.WithKind("SharedQuota"))},
+		},
+		Status: quotav1.SharedQuotaUsageStatus{Used: used},
+	}
+	klog.V(6).Infof("apply resource quota usage: %+v", applied)
+	return r.Patch(ctx, applied, client.Apply, client.FieldOwner(controllerName), client.ForceOwnership)
+}
 
-	klog.V(6).Infof("update resource quota: %+v", quota)
-	if err := r.Status().Update(ctx, quota); err != nil {
+// upgradeManagedFields hands the fields of the object, or of its subresource, written by updates over to the apply
+// patches of the controller, so that the fields it stops applying are removed instead of being kept by their former
+// managers.  It does nothing once the object has been upgraded.
+func (r *SharedQuotaReconciler) upgradeManagedFields(ctx context.Context, obj client.Object, subresource string) error {
+	updateManagers := sets.New[string]()
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Operation == metav1.ManagedFieldsOperationUpdate && entry.Subresource == subresource {
+			updateManagers.Insert(entry.Manager)
+		}
+	}
+	if updateManagers.Len() == 0 {
+		return nil
+	}
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(obj, updateManagers, controllerName, csaupgrade.Subresource(subresource))
+	if err != nil || patch == nil {
 		return err
 	}
+	klog.V(4).Infof("upgrade managed fields of %s: %s", obj.GetName(), patch)
+	err = r.Patch(ctx, obj.DeepCopyObject().(client.Object), client.RawPatch(types.JSONPatchType, patch))
+	// the object changed since it was observed, it is upgraded by a later sync
+	if apierrors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
 
-	return nil
+// namespaceStatuses returns the usage of every namespace as the per-namespace status of a quota.  The namespaces are
+// sorted so that an unchanged usage is applied unchanged.
+func namespaceStatuses(namespaceUsed map[string]corev1.ResourceList) quotav1.ResourceQuotasStatusByNamespace {
+	if len(namespaceUsed) == 0 {
+		return nil
+	}
+	statuses := make(quotav1.ResourceQuotasStatusByNamespace, 0, len(namespaceUsed))
+	for _, namespace := range slices.Sorted(maps.Keys(namespaceUsed)) {
+		statuses = append(statuses, quotav1.ResourceQuotaStatusByNamespace{Namespace: namespace, Used: namespaceUsed[namespace]})
+	}
+	return statuses
 }
 
 // quotaUsageCalculationFunc is a function to calculate quota usage.  It is only configurable for easy unit testing
@@ -0,0 +1,654 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	quotav1 "caih.com/api/v1"
+	quotav1beta2 "caih.com/api/v1beta2"
+	quotapkg "caih.com/pkg/quota"
+)
+
+var _ = Describe("SharedQuota", func() {
+	var (
+		// team is the label value selecting the namespaces of the spec
+		team        string
+		sharedQuota *quotav1.SharedQuota
+	)
+
+	BeforeEach(func() {
+		team = "team-" + rand.String(6)
+	})
+
+	AfterEach(func() {
+		if sharedQuota != nil {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, sharedQuota))).To(Succeed())
+			sharedQuota = nil
+		}
+	})
+
+	Context("admitting pods", func() {
+		var namespaces []string
+
+		BeforeEach(func() {
+			namespaces = []string{createNamespace(team), createNamespace(team)}
+			sharedQuota = createSharedQuota(team, corev1.ResourceList{
+				corev1.ResourcePods:        resource.MustParse("3"),
+				corev1.ResourceRequestsCPU: resource.MustParse("1"),
+			})
+		})
+
+		It("denies pods exceeding the quota across namespaces", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "200m"))).To(Succeed())
+
+			By("denying a request that exceeds the remaining cpu")
+			err := k8sClient.Create(ctx, newPod(namespaces[0], "700m"))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "100m"))).To(Succeed())
+
+			By("denying a fourth pod")
+			err = k8sClient.Create(ctx, newPod(namespaces[0], "100m"))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+		})
+
+		It("reports the total and per-namespace usage", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "300m"))).To(Succeed())
+
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("3"))
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourceRequestsCPU)).Should(Equal("700m"))
+			Eventually(usedOf(sharedQuota.Name, namespaces[0], corev1.ResourcePods)).Should(Equal("2"))
+			Eventually(usedOf(sharedQuota.Name, namespaces[0], corev1.ResourceRequestsCPU)).Should(Equal("400m"))
+			Eventually(usedOf(sharedQuota.Name, namespaces[1], corev1.ResourcePods)).Should(Equal("1"))
+			Eventually(usedOf(sharedQuota.Name, namespaces[1], corev1.ResourceRequestsCPU)).Should(Equal("300m"))
+			Eventually(namespacesOf(sharedQuota.Name)).Should(ConsistOf(namespaces))
+
+			current := &quotav1.SharedQuota{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current)).To(Succeed())
+			Expect(current.Status.NamespaceCount).To(BeEquivalentTo(2))
+
+			By("mirroring the usage of every namespace in the deprecated status")
+			expectedCPU := map[string]string{namespaces[0]: "400m", namespaces[1]: "300m"}
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current)).To(Succeed())
+				g.Expect(current.Status.Namespaces).To(HaveLen(2))
+				for _, namespaceStatus := range current.Status.Namespaces {
+					used := namespaceStatus.Used[corev1.ResourceRequestsCPU]
+					g.Expect(used.String()).To(Equal(expectedCPU[namespaceStatus.Namespace]))
+				}
+			}).Should(Succeed())
+		})
+
+		It("releases the usage of deleted pods", func() {
+			pod := newPod(namespaces[0], "200m")
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "200m"))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "200m"))).To(Succeed())
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("3"))
+
+			Expect(k8sClient.Delete(ctx, pod, client.GracePeriodSeconds(0))).To(Succeed())
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("2"))
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+		})
+
+		It("shows the quota and the usage of every namespace in its view", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "300m"))).To(Succeed())
+
+			for i, cpu := range []string{"200m", "300m"} {
+				Eventually(func(g Gomega) {
+					view := &quotav1.SharedQuotaView{}
+					key := client.ObjectKey{Namespace: namespaces[i], Name: quotav1.SharedQuotaViewName}
+					g.Expect(k8sClient.Get(ctx, key, view)).To(Succeed())
+					g.Expect(view.Status.Quotas).To(HaveLen(1))
+					applied := view.Status.Quotas[0]
+					g.Expect(applied.Name).To(Equal(sharedQuota.Name))
+					g.Expect(quotapkg.Equals(applied.Hard, sharedQuota.Spec.Quota.Hard)).To(BeTrue())
+					used := applied.Used[corev1.ResourceRequestsCPU]
+					g.Expect(used.String()).To(Equal("500m"))
+					namespaceUsed := applied.NamespaceUsed[corev1.ResourceRequestsCPU]
+					g.Expect(namespaceUsed.String()).To(Equal(cpu))
+				}).Should(Succeed())
+			}
+
+			By("deleting the view once the quota is deleted")
+			Expect(k8sClient.Delete(ctx, sharedQuota)).To(Succeed())
+			Eventually(func() bool {
+				key := client.ObjectKey{Namespace: namespaces[0], Name: quotav1.SharedQuotaViewName}
+				return apierrors.IsNotFound(k8sClient.Get(ctx, key, &quotav1.SharedQuotaView{}))
+			}).Should(BeTrue())
+		})
+
+		It("stops counting a namespace that is relabelled", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "300m"))).To(Succeed())
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("2"))
+
+			By("removing the label of the second namespace")
+			namespace := &corev1.Namespace{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: namespaces[1]}, namespace)).To(Succeed())
+			namespace.Labels["team"] = "other-" + team
+			Expect(k8sClient.Update(ctx, namespace)).To(Succeed())
+
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("1"))
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourceRequestsCPU)).Should(Equal("200m"))
+			Eventually(namespacesOf(sharedQuota.Name)).Should(ConsistOf(namespaces[0]))
+
+			By("admitting pods in the relabelled namespace regardless of the quota")
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "2"))).To(Succeed())
+		})
+
+		It("removes the resources dropped from the quota from the status", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Eventually(usedOf(sharedQuota.Name, namespaces[0], corev1.ResourceRequestsCPU)).Should(Equal("200m"))
+
+			By("dropping the cpu from the hard limits")
+			Eventually(func() error {
+				current := &quotav1.SharedQuota{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current); err != nil {
+					return err
+				}
+				delete(current.Spec.Quota.Hard, corev1.ResourceRequestsCPU)
+				return k8sClient.Update(ctx, current)
+			}).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				current := &quotav1.SharedQuota{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current)).To(Succeed())
+				g.Expect(current.Status.Total.Hard).NotTo(HaveKey(corev1.ResourceRequestsCPU))
+				g.Expect(current.Status.Total.Used).NotTo(HaveKey(corev1.ResourceRequestsCPU))
+			}).Should(Succeed())
+			Eventually(usedOf(sharedQuota.Name, namespaces[0], corev1.ResourceRequestsCPU)).Should(Equal("0"))
+		})
+
+		It("hands the status written by updates over to server-side apply", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourceRequestsCPU)).Should(Equal("200m"))
+
+			By("writing a resource the controller does not apply with an update, as earlier versions did")
+			dropped := corev1.ResourceName("count/dropped")
+			Eventually(func() error {
+				current := &quotav1.SharedQuota{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current); err != nil {
+					return err
+				}
+				current.Status.Total.Hard[dropped] = resource.MustParse("1")
+				current.Status.Total.Used[dropped] = resource.MustParse("1")
+				return k8sClient.Status().Update(ctx, current, client.FieldOwner("sharedquota-update"))
+			}).Should(Succeed())
+
+			By("syncing the quota")
+			Expect(k8sClient.Create(ctx, newPod(namespaces[1], "100m"))).To(Succeed())
+			Eventually(func(g Gomega) {
+				current := &quotav1.SharedQuota{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current)).To(Succeed())
+				g.Expect(current.Status.Total.Hard).NotTo(HaveKey(dropped))
+				g.Expect(current.Status.Total.Used).NotTo(HaveKey(dropped))
+				used := current.Status.Total.Used[corev1.ResourceRequestsCPU]
+				g.Expect(used.String()).To(Equal("300m"))
+				for _, entry := range current.ManagedFields {
+					if entry.Subresource == "status" {
+						g.Expect(entry.Operation).To(Equal(metav1.ManagedFieldsOperationApply), "manager %s", entry.Manager)
+					}
+				}
+			}).Should(Succeed())
+		})
+
+		It("blocks the deletion of a quota in use until it is forced", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "200m"))).To(Succeed())
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("1"))
+			Eventually(func() error {
+				current := &quotav1.SharedQuota{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current); err != nil {
+					return err
+				}
+				current.Spec.DeletionPolicy = quotav1.DeletionBlock
+				return k8sClient.Update(ctx, current)
+			}).Should(Succeed())
+
+			Expect(k8sClient.Delete(ctx, sharedQuota)).To(Succeed())
+			Consistently(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), &quotav1.SharedQuota{})
+			}, "2s").Should(Succeed())
+
+			By("still enforcing the quota while its deletion is blocked")
+			err := k8sClient.Create(ctx, newPod(namespaces[1], "900m"))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+
+			By("forcing the deletion")
+			Eventually(func() error {
+				current := &quotav1.SharedQuota{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current); err != nil {
+					return err
+				}
+				if current.Annotations == nil {
+					current.Annotations = map[string]string{}
+				}
+				current.Annotations[quotav1.ForceDeleteAnnotation] = "true"
+				return k8sClient.Update(ctx, current)
+			}).Should(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), &quotav1.SharedQuota{})
+				return apierrors.IsNotFound(err)
+			}).Should(BeTrue())
+			Eventually(namespacesOf(sharedQuota.Name)).Should(BeEmpty())
+		})
+
+		It("rejects the requests of the selected namespaces while the namespace selector is invalid", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "100m"))).To(Succeed())
+
+			Eventually(func() error {
+				current := &quotav1.SharedQuota{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current); err != nil {
+					return err
+				}
+				if current.Annotations == nil {
+					current.Annotations = map[string]string{}
+				}
+				current.Annotations[quotav1.NamespaceSelectorAnnotation] = "{"
+				return k8sClient.Update(ctx, current)
+			}).Should(Succeed())
+			Eventually(func(g Gomega) {
+				current := &quotav1.SharedQuota{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current)).To(Succeed())
+				condition := meta.FindStatusCondition(current.Status.Conditions, quotav1.ConditionUsageCalculated)
+				g.Expect(condition).NotTo(BeNil())
+				g.Expect(condition.Reason).To(Equal(quotav1.ReasonInvalidNamespaceSelector))
+			}).Should(Succeed())
+
+			Eventually(func() bool {
+				return apierrors.IsForbidden(k8sClient.Create(ctx, newPod(namespaces[1], "100m")))
+			}).Should(BeTrue())
+		})
+
+		It("stops enforcing a deleted quota", func() {
+			Expect(k8sClient.Create(ctx, newPod(namespaces[0], "1"))).To(Succeed())
+			err := k8sClient.Create(ctx, newPod(namespaces[1], "100m"))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+
+			Expect(k8sClient.Delete(ctx, sharedQuota)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Create(ctx, newPod(namespaces[1], "100m"))
+			}).Should(Succeed())
+		})
+
+		It("admits exactly the pods that fit when created concurrently", func() {
+			const attempts = 12
+			var (
+				wg       sync.WaitGroup
+				lock     sync.Mutex
+				admitted int
+				errs     []error
+			)
+			for i := 0; i < attempts; i++ {
+				wg.Add(1)
+				go func(namespace string) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					err := k8sClient.Create(ctx, newPod(namespace, "100m"))
+					lock.Lock()
+					defer lock.Unlock()
+					if err == nil {
+						admitted++
+					} else if !apierrors.IsForbidden(err) {
+						errs = append(errs, err)
+					}
+				}(namespaces[i%len(namespaces)])
+			}
+			wg.Wait()
+			Expect(errs).To(BeEmpty())
+			Expect(admitted).To(Equal(3))
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourcePods)).Should(Equal("3"))
+			Consistently(usedOf(sharedQuota.Name, "", corev1.ResourcePods), testResyncPeriod*2).Should(Equal("3"))
+		})
+	})
+
+	Context("admitting claims and services", func() {
+		var namespace string
+
+		BeforeEach(func() {
+			namespace = createNamespace(team)
+			sharedQuota = createSharedQuota(team, corev1.ResourceList{
+				corev1.ResourcePersistentVolumeClaims: resource.MustParse("2"),
+				corev1.ResourceRequestsStorage:        resource.MustParse("10Gi"),
+				corev1.ResourceServices:               resource.MustParse("1"),
+			})
+		})
+
+		It("denies claims exceeding the storage quota", func() {
+			Expect(k8sClient.Create(ctx, newClaim(namespace, "8Gi"))).To(Succeed())
+			err := k8sClient.Create(ctx, newClaim(namespace, "4Gi"))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+			Expect(k8sClient.Create(ctx, newClaim(namespace, "2Gi"))).To(Succeed())
+
+			Eventually(usedOf(sharedQuota.Name, namespace, corev1.ResourceRequestsStorage)).Should(Equal("10Gi"))
+			Eventually(usedOf(sharedQuota.Name, namespace, corev1.ResourcePersistentVolumeClaims)).Should(Equal("2"))
+		})
+
+		It("denies services exceeding the quota", func() {
+			Expect(k8sClient.Create(ctx, newService(namespace))).To(Succeed())
+			err := k8sClient.Create(ctx, newService(namespace))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+
+			Eventually(usedOf(sharedQuota.Name, "", corev1.ResourceServices)).Should(Equal("1"))
+		})
+	})
+
+	Context("serving v1beta2", func() {
+		It("enforces quotas selecting namespaces by set-based selectors", func() {
+			namespace := createNamespace(team)
+			other := createNamespace("other-" + team)
+			hard := corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}
+			v1beta2Quota := &quotav1beta2.SharedQuota{
+				ObjectMeta: metav1.ObjectMeta{Name: team},
+				Spec: quotav1beta2.SharedQuotaSpec{
+					NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+						Key:      "team",
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   []string{team, "other-" + team},
+					}}},
+					Quota: corev1.ResourceQuotaSpec{Hard: hard},
+				},
+			}
+			Expect(k8sClient.Create(ctx, v1beta2Quota)).To(Succeed())
+			sharedQuota = &quotav1.SharedQuota{ObjectMeta: metav1.ObjectMeta{Name: team}}
+
+			By("reading the quota through v1")
+			Eventually(namespacesOf(team)).Should(ConsistOf(namespace, other))
+			Expect(k8sClient.Create(ctx, newPod(namespace, "100m"))).To(Succeed())
+			err := k8sClient.Create(ctx, newPod(other, "100m"))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "expected a denial, got %v", err)
+
+			By("reading the status through v1beta2")
+			Eventually(func(g Gomega) {
+				current := &quotav1beta2.SharedQuota{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKey{Name: team}, current)).To(Succeed())
+				g.Expect(current.Spec.NamespaceSelector).To(Equal(v1beta2Quota.Spec.NamespaceSelector))
+				g.Expect(current.Status.NamespaceCount).To(BeEquivalentTo(2))
+				used := current.Status.Total.Used[corev1.ResourcePods]
+				g.Expect(used.String()).To(Equal("1"))
+			}).Should(Succeed())
+		})
+	})
+})
+
+// createNamespace creates a namespace selected by the shared quotas of team and returns its name.
+func createNamespace(team string) string {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: team + "-",
+			Labels:       map[string]string{"team": team},
+		},
+	}
+	Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+	return namespace.Name
+}
+
+// createSharedQuota creates a shared quota selecting the namespaces of team, and waits until the controller
+// enforces it.
+func createSharedQuota(team string, hard corev1.ResourceList) *quotav1.SharedQuota {
+	sharedQuota := &quotav1.SharedQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: team},
+		Spec: quotav1.SharedQuotaSpec{
+			LabelSelector: map[string]string{"team": team},
+			Quota:         corev1.ResourceQuotaSpec{Hard: hard},
+		},
+	}
+	Expect(k8sClient.Create(ctx, sharedQuota)).To(Succeed())
+	Eventually(func(g Gomega) {
+		current := &quotav1.SharedQuota{}
+		g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sharedQuota), current)).To(Succeed())
+		g.Expect(quotapkg.Equals(current.Status.Total.Hard, hard)).To(BeTrue())
+	}).Should(Succeed())
+	return sharedQuota
+}
+
+// usedOf returns a function reporting the usage of a resource by a shared quota, in total if namespace is empty.
+func usedOf(name, namespace string, resourceName corev1.ResourceName) func() (string, error) {
+	return func() (string, error) {
+		sharedQuota := &quotav1.SharedQuota{}
+		if err := k8sClient.Get(ctx, client.ObjectKey{Name: name}, sharedQuota); err != nil {
+			return "", err
+		}
+		used := sharedQuota.Status.Total.Used
+		if len(namespace) > 0 {
+			usage := &quotav1.SharedQuotaUsage{}
+			if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, usage); err != nil {
+				return "", err
+			}
+			used = usage.Status.Used
+		}
+		quantity := used[resourceName]
+		return quantity.String(), nil
+	}
+}
+
+// namespacesOf returns a function reporting the namespaces whose usage of a shared quota is recorded.
+func namespacesOf(name string) func() ([]string, error) {
+	return func() ([]string, error) {
+		usages := &quotav1.SharedQuotaUsageList{}
+		if err := k8sClient.List(ctx, usages, client.MatchingLabels{quotav1.SharedQuotaLabel: name}); err != nil {
+			return nil, err
+		}
+		var namespaces []string
+		for _, usage := range usages.Items {
+			namespaces = append(namespaces, usage.Namespace)
+		}
+		return namespaces, nil
+	}
+}
+
+func newPod(namespace, cpu string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "pod-", Namespace: namespace},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "app",
+				Image: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+				},
+			}},
+		},
+	}
+}
+
+func newClaim(namespace, storage string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "claim-", Namespace: namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+			},
+		},
+	}
+}
+
+func newService(namespace string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "service-", Namespace: namespace},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Port: 80}},
+		},
+	}
+}
+
+// TestUpgradeManagedFields checks that the fields of the status written by updates are handed over to the apply
+// patches of the controller, and that the fields of the spec are left to their managers.
+func TestUpgradeManagedFields(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = quotav1.AddToScheme(testScheme)
+
+	managedFields := []metav1.ManagedFieldsEntry{
+		{
+			Manager:    "kubectl",
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: "quota.caih.com/v1",
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:quota":{"f:hard":{"f:pods":{}}}}}`)},
+		},
+		{
+			Manager:     "sharedquota-update",
+			Operation:   metav1.ManagedFieldsOperationUpdate,
+			APIVersion:  "quota.caih.com/v1",
+			FieldsType:  "FieldsV1",
+			FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:total":{"f:used":{"f:count/dropped":{}}}}}`)},
+			Subresource: "status",
+		},
+		{
+			Manager:     controllerName,
+			Operation:   metav1.ManagedFieldsOperationApply,
+			APIVersion:  "quota.caih.com/v1",
+			FieldsType:  "FieldsV1",
+			FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:total":{"f:used":{"f:pods":{}}}}}`)},
+			Subresource: "status",
+		},
+	}
+	sharedQuota := &quotav1.SharedQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", ManagedFields: managedFields},
+		Spec: quotav1.SharedQuotaSpec{
+			Quota: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}},
+		},
+	}
+	c := clientfake.NewClientBuilder().WithScheme(testScheme).WithObjects(sharedQuota).Build()
+	r := &SharedQuotaReconciler{Client: c}
+
+	current := &quotav1.SharedQuota{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(sharedQuota), current); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.upgradeManagedFields(context.Background(), current, "status"); err != nil {
+		t.Fatal(err)
+	}
+	upgraded := &quotav1.SharedQuota{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(sharedQuota), upgraded); err != nil {
+		t.Fatal(err)
+	}
+	managers := map[string]metav1.ManagedFieldsEntry{}
+	for _, entry := range upgraded.ManagedFields {
+		managers[entry.Manager+"/"+entry.Subresource] = entry
+	}
+	if _, found := managers["sharedquota-update/status"]; found {
+		t.Errorf("expected the update manager of the status to be removed, got %v", upgraded.ManagedFields)
+	}
+	if _, found := managers["kubectl/"]; !found {
+		t.Errorf("expected the update manager of the spec to be kept, got %v", upgraded.ManagedFields)
+	}
+	applied, found := managers[controllerName+"/status"]
+	if !found || applied.Operation != metav1.ManagedFieldsOperationApply {
+		t.Fatalf("expected the status to be applied by %s, got %v", controllerName, upgraded.ManagedFields)
+	}
+	for _, field := range []string{`"f:pods"`, `"f:count/dropped"`} {
+		if !strings.Contains(string(applied.FieldsV1.Raw), field) {
+			t.Errorf("expected %s to own %s, got %s", controllerName, field, applied.FieldsV1.Raw)
+		}
+	}
+
+	// an upgraded object is left as is
+	if err := r.upgradeManagedFields(context.Background(), upgraded, "status"); err != nil {
+		t.Fatal(err)
+	}
+	again := &quotav1.SharedQuota{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(sharedQuota), again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ResourceVersion != upgraded.ResourceVersion {
+		t.Errorf("expected no patch once upgraded, resource version %s became %s", upgraded.ResourceVersion, again.ResourceVersion)
+	}
+}
+
+// TestHasReservations checks that the ledgers are listed with the given context, and that created objects are still
+// queued when the ledgers cannot be listed.
+func TestHasReservations(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = quotav1.AddToScheme(testScheme)
+
+	ledger := &quotav1.SharedQuotaLedger{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "reserved"},
+		Spec:       quotav1.SharedQuotaLedgerSpec{Reservations: []quotav1.Reservation{{}}},
+	}
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "manager")
+	var listErr error
+	c := clientfake.NewClientBuilder().WithScheme(testScheme).WithObjects(ledger).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(listCtx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if listCtx.Value(ctxKey{}) != "manager" {
+					t.Errorf("expected the ledgers to be listed with the context of the manager")
+				}
+				if listErr != nil {
+					return listErr
+				}
+				return c.List(listCtx, list, opts...)
+			},
+		}).
+		Build()
+	r := &SharedQuotaReconciler{Client: c}
+
+	if !r.hasReservations(ctx, "reserved") {
+		t.Errorf("expected the reservations of the namespace to be found")
+	}
+	if r.hasReservations(ctx, "other") {
+		t.Errorf("expected no reservation in a namespace without ledger")
+	}
+	listErr = apierrors.NewServiceUnavailable("unavailable")
+	if !r.hasReservations(ctx, "other") {
+		t.Errorf("expected created objects to be queued when the ledgers cannot be listed")
+	}
+}
+
+func TestNamespaceStatuses(t *testing.T) {
+	if statuses := namespaceStatuses(nil); statuses != nil {
+		t.Errorf("expected no status without namespaces, got %v", statuses)
+	}
+	statuses := namespaceStatuses(map[string]corev1.ResourceList{
+		"b": {corev1.ResourcePods: resource.MustParse("2")},
+		"a": {corev1.ResourcePods: resource.MustParse("1")},
+		"c": nil,
+	})
+	if len(statuses) != 3 || statuses[0].Namespace != "a" || statuses[1].Namespace != "b" || statuses[2].Namespace != "c" {
+		t.Fatalf("expected the statuses sorted by namespace, got %v", statuses)
+	}
+	if used := statuses[1].Used[corev1.ResourcePods]; used.String() != "2" {
+		t.Errorf("expected the usage of the namespace, got %v", statuses[1].Used)
+	}
+}
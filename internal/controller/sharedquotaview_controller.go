@@ -0,0 +1,188 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quotav1 "caih.com/api/v1"
+	quotapkg "caih.com/pkg/quota"
+)
+
+const viewControllerName = "sharedquotaview"
+
+var _ reconcile.Reconciler = &SharedQuotaViewReconciler{}
+
+// SharedQuotaViewReconciler maintains the SharedQuotaView of every namespace selected by a SharedQuota.
+type SharedQuotaViewReconciler struct {
+	client.Client
+	logger                  logr.Logger
+	MaxConcurrentReconciles int
+	// MappingCache maps namespaces to the quotas selecting them, created from the manager's cache if not set
+	MappingCache *quotapkg.QuotaMappingCache
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SharedQuotaViewReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.logger = ctrl.Log.WithName("controllers").WithName(viewControllerName)
+	if r.MaxConcurrentReconciles <= 0 {
+		r.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
+	}
+	if r.MappingCache == nil {
+		mappingCache, err := quotapkg.NewQuotaMappingCache(context.Background(), mgr.GetCache())
+		if err != nil {
+			return err
+		}
+		r.MappingCache = mappingCache
+	}
+	// the usages of a quota are created and deleted with the namespaces it selects, its status is updated on every
+	// sync but only the hard limits, the usage and the scopes are shown
+	quotaPredicate := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldQuota := e.ObjectOld.(*quotav1.SharedQuota)
+			newQuota := e.ObjectNew.(*quotav1.SharedQuota)
+			return !equality.Semantic.DeepEqual(oldQuota.Status.Total, newQuota.Status.Total) ||
+				!equality.Semantic.DeepEqual(oldQuota.Spec.Quota.Scopes, newQuota.Spec.Quota.Scopes) ||
+				!equality.Semantic.DeepEqual(oldQuota.Spec.Quota.ScopeSelector, newQuota.Spec.Quota.ScopeSelector)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&quotav1.SharedQuotaView{}).
+		Watches(&quotav1.SharedQuota{}, handler.EnqueueRequestsFromMapFunc(r.mapQuota), builder.WithPredicates(quotaPredicate)).
+		Watches(&quotav1.SharedQuotaUsage{}, handler.EnqueueRequestsFromMapFunc(r.mapUsage)).
+		Named(viewControllerName).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
+		Complete(r)
+}
+
+// mapQuota returns the views of the namespaces selected by the quota.
+func (r *SharedQuotaViewReconciler) mapQuota(ctx context.Context, obj client.Object) []reconcile.Request {
+	var result []reconcile.Request
+	for _, namespace := range r.MappingCache.NamespacesFor(obj.GetName()) {
+		result = append(result, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: quotav1.SharedQuotaViewName}})
+	}
+	return result
+}
+
+// mapUsage returns the view of the namespace of the usage.
+func (r *SharedQuotaViewReconciler) mapUsage(ctx context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: quotav1.SharedQuotaViewName}}}
+}
+
+// +kubebuilder:rbac:groups=quota.caih.com,resources=sharedquotaviews,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile lists the quotas selecting the namespace of the request, with their usage in the namespace, in its
+// SharedQuotaView.  The view is deleted once no quota selects the namespace.
+func (r *SharedQuotaViewReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Name != quotav1.SharedQuotaViewName {
+		return ctrl.Result{}, nil
+	}
+	logger := r.logger.WithValues("namespace", req.Namespace)
+	// an unsynced mapping cache does not know the namespace
+	if !r.MappingCache.HasSynced() {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+	quotas, err := r.appliedQuotas(ctx, req.Namespace)
+	if err != nil {
+		logger.Error(err, "failed to list quotas of namespace")
+		return ctrl.Result{}, err
+	}
+
+	view := &quotav1.SharedQuotaView{}
+	if err := r.Get(ctx, req.NamespacedName, view); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		view = nil
+	}
+	if len(quotas) == 0 {
+		if view == nil {
+			return ctrl.Result{}, nil
+		}
+		klog.V(6).Infof("delete shared quota view: %s", req.Namespace)
+		return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, view))
+	}
+	if view != nil && equality.Semantic.DeepEqual(view.Status.Quotas, quotas) {
+		return ctrl.Result{}, nil
+	}
+
+	applied := &quotav1.SharedQuotaView{
+		TypeMeta:   metav1.TypeMeta{APIVersion: quotav1.GroupVersion.String(), Kind: "SharedQuotaView"},
+		ObjectMeta: metav1.ObjectMeta{Name: quotav1.SharedQuotaViewName, Namespace: req.Namespace},
+		Status:     quotav1.SharedQuotaViewStatus{Quotas: quotas},
+	}
+	klog.V(6).Infof("apply shared quota view: %+v", applied)
+	if err := r.Patch(ctx, applied, client.Apply, client.FieldOwner(viewControllerName), client.ForceOwnership); err != nil {
+		logger.Error(err, "failed to apply shared quota view")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// appliedQuotas returns the quotas selecting the namespace sorted by name, or none if the namespace was deleted.
+func (r *SharedQuotaViewReconciler) appliedQuotas(ctx context.Context, namespace string) ([]quotav1.AppliedSharedQuota, error) {
+	names, err := r.MappingCache.ResourceQuotaNamesFor(namespace)
+	if err != nil {
+		// the view is deleted with its namespace
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var quotas []quotav1.AppliedSharedQuota
+	for _, name := range names {
+		quota := &quotav1.SharedQuota{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name}, quota); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		// the usage in a namespace newly selected is not calculated yet
+		usage := &quotav1.SharedQuotaUsage{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, usage); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		quotas = append(quotas, quotav1.AppliedSharedQuota{
+			Name:          name,
+			Scopes:        quota.Spec.Quota.Scopes,
+			ScopeSelector: quota.Spec.Quota.ScopeSelector,
+			Hard:          quota.Status.Total.Hard,
+			Used:          quota.Status.Total.Used,
+			NamespaceUsed: usage.Status.Used,
+		})
+	}
+	return quotas, nil
+}
@@ -18,24 +18,38 @@ package controller
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	quotav1 "caih.com/api/v1"
+	quotav1beta2 "caih.com/api/v1beta2"
+	webhookv1 "caih.com/internal/webhook/v1"
+	"caih.com/pkg/quota"
 	// +kubebuilder:scaffold:imports
 )
 
+// testResyncPeriod makes the controller observe namespace relabelling quickly, namespaces are only matched again
+// on the full recalculation of a quota.
+const testResyncPeriod = 2 * time.Second
+
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
 // http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
 
@@ -48,6 +62,13 @@ var (
 )
 
 func TestControllers(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" && getFirstFoundEnvTestBinaryDir() == "" {
+		// make test provisions the binaries, the suite must not pass without running there
+		if os.Getenv("ENVTEST_REQUIRED") == "true" {
+			t.Fatal("envtest binaries not found, set KUBEBUILDER_ASSETS")
+		}
+		t.Skip("envtest binaries not found, run 'make setup-envtest' or set KUBEBUILDER_ASSETS")
+	}
 	RegisterFailHandler(Fail)
 
 	RunSpecs(t, "Controller Suite")
@@ -56,11 +77,18 @@ func TestControllers(t *testing.T) {
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
+	binaryAssetsDirectory := getFirstFoundEnvTestBinaryDir()
+
 	ctx, cancel = context.WithCancel(context.TODO())
+	SetDefaultEventuallyTimeout(30 * time.Second)
+	SetDefaultEventuallyPollingInterval(250 * time.Millisecond)
 
 	var err error
 	err = quotav1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	// envtest points the conversion webhook of the CRDs of convertible types at the test manager
+	err = quotav1beta2.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:scheme
 
@@ -68,11 +96,15 @@ var _ = BeforeSuite(func() {
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: true,
+		// the webhook configuration of the deployment, pointed at the webhook server of the test manager
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			Paths: []string{filepath.Join("..", "..", "deploy", "4.webhook.yaml")},
+		},
 	}
 
 	// Retrieve the first found binary directory to allow running tests from IDEs
-	if getFirstFoundEnvTestBinaryDir() != "" {
-		testEnv.BinaryAssetsDirectory = getFirstFoundEnvTestBinaryDir()
+	if binaryAssetsDirectory != "" {
+		testEnv.BinaryAssetsDirectory = binaryAssetsDirectory
 	}
 
 	// cfg is defined in this file globally.
@@ -83,9 +115,62 @@ var _ = BeforeSuite(func() {
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
+
+	By("starting the manager with the controller and the webhook server")
+	webhookInstallOptions := &testEnv.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:  scheme.Scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host:    webhookInstallOptions.LocalServingHost,
+			Port:    webhookInstallOptions.LocalServingPort,
+			CertDir: webhookInstallOptions.LocalServingCertDir,
+		}),
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	mappingCache, err := quota.NewQuotaMappingCache(ctx, mgr.GetCache())
+	Expect(err).NotTo(HaveOccurred())
+	err = (&SharedQuotaReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		MappingCache: mappingCache,
+		ResyncPeriod: testResyncPeriod,
+	}).SetupWithManager(ctx, mgr)
+	Expect(err).NotTo(HaveOccurred())
+	err = (&SharedQuotaViewReconciler{
+		Client:       mgr.GetClient(),
+		MappingCache: mappingCache,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = webhookv1.SetupWithManager(mgr, webhookv1.Options{
+		MappingCache: mappingCache,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(webhookv1.SetupConversionWebhookWithManager(mgr)).To(Succeed())
+
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
+
+	// wait for the webhook server, admissions fail until it serves
+	dialer := &net.Dialer{Timeout: time.Second}
+	addrPort := fmt.Sprintf("%s:%d", webhookInstallOptions.LocalServingHost, webhookInstallOptions.LocalServingPort)
+	Eventually(func() error {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addrPort, &tls.Config{InsecureSkipVerify: true}) // nolint:gosec
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}).Should(Succeed())
+	Eventually(mappingCache.HasSynced).Should(BeTrue())
 })
 
 var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
 	By("tearing down the test environment")
 	cancel()
 	err := testEnv.Stop()
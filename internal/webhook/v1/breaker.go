@@ -0,0 +1,98 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+const (
+	// DefaultCircuitBreakerThreshold is the number of consecutive evaluation errors that open the circuit breaker.
+	DefaultCircuitBreakerThreshold = 5
+	// DefaultCircuitBreakerOpenDuration is how long the circuit breaker stays open.
+	DefaultCircuitBreakerOpenDuration = 30 * time.Second
+)
+
+// circuitBreaker stops evaluating admissions after consecutive backend errors, so that a slow or unreachable
+// apiserver does not make every admission wait for its evaluation timeout.  Once open for openDuration, a single
+// admission is evaluated again, which closes the breaker if it succeeds and opens it again otherwise.
+type circuitBreaker struct {
+	clock clock.PassiveClock
+
+	lock      sync.Mutex
+	threshold int
+	duration  time.Duration
+	// failures is the number of consecutive errors
+	failures int
+	// openUntil is when the next admission is evaluated again, zero if the breaker is closed
+	openUntil time.Time
+	// probing is set while an admission is evaluated to decide whether to close the breaker
+	probing bool
+}
+
+func newCircuitBreaker(clock clock.PassiveClock, threshold int, duration time.Duration) *circuitBreaker {
+	return &circuitBreaker{clock: clock, threshold: threshold, duration: duration}
+}
+
+// Set updates the threshold and the open duration, it applies to the next error.
+func (b *circuitBreaker) Set(threshold int, duration time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.threshold = threshold
+	b.duration = duration
+}
+
+// Allow returns true if the admission must be evaluated.
+func (b *circuitBreaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || b.clock.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Success records a successful evaluation and closes the breaker.
+func (b *circuitBreaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures = 0
+	b.probing = false
+	if !b.openUntil.IsZero() {
+		b.openUntil = time.Time{}
+		circuitOpen.Set(0)
+	}
+}
+
+// Failure records a backend error and opens the breaker once the threshold is reached.
+func (b *circuitBreaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.probing = false
+		b.openUntil = b.clock.Now().Add(b.duration)
+		circuitOpen.Set(1)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	b := newCircuitBreaker(fakeClock, 3, 30*time.Second)
+	steps := []struct {
+		name    string
+		advance time.Duration
+		// expectAllow is whether the admission of the step is evaluated
+		expectAllow bool
+		// record records the result of an evaluation, after the admission of the step
+		record func()
+		// expectOpen is whether the breaker is open after the step
+		expectOpen bool
+	}{
+		{name: "first error", expectAllow: true, record: b.Failure},
+		{name: "error below threshold", expectAllow: true, record: b.Failure},
+		{name: "success resets the errors", expectAllow: true, record: b.Success},
+		{name: "first error after success", expectAllow: true, record: b.Failure},
+		{name: "second error after success", expectAllow: true, record: b.Failure},
+		{name: "threshold reached", expectAllow: true, record: b.Failure, expectOpen: true},
+		{name: "open", expectOpen: true},
+		{name: "still open", advance: 29 * time.Second, expectOpen: true},
+		{name: "probe", advance: time.Second, expectAllow: true, expectOpen: true},
+		{name: "probe fails while another admission waits", record: b.Failure, expectOpen: true},
+		{name: "reopened", advance: 29 * time.Second, expectOpen: true},
+		{name: "second probe", advance: time.Second, expectAllow: true, expectOpen: true},
+		{name: "probe succeeds while another admission waits", record: b.Success},
+		{name: "closed", expectAllow: true, record: b.Failure},
+		{name: "error below threshold after closing", expectAllow: true},
+	}
+	for _, step := range steps {
+		fakeClock.Step(step.advance)
+		if allowed := b.Allow(); allowed != step.expectAllow {
+			t.Fatalf("%s: expected allow %t, got %t", step.name, step.expectAllow, allowed)
+		}
+		if step.record != nil {
+			step.record()
+		}
+		if open := testutil.ToFloat64(circuitOpen) == 1; open != step.expectOpen {
+			t.Fatalf("%s: expected open %t, got %t", step.name, step.expectOpen, open)
+		}
+	}
+}
+
+func TestCircuitBreakerSet(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	b := newCircuitBreaker(fakeClock, 3, 30*time.Second)
+	b.Set(1, time.Minute)
+	b.Failure()
+	if b.Allow() {
+		t.Fatalf("expected the breaker to open at the new threshold")
+	}
+	fakeClock.Step(59 * time.Second)
+	if b.Allow() {
+		t.Fatalf("expected the breaker to stay open for the new duration")
+	}
+	fakeClock.Step(time.Second)
+	if !b.Allow() {
+		t.Fatalf("expected a probe after the new duration")
+	}
+	b.Success()
+}
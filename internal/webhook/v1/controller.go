@@ -17,10 +17,12 @@ limitations under the License.
 package v1
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -36,21 +38,27 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	quotav1 "caih.com/api/v1"
 	"caih.com/pkg/quota"
 	"caih.com/pkg/quota/generic"
 )
 
+// DefaultEvaluationTimeout is how long an admission waits for its evaluation by default.
+const DefaultEvaluationTimeout = 10 * time.Second
+
 // Evaluator is used to see if quota constraints are satisfied.
 type Evaluator interface {
 	// Evaluate takes an operation and checks to see if quota constraints are satisfied.  It returns an error if they are not.
-	// The default implementation process related operations in chunks when possible.
-	Evaluate(a admission.Attributes) error
+	// The default implementation process related operations in chunks when possible.  No usage is committed for the
+	// operation once ctx is done.
+	Evaluate(ctx context.Context, a admission.Attributes) error
 }
 
 type quotaEvaluator struct {
 	quotaAccessor QuotaAccessor
-	// lockAcquisitionFunc acquires any required locks and returns a cleanup method to defer
-	lockAcquisitionFunc func([]corev1.ResourceQuota) func()
+	// lockAcquisitionFunc acquires any required locks unless the context is done first, and returns a cleanup method
+	// to defer and a context that is cancelled once a lock is lost
+	lockAcquisitionFunc LockAcquisitionFunc
 
 	ignoredResources map[schema.GroupResource]struct{}
 
@@ -67,6 +75,9 @@ type quotaEvaluator struct {
 	dirtyWork  map[string][]*admissionWaiter
 	inProgress sets.Set[string]
 
+	// timeout bounds the wait of an admission for its evaluation, in nanoseconds
+	timeout atomic.Int64
+
 	// controls the run method so that we can cleanly conform to the Evaluator interface
 	workers int
 	stopCh  <-chan struct{}
@@ -76,7 +87,13 @@ type quotaEvaluator struct {
 	config *resourcequotaapi.Configuration
 }
 
+// LockAcquisitionFunc locks the quotas unless ctx is done first.  It returns a context derived from ctx that is
+// cancelled once one of the locks is lost, and a function releasing the locks.
+type LockAcquisitionFunc func(ctx context.Context, quotas []corev1.ResourceQuota) (context.Context, func(), error)
+
 type admissionWaiter struct {
+	// ctx is done once the request is abandoned
+	ctx        context.Context
 	attributes admission.Attributes
 	finished   chan struct{}
 	result     error
@@ -98,8 +115,9 @@ func IsDefaultDeny(err error) bool {
 	return ok
 }
 
-func newAdmissionWaiter(a admission.Attributes) *admissionWaiter {
+func newAdmissionWaiter(ctx context.Context, a admission.Attributes) *admissionWaiter {
 	return &admissionWaiter{
+		ctx:        ctx,
 		attributes: a,
 		finished:   make(chan struct{}),
 		result:     defaultDeny{},
@@ -109,13 +127,13 @@ func newAdmissionWaiter(a admission.Attributes) *admissionWaiter {
 // NewQuotaEvaluator configures an admission controller that can enforce quota constraints
 // using the provided registry.  The registry must have the capability to handle group/kinds that
 // are persisted by the server this admission controller is intercepting
-func NewQuotaEvaluator(quotaAccessor QuotaAccessor, ignoredResources map[schema.GroupResource]struct{}, quotaRegistry quota.Registry, lockAcquisitionFunc func([]corev1.ResourceQuota) func(), config *resourcequotaapi.Configuration, workers int, stopCh <-chan struct{}) Evaluator {
+func NewQuotaEvaluator(quotaAccessor QuotaAccessor, ignoredResources map[schema.GroupResource]struct{}, quotaRegistry quota.Registry, lockAcquisitionFunc LockAcquisitionFunc, config *resourcequotaapi.Configuration, workers int, stopCh <-chan struct{}) Evaluator {
 	// if we get a nil config, just create an empty default.
 	if config == nil {
 		config = &resourcequotaapi.Configuration{}
 	}
 
-	return &quotaEvaluator{
+	e := &quotaEvaluator{
 		quotaAccessor:       quotaAccessor,
 		lockAcquisitionFunc: lockAcquisitionFunc,
 
@@ -131,6 +149,13 @@ func NewQuotaEvaluator(quotaAccessor QuotaAccessor, ignoredResources map[schema.
 		stopCh:  stopCh,
 		config:  config,
 	}
+	e.SetTimeout(DefaultEvaluationTimeout)
+	return e
+}
+
+// SetTimeout sets how long an admission waits for its evaluation.
+func (e *quotaEvaluator) SetTimeout(timeout time.Duration) {
+	e.timeout.Store(int64(timeout))
 }
 
 // Run begins watching and syncing.
@@ -168,15 +193,31 @@ func (e *quotaEvaluator) doWork() {
 
 // checkAttributes iterates evaluates all the waiting admissionAttributes.  It will always notify all waiters
 // before returning.  The default is to deny.
-func (e *quotaEvaluator) checkAttributes(ns string, admissionAttributes []*admissionWaiter) {
+func (e *quotaEvaluator) checkAttributes(ns string, allAdmissionAttributes []*admissionWaiter) {
 	// notify all on exit
 	defer func() {
-		for _, admissionAttribute := range admissionAttributes {
+		for _, admissionAttribute := range allAdmissionAttributes {
 			close(admissionAttribute.finished)
 		}
 	}()
 
-	quotas, err := e.quotaAccessor.GetQuotas(ns)
+	// requests abandoned while they were queued are not evaluated
+	var admissionAttributes []*admissionWaiter
+	for _, admissionAttribute := range allAdmissionAttributes {
+		if err := admissionAttribute.ctx.Err(); err != nil {
+			admissionAttribute.result = err
+			continue
+		}
+		admissionAttributes = append(admissionAttributes, admissionAttribute)
+	}
+	if len(admissionAttributes) == 0 {
+		return
+	}
+	// the lookups are only abandoned with the last request
+	ctx, cancel := batchContext(admissionAttributes)
+	defer cancel()
+
+	quotas, err := e.quotaAccessor.GetQuotas(ctx, ns)
 	if err != nil {
 		for _, admissionAttribute := range admissionAttributes {
 			admissionAttribute.result = err
@@ -193,11 +234,19 @@ func (e *quotaEvaluator) checkAttributes(ns string, admissionAttributes []*admis
 	}
 
 	if e.lockAcquisitionFunc != nil {
-		releaseLocks := e.lockAcquisitionFunc(quotas)
+		lockCtx, releaseLocks, err := e.lockAcquisitionFunc(ctx, quotas)
+		if err != nil {
+			for _, admissionAttribute := range admissionAttributes {
+				admissionAttribute.result = err
+			}
+			return
+		}
 		defer releaseLocks()
+		// the quotas are not updated once a lock is lost
+		ctx = lockCtx
 	}
 
-	e.checkQuotas(quotas, admissionAttributes, 3)
+	e.checkQuotas(ctx, quotas, admissionAttributes, 3)
 }
 
 // checkQuotas checks the admission attributes against the passed quotas.  If a quota applies, it will attempt to update it
@@ -212,7 +261,12 @@ func (e *quotaEvaluator) checkAttributes(ns string, admissionAttributes []*admis
 //     updates failed on conflict errors and we have retries left, re-get the failed quota from our cache for the latest version
 //     and recurse into this method with the subset.  It's safe for us to evaluate ONLY the subset, because the other quota
 //     documents for these waiters have already been evaluated.  Step 1, will mark all the ones that should already have succeeded.
-func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAttributes []*admissionWaiter, remainingRetries int) {
+//
+// Abandoned requests are skipped in step 1, and the quotas are checked again without them if they are abandoned before
+// step 3.  The updates of step 3 are cancelled as soon as one of the requests they charge is abandoned.  Usage that was
+// committed for an abandoned request by an update that raced with it, or by the updates of other quotas before, is only
+// reserved until the controller recalculates the quotas.
+func (e *quotaEvaluator) checkQuotas(ctx context.Context, quotas []corev1.ResourceQuota, admissionAttributes []*admissionWaiter, remainingRetries int) {
 	// yet another copy to compare against originals to see if we actually have deltas
 	originalQuotas, err := copyQuotas(quotas)
 	if err != nil {
@@ -221,9 +275,16 @@ func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAtt
 	}
 
 	atLeastOneChanged := false
+	// chargedAttributes holds the waiters whose usage is in the running quotas, and reservations their usage by quota
+	var chargedAttributes []*admissionWaiter
+	reservations := make([][]quotav1.Reservation, len(quotas))
 	for i := range admissionAttributes {
 		admissionAttribute := admissionAttributes[i]
-		newQuotas, err := e.checkRequest(quotas, admissionAttribute.attributes)
+		if err := admissionAttribute.ctx.Err(); err != nil {
+			admissionAttribute.result = err
+			continue
+		}
+		newQuotas, err := e.checkRequest(admissionAttribute.ctx, quotas, admissionAttribute.attributes)
 		if err != nil {
 			admissionAttribute.result = err
 			continue
@@ -239,15 +300,21 @@ func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAtt
 		// that means that no quota docs applied, so it can get a pass
 		atLeastOneChangeForThisWaiter := false
 		for j := range newQuotas {
-			if !quota.Equals(quotas[j].Status.Used, newQuotas[j].Status.Used) {
-				atLeastOneChanged = true
-				atLeastOneChangeForThisWaiter = true
-				break
+			if quota.Equals(quotas[j].Status.Used, newQuotas[j].Status.Used) {
+				continue
 			}
+			atLeastOneChanged = true
+			atLeastOneChangeForThisWaiter = true
+			reservations[j] = append(reservations[j], quotav1.Reservation{
+				Object: reservedObject(admissionAttribute.attributes),
+				Used:   quota.Subtract(newQuotas[j].Status.Used, quotas[j].Status.Used),
+			})
 		}
 
 		if !atLeastOneChangeForThisWaiter {
 			admissionAttribute.result = nil
+		} else {
+			chargedAttributes = append(chargedAttributes, admissionAttribute)
 		}
 
 		quotas = newQuotas
@@ -258,6 +325,16 @@ func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAtt
 		return
 	}
 
+	// a request abandoned while the others were checked must not be charged, check again without it
+	for _, admissionAttribute := range chargedAttributes {
+		if admissionAttribute.ctx.Err() != nil {
+			e.checkQuotas(ctx, originalQuotas, admissionAttributes, remainingRetries)
+			return
+		}
+	}
+	commitCtx, cancelCommit := commitContext(ctx, chargedAttributes)
+	defer cancelCommit()
+
 	// now go through and try to issue updates.  Things get a little weird here:
 	// 1. check to see if the quota changed.  If not, skip.
 	// 2. if the quota changed and the update passes, be happy
@@ -272,7 +349,7 @@ func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAtt
 			continue
 		}
 
-		if err := e.quotaAccessor.UpdateQuotaStatus(&newQuota); err != nil {
+		if err := e.quotaAccessor.UpdateQuotaStatus(commitCtx, &newQuota, reservations[i]); err != nil {
 			updatedFailedQuotas = append(updatedFailedQuotas, newQuota)
 			lastErr = err
 		}
@@ -303,7 +380,7 @@ func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAtt
 	// you've added a new documented, then updated an old one, your resource matches both and you're only checking one
 	// updates for these quota names failed.  Get the current quotas in the namespace, compare by name, check to see if the
 	// resource versions have changed.  If not, we're going to fall through an fail everything.  If they all have, then we can try again
-	newQuotas, err := e.quotaAccessor.GetQuotas(quotas[0].Namespace)
+	newQuotas, err := e.quotaAccessor.GetQuotas(ctx, quotas[0].Namespace)
 	if err != nil {
 		// this means that updates failed.  Anything with a default deny error has failed and we need to let them know
 		for _, admissionAttribute := range admissionAttributes {
@@ -325,7 +402,70 @@ func (e *quotaEvaluator) checkQuotas(quotas []corev1.ResourceQuota, admissionAtt
 			}
 		}
 	}
-	e.checkQuotas(quotasToCheck, admissionAttributes, remainingRetries-1)
+	e.checkQuotas(ctx, quotasToCheck, admissionAttributes, remainingRetries-1)
+}
+
+// reservedObject returns the object whose usage is reserved by the admission, nil if it has no name yet.
+func reservedObject(a admission.Attributes) *quotav1.ReservedObject {
+	object := a.GetObject()
+	if a.GetOperation() != admission.Create {
+		object = a.GetOldObject()
+	}
+	if object == nil {
+		return nil
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil || len(accessor.GetName()) == 0 {
+		return nil
+	}
+	reserved := &quotav1.ReservedObject{
+		Group:    a.GetResource().Group,
+		Resource: a.GetResource().Resource,
+		Name:     accessor.GetName(),
+	}
+	// the uid of a created object is assigned after admission
+	if a.GetOperation() != admission.Create {
+		reserved.UID = accessor.GetUID()
+		reserved.ResourceVersion = accessor.GetResourceVersion()
+		reserved.Deleted = a.GetOperation() == admission.Delete
+	}
+	return reserved
+}
+
+// batchContext returns a context that is cancelled once all the waiters are abandoned.
+func batchContext(waiters []*admissionWaiter) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	remaining := atomic.Int32{}
+	remaining.Store(int32(len(waiters)))
+	stops := make([]func() bool, 0, len(waiters))
+	for _, waiter := range waiters {
+		stops = append(stops, context.AfterFunc(waiter.ctx, func() {
+			if remaining.Add(-1) == 0 {
+				cancel()
+			}
+		}))
+	}
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel()
+	}
+}
+
+// commitContext returns a context derived from parent that is cancelled as soon as one of the waiters is abandoned.
+func commitContext(parent context.Context, waiters []*admissionWaiter) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	stops := make([]func() bool, 0, len(waiters))
+	for _, waiter := range waiters {
+		stops = append(stops, context.AfterFunc(waiter.ctx, cancel))
+	}
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel()
+	}
 }
 
 func copyQuotas(in []corev1.ResourceQuota) ([]corev1.ResourceQuota, error) {
@@ -387,16 +527,89 @@ func getMatchedLimitedScopes(evaluator quota.Evaluator, inputObject runtime.Obje
 
 // checkRequest verifies that the request does not exceed any quota constraint. it returns a copy of quotas not yet persisted
 // that capture what the usage would be if the request succeeded.  It return an error if there is insufficient quota to satisfy the request
-func (e *quotaEvaluator) checkRequest(quotas []corev1.ResourceQuota, a admission.Attributes) ([]corev1.ResourceQuota, error) {
+func (e *quotaEvaluator) checkRequest(ctx context.Context, quotas []corev1.ResourceQuota, a admission.Attributes) ([]corev1.ResourceQuota, error) {
 	evaluator := e.registry.Get(a.GetResource().GroupResource())
 	if evaluator == nil {
 		return quotas, nil
 	}
-	return CheckRequest(quotas, a, evaluator, e.config.LimitedResources)
+	if IsRelease(a) {
+		return ReleaseRequest(ctx, quotas, a, evaluator)
+	}
+	// subresources do not change the usage of their object, which is charged by the requests to the object itself
+	if len(a.GetSubresource()) != 0 {
+		return quotas, nil
+	}
+	return CheckRequest(ctx, quotas, a, evaluator, e.config.LimitedResources)
+}
+
+// IsRelease returns true if the request frees usage: the first deletion of an object, and a pod status update to a
+// terminal phase unless the pod was released by its deletion already.
+func IsRelease(a admission.Attributes) bool {
+	switch a.GetOperation() {
+	case admission.Delete:
+		// the final deletion of a gracefully deleted object was released by the first one
+		metadata, err := meta.Accessor(a.GetOldObject())
+		return err == nil && metadata.GetDeletionTimestamp() == nil
+	case admission.Update:
+		if a.GetResource().GroupResource() != corev1.Resource("pods") || a.GetSubresource() != "status" {
+			return false
+		}
+		oldPod, oldOK := a.GetOldObject().(*corev1.Pod)
+		newPod, newOK := a.GetObject().(*corev1.Pod)
+		return oldOK && newOK && oldPod.DeletionTimestamp == nil && !isTerminal(oldPod) && isTerminal(newPod)
+	}
+	return false
+}
+
+func isTerminal(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// ReleaseRequest returns a copy of quotas with the usage freed by the request subtracted from the quotas matching
+// the released object.  Releases are never denied, the lowered usage is only reserved until the controller
+// recalculates the quotas from the objects it observes.
+func ReleaseRequest(ctx context.Context, quotas []corev1.ResourceQuota, a admission.Attributes, evaluator quota.Evaluator) ([]corev1.ResourceQuota, error) {
+	oldObject := a.GetOldObject()
+	if oldObject == nil {
+		return quotas, nil
+	}
+	releasedUsage, err := quota.UsageWithContext(ctx, evaluator, oldObject)
+	if err != nil {
+		return quotas, err
+	}
+	// a pod reaching a terminal phase keeps its object count until it is deleted
+	if newObject := a.GetObject(); newObject != nil {
+		remainingUsage, err := quota.UsageWithContext(ctx, evaluator, newObject)
+		if err != nil {
+			return quotas, err
+		}
+		releasedUsage = quota.SubtractWithNonNegativeResult(releasedUsage, remainingUsage)
+	}
+	if quota.IsZero(releasedUsage) {
+		return quotas, nil
+	}
+
+	outQuotas, err := copyQuotas(quotas)
+	if err != nil {
+		return nil, err
+	}
+	for i := range outQuotas {
+		resourceQuota := &outQuotas[i]
+		match, err := evaluator.Matches(resourceQuota, oldObject)
+		if err != nil {
+			return quotas, err
+		}
+		if !match {
+			continue
+		}
+		hardResources := quota.ResourceNames(resourceQuota.Status.Hard)
+		resourceQuota.Status.Used = quota.SubtractWithNonNegativeResult(resourceQuota.Status.Used, quota.Mask(releasedUsage, hardResources))
+	}
+	return outQuotas, nil
 }
 
 // CheckRequest is a static version of quotaEvaluator.checkRequest, possible to be called from outside.
-func CheckRequest(quotas []corev1.ResourceQuota, a admission.Attributes, evaluator quota.Evaluator,
+func CheckRequest(ctx context.Context, quotas []corev1.ResourceQuota, a admission.Attributes, evaluator quota.Evaluator,
 	limited []resourcequotaapi.LimitedResource) ([]corev1.ResourceQuota, error) {
 	if !evaluator.Handles(a) {
 		return quotas, nil
@@ -415,7 +628,7 @@ func CheckRequest(quotas []corev1.ResourceQuota, a admission.Attributes, evaluat
 	limitedResourceNames := []corev1.ResourceName{}
 	limitedResources := filterLimitedResourcesByGroupResource(limited, a.GetResource().GroupResource())
 	if len(limitedResources) > 0 {
-		deltaUsage, err := evaluator.Usage(inputObject)
+		deltaUsage, err := quota.UsageWithContext(ctx, evaluator, inputObject)
 		if err != nil {
 			return quotas, err
 		}
@@ -436,24 +649,28 @@ func CheckRequest(quotas []corev1.ResourceQuota, a admission.Attributes, evaluat
 	for i := range quotas {
 		resourceQuota := quotas[i]
 		scopeSelectors := getScopeSelectorsFromQuota(resourceQuota)
+		// scopes that cannot be matched are a configuration error of the quota, the object cannot be checked against it
 		localRestrictedScopes, err := evaluator.MatchingScopes(inputObject, scopeSelectors)
 		if err != nil {
-			return nil, fmt.Errorf("error matching scopes of quota %s, err: %v", resourceQuota.Name, err)
+			return nil, admission.NewForbidden(a, fmt.Errorf("invalid scopes of quota %s: %v", resourceQuota.Name, err))
 		}
 		restrictedScopes = append(restrictedScopes, localRestrictedScopes...)
 
 		match, err := evaluator.Matches(&resourceQuota, inputObject)
 		if err != nil {
 			klog.Errorf("Error occurred while matching resource quota, %v, against input object. Err: %v", resourceQuota, err)
-			return quotas, err
+			return nil, admission.NewForbidden(a, fmt.Errorf("invalid scopes of quota %s: %v", resourceQuota.Name, err))
 		}
 		if !match {
 			continue
 		}
+		if message, found := resourceQuota.Annotations[quota.UsageErrorAnnotation]; found {
+			return nil, admission.NewForbidden(a, fmt.Errorf("usage of quota %s cannot be calculated: %s", resourceQuota.Name, message))
+		}
 
 		hardResources := quota.ResourceNames(resourceQuota.Status.Hard)
 		restrictedResources := evaluator.MatchingResources(hardResources)
-		if err := evaluator.Constraints(restrictedResources, inputObject); err != nil {
+		if err := quota.ConstraintsWithContext(ctx, evaluator, restrictedResources, inputObject); err != nil {
 			return nil, admission.NewForbidden(a, fmt.Errorf("failed quota: %s: %v", resourceQuota.Name, err))
 		}
 		if !hasUsageStats(&resourceQuota, restrictedResources) {
@@ -478,7 +695,7 @@ func CheckRequest(quotas []corev1.ResourceQuota, a admission.Attributes, evaluat
 	// as a result, we need to measure the usage of this object for quota
 	// on updates, we need to subtract the previous measured usage
 	// if usage shows no change, just return since it has no impact on quota
-	deltaUsage, err := evaluator.Usage(inputObject)
+	deltaUsage, err := quota.UsageWithContext(ctx, evaluator, inputObject)
 	if err != nil {
 		return quotas, err
 	}
@@ -498,7 +715,7 @@ func CheckRequest(quotas []corev1.ResourceQuota, a admission.Attributes, evaluat
 		// then charge based on the delta.  Otherwise, bill the maximum
 		metadata, err := meta.Accessor(prevItem)
 		if err == nil && len(metadata.GetResourceVersion()) > 0 {
-			prevUsage, innerErr := evaluator.Usage(prevItem)
+			prevUsage, innerErr := quota.UsageWithContext(ctx, evaluator, prevItem)
 			if innerErr != nil {
 				return quotas, innerErr
 			}
@@ -578,7 +795,7 @@ func getScopeSelectorsFromQuota(quota corev1.ResourceQuota) []corev1.ScopedResou
 	return selectors
 }
 
-func (e *quotaEvaluator) Evaluate(a admission.Attributes) error {
+func (e *quotaEvaluator) Evaluate(ctx context.Context, a admission.Attributes) error {
 	e.init.Do(func() {
 		go e.run()
 	})
@@ -601,18 +818,25 @@ func (e *quotaEvaluator) Evaluate(a admission.Attributes) error {
 	}
 	// for this kind, check if the operation could mutate any quota resources
 	// if no resources tracked by quota are impacted, then just return
-	if !evaluator.Handles(a) {
+	if !evaluator.Handles(a) && !IsRelease(a) {
 		return nil
 	}
-	waiter := newAdmissionWaiter(a)
+	// the request is abandoned at the deadline of the apiserver, or after the timeout.  Returning abandons it.
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.timeout.Load()))
+	defer cancel()
+	waiter := newAdmissionWaiter(ctx, a)
 
 	e.addWork(waiter)
 
 	// wait for completion or timeout
 	select {
 	case <-waiter.finished:
-	case <-time.After(10 * time.Second):
-		return apierrors.NewInternalError(fmt.Errorf("resource quota evaluates timeout"))
+	case <-ctx.Done():
+		select {
+		case <-waiter.finished:
+		default:
+			return apierrors.NewInternalError(fmt.Errorf("resource quota evaluates timeout"))
+		}
 	}
 
 	return waiter.result
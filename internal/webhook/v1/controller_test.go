@@ -0,0 +1,566 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	resourcequotaapi "k8s.io/apiserver/pkg/admission/plugin/resourcequota/apis/resourcequota"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	quotav1 "caih.com/api/v1"
+	"caih.com/internal/webhook/v1/fake"
+	"caih.com/pkg/config"
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+	"caih.com/pkg/quota/generic"
+)
+
+func BenchmarkCheckRequest(b *testing.B) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("100m"),
+						corev1.ResourceMemory: resource.MustParse("128Mi"),
+					},
+				},
+			}},
+		},
+	}
+	attributes := admission.NewAttributesRecord(pod, nil, corev1.SchemeGroupVersion.WithKind("Pod"), pod.Namespace,
+		pod.Name, corev1.SchemeGroupVersion.WithResource("pods"), "", admission.Create, &metav1.CreateOptions{}, false, nil)
+	podEvaluator := core.NewPodEvaluator(nil, clock.RealClock{})
+
+	for _, count := range []int{1, 10, 100} {
+		quotas := make([]corev1.ResourceQuota, count)
+		for i := range quotas {
+			hard := corev1.ResourceList{
+				corev1.ResourcePods:           resource.MustParse("1000"),
+				corev1.ResourceRequestsCPU:    resource.MustParse("100"),
+				corev1.ResourceRequestsMemory: resource.MustParse("100Gi"),
+			}
+			quotas[i] = corev1.ResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: fmt.Sprintf("quota-%d", i)},
+				Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+				Status: corev1.ResourceQuotaStatus{
+					Hard: hard,
+					Used: corev1.ResourceList{
+						corev1.ResourcePods:           resource.MustParse("10"),
+						corev1.ResourceRequestsCPU:    resource.MustParse("1"),
+						corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+					},
+				},
+			}
+		}
+		b.Run(fmt.Sprintf("quotas=%d", count), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := CheckRequest(context.Background(), quotas, attributes, podEvaluator, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRequestRejectsQuotasWithInvalidScopes(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod"},
+		Spec: corev1.PodSpec{
+			PriorityClassName: "high",
+			Containers:        []corev1.Container{{Name: "app"}},
+		},
+	}
+	attributes := admission.NewAttributesRecord(pod, nil, corev1.SchemeGroupVersion.WithKind("Pod"), pod.Namespace,
+		pod.Name, corev1.SchemeGroupVersion.WithResource("pods"), "", admission.Create, &metav1.CreateOptions{}, false, nil)
+	podEvaluator := core.NewPodEvaluator(nil, clock.RealClock{})
+	hard := corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}
+	newQuota := func() corev1.ResourceQuota {
+		return corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: "quota"},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("0")}},
+		}
+	}
+
+	invalidScopes := newQuota()
+	invalidScopes.Spec.ScopeSelector = &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{{
+		ScopeName: corev1.ResourceQuotaScopePriorityClass,
+		Operator:  "Unknown",
+		Values:    []string{"high"},
+	}}}
+	failedUsage := newQuota()
+	failedUsage.Annotations = map[string]string{quota.UsageErrorAnnotation: "namespace namespace: failed to match scope"}
+
+	for name, q := range map[string]corev1.ResourceQuota{"invalid scopes": invalidScopes, "usage not calculated": failedUsage} {
+		t.Run(name, func(t *testing.T) {
+			_, err := CheckRequest(context.Background(), []corev1.ResourceQuota{q}, attributes, podEvaluator, nil)
+			if !apierrors.IsForbidden(err) {
+				t.Fatalf("expected the admission to be forbidden, got: %v", err)
+			}
+		})
+	}
+	if _, err := CheckRequest(context.Background(), []corev1.ResourceQuota{newQuota()}, attributes, podEvaluator, nil); err != nil {
+		t.Fatalf("expected the admission to be allowed, got: %v", err)
+	}
+}
+
+func TestReservedObject(t *testing.T) {
+	podResource := corev1.SchemeGroupVersion.WithResource("pods")
+	oldPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod", UID: "uid", ResourceVersion: "1"}}
+	newPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod", UID: "uid", ResourceVersion: "1"}}
+	generatedPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", GenerateName: "pod-"}}
+	testCases := map[string]struct {
+		operation admission.Operation
+		object    *corev1.Pod
+		oldObject *corev1.Pod
+		expected  *quotav1.ReservedObject
+	}{
+		"create": {
+			operation: admission.Create,
+			object:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod"}},
+			expected:  &quotav1.ReservedObject{Resource: "pods", Name: "pod"},
+		},
+		"create with a generated name": {
+			operation: admission.Create,
+			object:    generatedPod,
+		},
+		"update": {
+			operation: admission.Update,
+			object:    newPod,
+			oldObject: oldPod,
+			expected:  &quotav1.ReservedObject{Resource: "pods", Name: "pod", UID: "uid", ResourceVersion: "1"},
+		},
+		"delete": {
+			operation: admission.Delete,
+			oldObject: oldPod,
+			expected:  &quotav1.ReservedObject{Resource: "pods", Name: "pod", UID: "uid", ResourceVersion: "1", Deleted: true},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var object, oldObject runtime.Object
+			if tc.object != nil {
+				object = tc.object
+			}
+			if tc.oldObject != nil {
+				oldObject = tc.oldObject
+			}
+			attributes := admission.NewAttributesRecord(object, oldObject, corev1.SchemeGroupVersion.WithKind("Pod"), "namespace",
+				"pod", podResource, "", tc.operation, nil, false, nil)
+			actual := reservedObject(attributes)
+			if (actual == nil) != (tc.expected == nil) || (actual != nil && *actual != *tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBatchContext(t *testing.T) {
+	firstCtx, abandonFirst := context.WithCancel(context.Background())
+	secondCtx, abandonSecond := context.WithCancel(context.Background())
+	defer abandonSecond()
+	waiters := []*admissionWaiter{newAdmissionWaiter(firstCtx, nil), newAdmissionWaiter(secondCtx, nil)}
+
+	ctx, cancel := batchContext(waiters)
+	defer cancel()
+	abandonFirst()
+	if ctx.Err() != nil {
+		t.Fatalf("expected the batch to go on while a request waits for it")
+	}
+	abandonSecond()
+	select {
+	case <-ctx.Done():
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the batch to be abandoned with its last request")
+	}
+
+	ctx, cancel = batchContext([]*admissionWaiter{newAdmissionWaiter(context.Background(), nil)})
+	cancel()
+	if ctx.Err() == nil {
+		t.Errorf("expected the batch to be cancelled with its cancel function")
+	}
+}
+
+func TestCommitContext(t *testing.T) {
+	testCases := map[string]struct {
+		abandon         int
+		cancelParent    bool
+		expectCancelled bool
+	}{
+		"no request abandoned": {
+			abandon: -1,
+		},
+		"a request abandoned": {
+			abandon:         1,
+			expectCancelled: true,
+		},
+		"parent cancelled": {
+			abandon:         -1,
+			cancelParent:    true,
+			expectCancelled: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			parent, cancelParent := context.WithCancel(context.Background())
+			defer cancelParent()
+			var waiters []*admissionWaiter
+			var abandons []context.CancelFunc
+			for i := 0; i < 3; i++ {
+				ctx, abandon := context.WithCancel(context.Background())
+				defer abandon()
+				waiters = append(waiters, newAdmissionWaiter(ctx, nil))
+				abandons = append(abandons, abandon)
+			}
+
+			ctx, cancel := commitContext(parent, waiters)
+			defer cancel()
+			if tc.abandon >= 0 {
+				abandons[tc.abandon]()
+			}
+			if tc.cancelParent {
+				cancelParent()
+			}
+			if tc.expectCancelled {
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait.ForeverTestTimeout):
+					t.Fatalf("expected the commit to be cancelled")
+				}
+			} else if ctx.Err() != nil {
+				t.Fatalf("unexpected cancellation: %v", ctx.Err())
+			}
+		})
+	}
+}
+
+// hookedEvaluator calls hook with the pods it measures.
+type hookedEvaluator struct {
+	quota.Evaluator
+	hook func(pod *corev1.Pod)
+}
+
+func (e *hookedEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	if pod, ok := item.(*corev1.Pod); ok && e.hook != nil {
+		e.hook(pod)
+	}
+	return e.Evaluator.Usage(item)
+}
+
+func newPodWaiter(ctx context.Context, name string) *admissionWaiter {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: name},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	return newAdmissionWaiter(ctx, admission.NewAttributesRecord(pod, nil, corev1.SchemeGroupVersion.WithKind("Pod"), pod.Namespace,
+		pod.Name, corev1.SchemeGroupVersion.WithResource("pods"), "", admission.Create, &metav1.CreateOptions{}, false, nil))
+}
+
+// TestCheckQuotasAbandonedRequests checks that the usage of requests abandoned while their batch is evaluated is not
+// committed, and that the other requests of the batch are admitted.
+func TestCheckQuotasAbandonedRequests(t *testing.T) {
+	testCases := map[string]struct {
+		// abandonedWhileChecking is abandoned while the next request is checked, after it was charged
+		abandonedWhileChecking bool
+		// latency delays the lookups and updates of the quota, the abandoned request times out during the commit
+		latency time.Duration
+	}{
+		"abandoned after it was charged": {
+			abandonedWhileChecking: true,
+		},
+		"timed out during the commit": {
+			latency: 200 * time.Millisecond,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			accessor := fake.NewQuotaAccessor()
+			accessor.AddQuota("quota", corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")}, "namespace")
+			quotas, err := accessor.GetQuotas(context.Background(), "namespace")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.latency > 0 {
+				accessor.Latency = func() time.Duration {
+					return tc.latency
+				}
+			}
+
+			var abandonedCtx context.Context
+			var abandon context.CancelFunc
+			if tc.abandonedWhileChecking {
+				abandonedCtx, abandon = context.WithCancel(context.Background())
+			} else {
+				abandonedCtx, abandon = context.WithTimeout(context.Background(), tc.latency/2)
+			}
+			defer abandon()
+			abandoned := newPodWaiter(abandonedCtx, "abandoned")
+			admitted := newPodWaiter(context.Background(), "admitted")
+
+			podEvaluator := &hookedEvaluator{Evaluator: core.NewPodEvaluator(nil, clock.RealClock{})}
+			if tc.abandonedWhileChecking {
+				podEvaluator.hook = func(pod *corev1.Pod) {
+					if pod.Name == "admitted" {
+						abandon()
+					}
+				}
+			}
+			e := &quotaEvaluator{
+				quotaAccessor: accessor,
+				registry:      generic.NewRegistry([]quota.Evaluator{podEvaluator}),
+				config:        &resourcequotaapi.Configuration{},
+			}
+			waiters := []*admissionWaiter{abandoned, admitted}
+			for _, waiter := range waiters {
+				waiter.result = defaultDeny{}
+			}
+			e.checkQuotas(context.Background(), quotas, waiters, 3)
+
+			if !errors.Is(abandoned.result, abandonedCtx.Err()) {
+				t.Errorf("expected the abandoned request to fail with %v, got %v", abandonedCtx.Err(), abandoned.result)
+			}
+			if admitted.result != nil {
+				t.Errorf("expected the other request to be admitted, got %v", admitted.result)
+			}
+			resourceQuota, _ := accessor.Quota("quota")
+			if used := resourceQuota.Status.Used[corev1.ResourcePods]; used.Value() != 1 {
+				t.Errorf("expected only the admitted request to be charged, got %s pods", used.String())
+			}
+		})
+	}
+}
+
+// TestCheckAttributesLimitedResources checks that the limitedResources of a kube-apiserver ResourceQuota admission
+// configuration file require a quota covering them.
+func TestCheckAttributesLimitedResources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resourcequota.yaml")
+	if err := os.WriteFile(path, []byte(`apiVersion: apiserver.config.k8s.io/v1
+kind: ResourceQuotaConfiguration
+limitedResources:
+- resource: pods
+  matchContains:
+  - count/pods
+`), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limited, err := config.LoadResourceQuotaConfiguration(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		config *resourcequotaapi.Configuration
+		hard   corev1.ResourceList
+		expect string
+	}{
+		"no quota, nothing limited": {
+			config: &resourcequotaapi.Configuration{},
+		},
+		"no quota": {
+			config: limited,
+			expect: "insufficient quota to consume: count/pods",
+		},
+		"quota not covering the limited resource": {
+			config: limited,
+			hard:   corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")},
+			expect: "insufficient quota to consume: count/pods",
+		},
+		"quota covering the limited resource": {
+			config: limited,
+			hard:   corev1.ResourceList{"count/pods": resource.MustParse("1")},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			accessor := fake.NewQuotaAccessor()
+			if tc.hard != nil {
+				accessor.AddQuota("quota", tc.hard, "namespace")
+			}
+			e := &quotaEvaluator{
+				quotaAccessor: accessor,
+				registry:      generic.NewRegistry([]quota.Evaluator{core.NewPodEvaluator(nil, clock.RealClock{})}),
+				config:        tc.config,
+			}
+			waiter := newPodWaiter(context.Background(), "pod")
+			waiter.result = defaultDeny{}
+			e.checkAttributes("namespace", []*admissionWaiter{waiter})
+
+			if len(tc.expect) == 0 {
+				if waiter.result != nil {
+					t.Errorf("unexpected error: %v", waiter.result)
+				}
+				return
+			}
+			if waiter.result == nil || !strings.Contains(waiter.result.Error(), tc.expect) {
+				t.Errorf("expected error containing %q, got %v", tc.expect, waiter.result)
+			}
+		})
+	}
+}
+
+// newReleasedPod returns a running pod requesting 100m of cpu, terminated in phase if set.
+func newReleasedPod(phase corev1.PodPhase, deleted bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "app",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if len(phase) != 0 {
+		pod.Status.Phase = phase
+	}
+	if deleted {
+		pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		pod.DeletionGracePeriodSeconds = ptr.To[int64](30)
+	}
+	return pod
+}
+
+func newPodAttributes(operation admission.Operation, subresource string, obj, oldObj *corev1.Pod) admission.Attributes {
+	var object, oldObject runtime.Object
+	if obj != nil {
+		object = obj
+	}
+	if oldObj != nil {
+		oldObject = oldObj
+	}
+	return admission.NewAttributesRecord(object, oldObject, corev1.SchemeGroupVersion.WithKind("Pod"), "namespace", "pod",
+		corev1.SchemeGroupVersion.WithResource("pods"), subresource, operation, nil, false, nil)
+}
+
+func TestIsRelease(t *testing.T) {
+	testCases := map[string]struct {
+		attributes admission.Attributes
+		expect     bool
+	}{
+		"create": {
+			attributes: newPodAttributes(admission.Create, "", newReleasedPod("", false), nil),
+		},
+		"first deletion": {
+			attributes: newPodAttributes(admission.Delete, "", nil, newReleasedPod("", false)),
+			expect:     true,
+		},
+		"final deletion of a gracefully deleted pod": {
+			attributes: newPodAttributes(admission.Delete, "", nil, newReleasedPod("", true)),
+		},
+		"status update to a terminal phase": {
+			attributes: newPodAttributes(admission.Update, "status", newReleasedPod(corev1.PodSucceeded, false), newReleasedPod("", false)),
+			expect:     true,
+		},
+		"status update to a terminal phase of a deleted pod": {
+			attributes: newPodAttributes(admission.Update, "status", newReleasedPod(corev1.PodFailed, true), newReleasedPod("", true)),
+		},
+		"status update of a terminated pod": {
+			attributes: newPodAttributes(admission.Update, "status", newReleasedPod(corev1.PodFailed, false), newReleasedPod(corev1.PodFailed, false)),
+		},
+		"status update in a running phase": {
+			attributes: newPodAttributes(admission.Update, "status", newReleasedPod("", false), newReleasedPod(corev1.PodPending, false)),
+		},
+		"update to a terminal phase without the status subresource": {
+			attributes: newPodAttributes(admission.Update, "", newReleasedPod(corev1.PodSucceeded, false), newReleasedPod("", false)),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if released := IsRelease(tc.attributes); released != tc.expect {
+				t.Errorf("expected release %t, got %t", tc.expect, released)
+			}
+		})
+	}
+}
+
+func TestReleaseRequest(t *testing.T) {
+	used := corev1.ResourceList{
+		corev1.ResourcePods:        resource.MustParse("2"),
+		"count/pods":               resource.MustParse("2"),
+		corev1.ResourceRequestsCPU: resource.MustParse("200m"),
+	}
+	newQuota := func(name string, scopes ...corev1.ResourceQuotaScope) corev1.ResourceQuota {
+		hard := corev1.ResourceList{
+			corev1.ResourcePods:        resource.MustParse("4"),
+			"count/pods":               resource.MustParse("4"),
+			corev1.ResourceRequestsCPU: resource.MustParse("1"),
+		}
+		return corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: name},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard, Scopes: scopes},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used.DeepCopy()},
+		}
+	}
+	testCases := map[string]struct {
+		attributes admission.Attributes
+		expect     corev1.ResourceList
+	}{
+		"deletion": {
+			attributes: newPodAttributes(admission.Delete, "", nil, newReleasedPod("", false)),
+			expect: corev1.ResourceList{
+				corev1.ResourcePods:        resource.MustParse("1"),
+				"count/pods":               resource.MustParse("1"),
+				corev1.ResourceRequestsCPU: resource.MustParse("100m"),
+			},
+		},
+		"terminal phase keeps the object count": {
+			attributes: newPodAttributes(admission.Update, "status", newReleasedPod(corev1.PodSucceeded, false), newReleasedPod("", false)),
+			expect: corev1.ResourceList{
+				corev1.ResourcePods:        resource.MustParse("1"),
+				"count/pods":               resource.MustParse("2"),
+				corev1.ResourceRequestsCPU: resource.MustParse("100m"),
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			quotas := []corev1.ResourceQuota{newQuota("all"), newQuota("best-effort", corev1.ResourceQuotaScopeBestEffort)}
+			outQuotas, err := ReleaseRequest(context.Background(), quotas, tc.attributes, core.NewPodEvaluator(nil, clock.RealClock{}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !quota.Equals(outQuotas[0].Status.Used, tc.expect) {
+				t.Errorf("expected used %v, got %v", tc.expect, outQuotas[0].Status.Used)
+			}
+			if !quota.Equals(outQuotas[1].Status.Used, used) {
+				t.Errorf("expected the quota not matching the pod to be unchanged, got %v", outQuotas[1].Status.Used)
+			}
+			if !quota.Equals(quotas[0].Status.Used, used) {
+				t.Errorf("expected the passed quotas to be unchanged, got %v", quotas[0].Status.Used)
+			}
+		})
+	}
+}
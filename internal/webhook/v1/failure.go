@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// reasons an admission is handled by the failure policy, recorded in the unverified annotation
+const (
+	reasonCircuitOpen      = "CircuitOpen"
+	reasonEvaluationFailed = "EvaluationFailed"
+)
+
+var errCircuitOpen = fmt.Errorf("quota evaluation is suspended after repeated errors")
+
+// SetFailurePolicy sets the failure policy of admissions whose quotas do not set one.
+func (a *SharedQuotaAdmission) SetFailurePolicy(policy quotav1.FailurePolicyType) {
+	a.failurePolicy.Store(policy)
+}
+
+// SetCircuitBreaker sets the number of consecutive evaluation errors that suspend evaluations, and how long they
+// are suspended.
+func (a *SharedQuotaAdmission) SetCircuitBreaker(threshold int, openDuration time.Duration) {
+	a.breaker.Set(threshold, openDuration)
+}
+
+// quotaNamesLookup returns the names of the shared quotas selecting a namespace, implemented by the
+// quota.QuotaMappingCache.
+type quotaNamesLookup interface {
+	ResourceQuotaNamesFor(namespace string) ([]string, error)
+}
+
+// failurePolicyFor returns the failure policy of admissions in the namespace.  Closed wins over Open when the
+// quotas selecting the namespace disagree, and the global policy applies when none of them sets one or when they
+// cannot be looked up without waiting.  Quotas that cannot be read, typically because they were just deleted, are
+// skipped.
+func (a *SharedQuotaAdmission) failurePolicyFor(ctx context.Context, namespace string) quotav1.FailurePolicyType {
+	policy := a.failurePolicy.Load().(quotav1.FailurePolicyType)
+	if a.mappingCache == nil {
+		return policy
+	}
+	quotaNames, err := a.mappingCache.ResourceQuotaNamesFor(namespace)
+	if err != nil {
+		return policy
+	}
+	var open bool
+	for _, quotaName := range quotaNames {
+		sharedQuota := &quotav1.SharedQuota{}
+		if err := a.client.Get(ctx, client.ObjectKey{Name: quotaName}, sharedQuota); err != nil {
+			klog.V(4).Infof("skipping the failure policy of shared quota %s: %v", quotaName, err)
+			continue
+		}
+		switch sharedQuota.Spec.FailurePolicy {
+		case quotav1.FailClosed:
+			return quotav1.FailClosed
+		case quotav1.FailOpen:
+			open = true
+		}
+	}
+	if open {
+		return quotav1.FailOpen
+	}
+	return policy
+}
+
+// degrade handles an admission that could not be evaluated according to the failure policy of its namespace.
+// The Open policy admits the object and marks it with the unverified annotation, the Closed policy rejects it.
+func (a *SharedQuotaAdmission) degrade(ctx context.Context, req webhook.AdmissionRequest, reason string, err error) webhook.AdmissionResponse {
+	if a.failurePolicyFor(ctx, req.Namespace) != quotav1.FailOpen {
+		return webhook.Errored(http.StatusInternalServerError, err)
+	}
+	klog.Warningf("admitting %s %s/%s without quota evaluation: %v", req.Resource.Resource, req.Namespace, req.Name, err)
+	unverifiedAdmissionsTotal.WithLabelValues(req.Resource.Resource, reason).Inc()
+	resp := webhook.Allowed("")
+	if (req.Operation == admissionv1.Create || req.Operation == admissionv1.Update) && len(req.Object.Raw) != 0 {
+		patched, err := markUnverified(req.Object.Raw, reason)
+		if err != nil {
+			klog.Error(err)
+		} else {
+			resp = admission.PatchResponseFromRaw(req.Object.Raw, patched)
+		}
+	}
+	resp.AuditAnnotations = map[string]string{"unverified": reason}
+	return resp.WithWarnings(fmt.Sprintf("quota was not verified: %v", err))
+}
+
+// markUnverified returns the object with the unverified annotation set to reason.
+func markUnverified(raw []byte, reason string) ([]byte, error) {
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(raw, &obj.Object); err != nil {
+		return nil, err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[quotav1.UnverifiedAnnotation] = reason
+	obj.SetAnnotations(annotations)
+	return json.Marshal(obj.Object)
+}
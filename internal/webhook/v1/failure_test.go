@@ -0,0 +1,204 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	quotav1 "caih.com/api/v1"
+	"caih.com/internal/webhook/v1/fake"
+)
+
+// fakeQuotaNames maps namespaces to the names of the quotas selecting them, or fails with err.
+type fakeQuotaNames struct {
+	names map[string][]string
+	err   error
+}
+
+func (f fakeQuotaNames) ResourceQuotaNamesFor(namespace string) ([]string, error) {
+	return f.names[namespace], f.err
+}
+
+func TestFailurePolicyFor(t *testing.T) {
+	testCases := map[string]struct {
+		global quotav1.FailurePolicyType
+		// lookup is nil without mapping cache
+		lookup *fakeQuotaNames
+		// quotas are the failure policies of the existing shared quotas by name
+		quotas map[string]quotav1.FailurePolicyType
+		// unreadable are the quotas whose reads fail
+		unreadable []string
+		expect     quotav1.FailurePolicyType
+	}{
+		"no mapping cache": {
+			global: quotav1.FailOpen,
+			expect: quotav1.FailOpen,
+		},
+		"namespace not observed": {
+			global: quotav1.FailClosed,
+			lookup: &fakeQuotaNames{err: apierrors.NewNotFound(corev1.Resource("namespaces"), "namespace")},
+			expect: quotav1.FailClosed,
+		},
+		"no quota": {
+			global: quotav1.FailOpen,
+			lookup: &fakeQuotaNames{},
+			expect: quotav1.FailOpen,
+		},
+		"quota without policy": {
+			global: quotav1.FailClosed,
+			lookup: &fakeQuotaNames{names: map[string][]string{"namespace": {"a"}}},
+			quotas: map[string]quotav1.FailurePolicyType{"a": ""},
+			expect: quotav1.FailClosed,
+		},
+		"open quota": {
+			global: quotav1.FailClosed,
+			lookup: &fakeQuotaNames{names: map[string][]string{"namespace": {"a", "b"}}},
+			quotas: map[string]quotav1.FailurePolicyType{"a": "", "b": quotav1.FailOpen},
+			expect: quotav1.FailOpen,
+		},
+		"closed quota": {
+			global: quotav1.FailOpen,
+			lookup: &fakeQuotaNames{names: map[string][]string{"namespace": {"a"}}},
+			quotas: map[string]quotav1.FailurePolicyType{"a": quotav1.FailClosed},
+			expect: quotav1.FailClosed,
+		},
+		"closed wins over open": {
+			global: quotav1.FailOpen,
+			lookup: &fakeQuotaNames{names: map[string][]string{"namespace": {"a", "b", "c"}}},
+			quotas: map[string]quotav1.FailurePolicyType{"a": quotav1.FailOpen, "b": quotav1.FailClosed, "c": quotav1.FailOpen},
+			expect: quotav1.FailClosed,
+		},
+		"deleted quota skipped": {
+			global: quotav1.FailClosed,
+			lookup: &fakeQuotaNames{names: map[string][]string{"namespace": {"a", "b"}}},
+			quotas: map[string]quotav1.FailurePolicyType{"b": quotav1.FailOpen},
+			expect: quotav1.FailOpen,
+		},
+		"unreadable quota skipped": {
+			global:     quotav1.FailOpen,
+			lookup:     &fakeQuotaNames{names: map[string][]string{"namespace": {"a", "b"}}},
+			quotas:     map[string]quotav1.FailurePolicyType{"a": quotav1.FailOpen, "b": quotav1.FailClosed},
+			unreadable: []string{"a"},
+			expect:     quotav1.FailClosed,
+		},
+	}
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = quotav1.AddToScheme(testScheme)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			builder := clientfake.NewClientBuilder().WithScheme(testScheme).WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					for _, unreadable := range tc.unreadable {
+						if key.Name == unreadable {
+							return fmt.Errorf("unavailable")
+						}
+					}
+					return c.Get(ctx, key, obj, opts...)
+				},
+			})
+			for quotaName, policy := range tc.quotas {
+				builder.WithObjects(&quotav1.SharedQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: quotaName},
+					Spec:       quotav1.SharedQuotaSpec{FailurePolicy: policy},
+				})
+			}
+			sharedQuotaAdmission, err := NewSharedQuotaAdmission(builder.Build(), testScheme, fake.NewQuotaAccessor(), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sharedQuotaAdmission.SetFailurePolicy(tc.global)
+			if tc.lookup != nil {
+				sharedQuotaAdmission.mappingCache = *tc.lookup
+			}
+
+			if policy := sharedQuotaAdmission.failurePolicyFor(context.Background(), "namespace"); policy != tc.expect {
+				t.Errorf("expected failure policy %s, got %s", tc.expect, policy)
+			}
+		})
+	}
+}
+
+func TestMarkUnverified(t *testing.T) {
+	testCases := map[string]struct {
+		raw               string
+		expectAnnotations map[string]string
+		expectErr         bool
+	}{
+		"without annotations": {
+			raw:               `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod"}}`,
+			expectAnnotations: map[string]string{quotav1.UnverifiedAnnotation: reasonCircuitOpen},
+		},
+		"with annotations": {
+			raw: `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod","annotations":{"a":"b"}}}`,
+			expectAnnotations: map[string]string{
+				"a":                          "b",
+				quotav1.UnverifiedAnnotation: reasonCircuitOpen,
+			},
+		},
+		"already unverified": {
+			raw: fmt.Sprintf(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod","annotations":{%q:%q}}}`,
+				quotav1.UnverifiedAnnotation, reasonEvaluationFailed),
+			expectAnnotations: map[string]string{quotav1.UnverifiedAnnotation: reasonCircuitOpen},
+		},
+		"invalid object": {
+			raw:       `{"metadata":`,
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			patched, err := markUnverified([]byte(tc.raw), reasonCircuitOpen)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			obj := &metav1.PartialObjectMetadata{}
+			if err := json.Unmarshal(patched, obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if obj.Name != "pod" || obj.Kind != "Pod" {
+				t.Errorf("expected the object to be kept, got %s", patched)
+			}
+			if len(obj.Annotations) != len(tc.expectAnnotations) {
+				t.Fatalf("expected annotations %v, got %v", tc.expectAnnotations, obj.Annotations)
+			}
+			for key, value := range tc.expectAnnotations {
+				if obj.Annotations[key] != value {
+					t.Errorf("expected annotations %v, got %v", tc.expectAnnotations, obj.Annotations)
+				}
+			}
+		})
+	}
+}
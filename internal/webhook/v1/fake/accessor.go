@@ -0,0 +1,206 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory QuotaAccessor for testing the quota evaluator.
+package fake
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// QuotaAccessor is an in-memory QuotaAccessor serving shared quotas.  Like the accessor of the webhook, it returns
+// a copy of every quota selecting the namespace with the namespace set, and status updates based on a stale
+// resource version fail with a conflict.  Conflicts and latency can be injected.
+type QuotaAccessor struct {
+	// Conflict returns true if the update of the quota at the given resource version must fail with a conflict
+	// although it is up to date.  Nil injects no conflict.
+	Conflict func(name, resourceVersion string) bool
+	// Latency returns how long a lookup or an update takes.  Nil adds no latency.
+	Latency func() time.Duration
+
+	lock sync.Mutex
+	// quotas holds the quotas by name
+	quotas map[string]*corev1.ResourceQuota
+	// namespaceQuotas holds the names of the quotas selecting every namespace
+	namespaceQuotas map[string]sets.Set[string]
+	resourceVersion int64
+
+	gets      atomic.Int64
+	updates   atomic.Int64
+	conflicts atomic.Int64
+}
+
+// Stats counts the calls served by a QuotaAccessor.
+type Stats struct {
+	// Gets is the number of quota lookups
+	Gets int64
+	// Updates is the number of successful status updates
+	Updates int64
+	// Conflicts is the number of status updates rejected with a conflict, injected or not
+	Conflicts int64
+}
+
+// NewQuotaAccessor returns an accessor without quotas.
+func NewQuotaAccessor() *QuotaAccessor {
+	return &QuotaAccessor{
+		quotas:          map[string]*corev1.ResourceQuota{},
+		namespaceQuotas: map[string]sets.Set[string]{},
+	}
+}
+
+// AddQuota adds a quota enforcing hard in the given namespaces, with no usage.
+func (a *QuotaAccessor) AddQuota(name string, hard corev1.ResourceList, namespaces ...string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.resourceVersion++
+	resourceQuota := &corev1.ResourceQuota{}
+	resourceQuota.APIVersion = quotav1.GroupVersion.String()
+	resourceQuota.Name = name
+	resourceQuota.UID = types.UID(name)
+	resourceQuota.ResourceVersion = strconv.FormatInt(a.resourceVersion, 10)
+	resourceQuota.Spec.Hard = hard.DeepCopy()
+	resourceQuota.Status.Hard = hard.DeepCopy()
+	// the controller reports a zero usage for every resource it calculated, quotas without usage are not enforced
+	resourceQuota.Status.Used = corev1.ResourceList{}
+	for resourceName := range hard {
+		resourceQuota.Status.Used[resourceName] = resource.Quantity{Format: hard[resourceName].Format}
+	}
+	a.quotas[name] = resourceQuota
+	for _, namespace := range namespaces {
+		if a.namespaceQuotas[namespace] == nil {
+			a.namespaceQuotas[namespace] = sets.New[string]()
+		}
+		a.namespaceQuotas[namespace].Insert(name)
+	}
+}
+
+// Quota returns a copy of the quota, false if it does not exist.
+func (a *QuotaAccessor) Quota(name string) (corev1.ResourceQuota, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	resourceQuota, found := a.quotas[name]
+	if !found {
+		return corev1.ResourceQuota{}, false
+	}
+	return *resourceQuota.DeepCopy(), true
+}
+
+// QuotaNames returns the names of the quotas, sorted.
+func (a *QuotaAccessor) QuotaNames() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	names := make([]string, 0, len(a.quotas))
+	for name := range a.quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Selects returns true if the quota selects the namespace.
+func (a *QuotaAccessor) Selects(name, namespace string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.namespaceQuotas[namespace].Has(name)
+}
+
+// Stats returns the calls served so far.
+func (a *QuotaAccessor) Stats() Stats {
+	return Stats{
+		Gets:      a.gets.Load(),
+		Updates:   a.updates.Load(),
+		Conflicts: a.conflicts.Load(),
+	}
+}
+
+// GetQuotas returns the quotas selecting the namespace, sorted by name.
+func (a *QuotaAccessor) GetQuotas(ctx context.Context, namespace string) ([]corev1.ResourceQuota, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	a.gets.Add(1)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	names := sets.List(a.namespaceQuotas[namespace])
+	result := make([]corev1.ResourceQuota, 0, len(names))
+	for _, name := range names {
+		resourceQuota := a.quotas[name].DeepCopy()
+		resourceQuota.Namespace = namespace
+		result = append(result, *resourceQuota)
+	}
+	return result, nil
+}
+
+// UpdateQuotaStatus stores the usage of the quota if it is based on the current resource version.  The usage is
+// stored whole, the reservations are ignored.
+func (a *QuotaAccessor) UpdateQuotaStatus(ctx context.Context, newQuota *corev1.ResourceQuota, _ []quotav1.Reservation) error {
+	if err := a.wait(ctx); err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	resourceQuota, found := a.quotas[newQuota.Name]
+	if !found {
+		return apierrors.NewNotFound(quotav1.GroupVersion.WithResource("sharedquotas").GroupResource(), newQuota.Name)
+	}
+	if resourceQuota.ResourceVersion != newQuota.ResourceVersion ||
+		(a.Conflict != nil && a.Conflict(newQuota.Name, newQuota.ResourceVersion)) {
+		a.conflicts.Add(1)
+		return apierrors.NewConflict(quotav1.GroupVersion.WithResource("sharedquotas").GroupResource(), newQuota.Name,
+			errors.New("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	a.resourceVersion++
+	resourceQuota.ResourceVersion = strconv.FormatInt(a.resourceVersion, 10)
+	resourceQuota.Status.Used = newQuota.Status.Used.DeepCopy()
+	a.updates.Add(1)
+	return nil
+}
+
+// wait sleeps for the injected latency, it returns early once ctx is done.
+func (a *QuotaAccessor) wait(ctx context.Context) error {
+	if a.Latency == nil {
+		return ctx.Err()
+	}
+	latency := a.Latency()
+	if latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// forwardPath serves admission requests forwarded by other replicas, they are never forwarded again.
+	forwardPath = "/forward-quota-caih-com-v1"
+	// forwardTimeout leaves the owner enough time to evaluate within the apiserver's webhook timeout.
+	forwardTimeout = 8 * time.Second
+)
+
+// OwnerForwarder sends admission requests to the replica that owns the quotas of the namespace.  A replica owns a
+// quota while it holds its sticky lease, which it renews while it evaluates the quota.  Requests are evaluated
+// locally when the quota has no owner, or when the owner cannot be reached, in which case the lease still serializes
+// the evaluation once the owner's lease expires.
+type OwnerForwarder struct {
+	locks *LeaseLockFactory
+	// identity is the address of this replica
+	identity string
+	client   *http.Client
+}
+
+// NewOwnerForwarder returns a forwarder that looks up owners in the sticky leases of locks and connects to them
+// with the given TLS configuration.  The identity of locks must be the host:port the replica serves webhooks on.
+// tlsConfig verifies the owner with the CA and the name of the webhook certificate, and presents the webhook
+// certificate to the owner, see authenticateReplicas.
+func NewOwnerForwarder(locks *LeaseLockFactory, tlsConfig *tls.Config) (*OwnerForwarder, error) {
+	if !locks.sticky {
+		return nil, fmt.Errorf("forwarding to quota owners requires sticky leases")
+	}
+	if tlsConfig == nil || tlsConfig.RootCAs == nil || len(tlsConfig.ServerName) == 0 {
+		return nil, fmt.Errorf("forwarding to quota owners requires the CA and the name of the webhook certificate")
+	}
+	if len(tlsConfig.Certificates) == 0 && tlsConfig.GetClientCertificate == nil {
+		return nil, fmt.Errorf("forwarding to quota owners requires the webhook certificate as client certificate")
+	}
+	return &OwnerForwarder{
+		locks:    locks,
+		identity: locks.identity,
+		client: &http.Client{
+			Timeout:   forwardTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Forward sends the request to the owner of the first quota.  It returns false if the request must be evaluated
+// locally.
+func (f *OwnerForwarder) Forward(ctx context.Context, req webhook.AdmissionRequest, quotas []corev1.ResourceQuota) (webhook.AdmissionResponse, bool) {
+	if len(quotas) == 0 {
+		return webhook.AdmissionResponse{}, false
+	}
+	// the owner of the first quota in lock order evaluates all of them, it acquires the leases of the
+	// remaining quotas the same way as without forwarding
+	sorted := make([]corev1.ResourceQuota, len(quotas))
+	copy(sorted, quotas)
+	sort.Sort(ByName(sorted))
+	owner, err := f.locks.Holder(ctx, string(sorted[0].UID))
+	if err != nil {
+		klog.Errorf("failed to get owner of quota %s: %v", sorted[0].Name, err)
+		return webhook.AdmissionResponse{}, false
+	}
+	if len(owner) == 0 || owner == f.identity {
+		return webhook.AdmissionResponse{}, false
+	}
+	resp, err := f.forward(ctx, owner, req)
+	if err != nil {
+		klog.Errorf("failed to forward admission request %s to quota owner %s: %v", req.UID, owner, err)
+		return webhook.AdmissionResponse{}, false
+	}
+	return resp, true
+}
+
+func (f *OwnerForwarder) forward(ctx context.Context, owner string, req webhook.AdmissionRequest) (webhook.AdmissionResponse, error) {
+	review := admissionv1.AdmissionReview{Request: &req.AdmissionRequest}
+	review.SetGroupVersionKind(admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"))
+	body, err := json.Marshal(review)
+	if err != nil {
+		return webhook.AdmissionResponse{}, err
+	}
+	// the owner abandons the request when this replica does
+	url := "https://" + owner + forwardPath
+	if timeout, ok := remainingTimeout(ctx); ok {
+		url += "?timeout=" + timeout
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return webhook.AdmissionResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := f.client.Do(httpReq)
+	if err != nil {
+		return webhook.AdmissionResponse{}, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return webhook.AdmissionResponse{}, fmt.Errorf("unexpected status %s", httpResp.Status)
+	}
+	reviewResp := admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(httpResp.Body).Decode(&reviewResp); err != nil {
+		return webhook.AdmissionResponse{}, err
+	}
+	if reviewResp.Response == nil {
+		return webhook.AdmissionResponse{}, fmt.Errorf("empty admission response")
+	}
+	return webhook.AdmissionResponse{AdmissionResponse: *reviewResp.Response}, nil
+}
+
+// authenticateReplicas only passes requests to handler from other replicas: the request must come with a client
+// certificate issued by the CA of the webhook certificate for the name of the webhook certificate, as configured in
+// tlsConfig.  Replicas present their webhook certificate, the webhook server only needs to request it.
+func authenticateReplicas(handler http.Handler, tlsConfig *tls.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifyReplica(r.TLS, tlsConfig); err != nil {
+			klog.V(2).Infof("rejected forwarded admission request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "forwarded admission requests are only accepted from webhook replicas", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// verifyReplica returns an error unless the peer of the connection presented a certificate of a replica.
+func verifyReplica(state *tls.ConnectionState, tlsConfig *tls.Config) error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no client certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         tlsConfig.RootCAs,
+		Intermediates: intermediates,
+		DNSName:       tlsConfig.ServerName,
+		// the serving certificate of the webhook is used as client certificate
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+// forwardedAdmission evaluates requests forwarded by other replicas.
+type forwardedAdmission struct {
+	admission *SharedQuotaAdmission
+}
+
+func (f *forwardedAdmission) Handle(ctx context.Context, req webhook.AdmissionRequest) webhook.AdmissionResponse {
+	return f.admission.handle(ctx, req, false)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const webhookServiceName = "sharedquota-webhook.kube-system.svc"
+
+// newCertificate returns a certificate for dnsName issued by issuer, or a self-signed CA if issuer is nil.
+func newCertificate(t *testing.T, dnsName string, issuer *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	parent, parentKey := template, any(key)
+	if issuer == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{dnsName}
+		parent, parentKey = issuer.Leaf, issuer.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestForwardAuthentication(t *testing.T) {
+	ca := newCertificate(t, "webhook-ca", nil)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Leaf)
+	otherCA := newCertificate(t, "other-ca", nil)
+
+	// replicas serve and forward with the webhook certificate
+	replicaCert := newCertificate(t, webhookServiceName, &ca)
+	serverTLSConfig := &tls.Config{RootCAs: rootCAs, ServerName: webhookServiceName}
+	handled := false
+	server := httptest.NewUnstartedServer(authenticateReplicas(&webhook.Admission{
+		Handler: admission.HandlerFunc(func(context.Context, admission.Request) admission.Response {
+			handled = true
+			return webhook.Allowed("evaluated by the owner")
+		}),
+	}, serverTLSConfig))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{replicaCert}, ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	testCases := map[string]struct {
+		clientCerts []tls.Certificate
+		expectErr   bool
+	}{
+		"replica": {
+			clientCerts: []tls.Certificate{replicaCert},
+		},
+		"no client certificate": {
+			expectErr: true,
+		},
+		"certificate of another CA": {
+			clientCerts: []tls.Certificate{newCertificate(t, webhookServiceName, &otherCA)},
+			expectErr:   true,
+		},
+		"certificate for another name": {
+			clientCerts: []tls.Certificate{newCertificate(t, "tenant.example.com", &ca)},
+			expectErr:   true,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handled = false
+			forwarder := &OwnerForwarder{client: &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      rootCAs,
+				ServerName:   webhookServiceName,
+				Certificates: testCase.clientCerts,
+			}}}}
+			req := webhook.AdmissionRequest{AdmissionRequest: admissionv1.AdmissionRequest{UID: "request"}}
+			resp, err := forwarder.forward(context.Background(), server.Listener.Addr().String(), req)
+			if testCase.expectErr {
+				if err == nil {
+					t.Errorf("expected the forwarded request to be rejected")
+				}
+				if handled {
+					t.Errorf("expected the forwarded request not to be evaluated")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !handled || !resp.Allowed || resp.UID != "request" {
+				t.Errorf("expected the request to be evaluated by the owner, got %+v", resp.AdmissionResponse)
+			}
+		})
+	}
+}
+
+func TestNewOwnerForwarderRequiresReplicaCertificates(t *testing.T) {
+	ca := newCertificate(t, "webhook-ca", nil)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Leaf)
+	clientCert := newCertificate(t, webhookServiceName, &ca)
+
+	testCases := map[string]struct {
+		tlsConfig *tls.Config
+		expectErr bool
+	}{
+		"no TLS configuration":  {expectErr: true},
+		"no CA":                 {tlsConfig: &tls.Config{ServerName: webhookServiceName, Certificates: []tls.Certificate{clientCert}}, expectErr: true},
+		"no server name":        {tlsConfig: &tls.Config{RootCAs: rootCAs, Certificates: []tls.Certificate{clientCert}}, expectErr: true},
+		"no client certificate": {tlsConfig: &tls.Config{RootCAs: rootCAs, ServerName: webhookServiceName}, expectErr: true},
+		"client certificate":    {tlsConfig: &tls.Config{RootCAs: rootCAs, ServerName: webhookServiceName, Certificates: []tls.Certificate{clientCert}}},
+		"client certificate getter": {tlsConfig: &tls.Config{RootCAs: rootCAs, ServerName: webhookServiceName,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &clientCert, nil }}},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewOwnerForwarder(&LeaseLockFactory{sticky: true, identity: "10.0.0.1:9443"}, testCase.tlsConfig)
+			if (err != nil) != testCase.expectErr {
+				t.Errorf("expected error %v, got %v", testCase.expectErr, err)
+			}
+		})
+	}
+}
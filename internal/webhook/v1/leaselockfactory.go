@@ -0,0 +1,397 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultLeaseDuration is how long a quota lease is valid without being renewed.  A replica that dies while
+	// holding a lease blocks the quota for at most this long, a live replica renews it while evaluating.
+	DefaultLeaseDuration = 5 * time.Second
+	// defaultLeaseRetryPeriod is how long to wait before trying again to acquire a lease held by another replica.
+	defaultLeaseRetryPeriod = 50 * time.Millisecond
+
+	leaseNamePrefix = "sharedquota-"
+)
+
+// LeaseLockFactory hands out locks backed by coordination.k8s.io Leases, one per quota, so that webhook replicas
+// serialize the evaluation of a quota across the cluster instead of racing on its status.
+//
+// A replica keeps the lease of a quota across admissions: it acquires the lease once, renews it while it is used and
+// releases it once no admission locked the quota for a renewal period.  Admissions only take an in-process lock per
+// quota, and never write the lease while it is held.
+type LeaseLockFactory struct {
+	// writes leases
+	client client.Client
+	// reads leases, must not be a cache since leases change on every admission
+	reader    client.Reader
+	namespace string
+	// identity is the holder identity written to leases, it must be unique per replica
+	identity      string
+	leaseDuration time.Duration
+	retryPeriod   time.Duration
+	// sticky keeps idle leases until they expire instead of releasing them, so the replica remains the owner of the
+	// quota
+	sticky bool
+	clock  clock.Clock
+	local  *DefaultLockFactory
+
+	lock sync.Mutex
+	// held are the leases held by this replica by name
+	held map[string]*heldLease
+}
+
+// heldLease is a lease held by this replica.  It is renewed until it is lost, or until it is idle.
+type heldLease struct {
+	// ctx is cancelled once the lease is lost, released or forgotten
+	ctx    context.Context
+	cancel context.CancelFunc
+	// resourceVersion is the version of the lease last written by this replica, a lease written by anyone else since
+	// is lost.  It is only accessed by the acquisition and then by the renewal.
+	resourceVersion string
+	// inUse is set while an admission holds the lock of the lease, lastUsed is when the last one unlocked it.  Both
+	// are guarded by the lock of the factory.
+	inUse    bool
+	lastUsed time.Time
+}
+
+// LeaseLockFactoryOptions configures a LeaseLockFactory.
+type LeaseLockFactoryOptions struct {
+	// Namespace the leases are created in.
+	Namespace string
+	// Identity is the holder identity of this replica.
+	Identity string
+	// LeaseDuration defaults to DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// Sticky keeps idle leases until they expire, see OwnerForwarder.
+	Sticky bool
+}
+
+// NewLeaseLockFactory returns a LockFactory that locks quotas with Leases.
+func NewLeaseLockFactory(c client.Client, reader client.Reader, opts LeaseLockFactoryOptions) (*LeaseLockFactory, error) {
+	if len(opts.Namespace) == 0 || len(opts.Identity) == 0 {
+		return nil, fmt.Errorf("lease lock requires a namespace and an identity")
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
+	if opts.LeaseDuration < time.Second {
+		return nil, fmt.Errorf("lease duration must be at least 1s, got %v", opts.LeaseDuration)
+	}
+	return &LeaseLockFactory{
+		client:        c,
+		reader:        reader,
+		namespace:     opts.Namespace,
+		identity:      opts.Identity,
+		leaseDuration: opts.LeaseDuration,
+		retryPeriod:   defaultLeaseRetryPeriod,
+		sticky:        opts.Sticky,
+		clock:         clock.RealClock{},
+		local:         NewDefaultLockFactory(),
+		held:          map[string]*heldLease{},
+	}, nil
+}
+
+// GetLock returns the lock of the quota with the given UID, it implements ContextLocker.
+func (f *LeaseLockFactory) GetLock(key string) sync.Locker {
+	return &leaseLock{factory: f, name: leaseNamePrefix + key, local: f.local.GetLock(key)}
+}
+
+// Forget deletes the lease of the deleted quota with the given UID.
+func (f *LeaseLockFactory) Forget(key string) {
+	f.lock.Lock()
+	if held, found := f.held[leaseNamePrefix+key]; found {
+		delete(f.held, leaseNamePrefix+key)
+		held.cancel()
+	}
+	f.lock.Unlock()
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: f.namespace, Name: leaseNamePrefix + key}}
+	if err := f.client.Delete(context.Background(), lease); client.IgnoreNotFound(err) != nil {
+		klog.Errorf("failed to delete lease %s/%s: %v", f.namespace, lease.Name, err)
+	}
+}
+
+// Holder returns the identity of the replica currently holding the lease of the quota with the given UID, or an
+// empty string if the lease is free or expired.
+func (f *LeaseLockFactory) Holder(ctx context.Context, key string) (string, error) {
+	lease := &coordinationv1.Lease{}
+	if err := f.reader.Get(ctx, types.NamespacedName{Namespace: f.namespace, Name: leaseNamePrefix + key}, lease); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	if f.expired(lease) {
+		return "", nil
+	}
+	return ptr.Deref(lease.Spec.HolderIdentity, ""), nil
+}
+
+// expired returns true if the lease is not held or was not renewed in time.
+func (f *LeaseLockFactory) expired(lease *coordinationv1.Lease) bool {
+	if len(ptr.Deref(lease.Spec.HolderIdentity, "")) == 0 || lease.Spec.RenewTime == nil {
+		return true
+	}
+	duration := time.Duration(ptr.Deref(lease.Spec.LeaseDurationSeconds, 0)) * time.Second
+	return !lease.Spec.RenewTime.Add(duration).After(f.clock.Now())
+}
+
+// leaseLock is a ContextLocker holding a Lease while locked.  LockContext blocks until the lease is acquired, unless
+// the replica already holds it; it takes over leases whose holder did not renew them in time, so it never waits on a
+// dead replica for longer than the lease duration.  The context of the lock is cancelled once the lease is lost.
+type leaseLock struct {
+	factory *LeaseLockFactory
+	name    string
+	local   sync.Locker
+	// lease is the lease held while locked, stop and cancel stop tying the context of the lock to it
+	lease  *heldLease
+	stop   func() bool
+	cancel context.CancelFunc
+}
+
+// Lock blocks until the lease is acquired, callers that can give up use LockContext.
+func (l *leaseLock) Lock() {
+	_, _ = l.LockContext(context.Background())
+}
+
+func (l *leaseLock) LockContext(ctx context.Context) (context.Context, error) {
+	if err := lockContext(ctx, l.local); err != nil {
+		return nil, err
+	}
+	lease, err := l.factory.hold(ctx, l.name)
+	if err != nil {
+		l.local.Unlock()
+		return nil, err
+	}
+	heldCtx, cancel := context.WithCancel(ctx)
+	l.lease, l.cancel, l.stop = lease, cancel, context.AfterFunc(lease.ctx, cancel)
+	return heldCtx, nil
+}
+
+func (l *leaseLock) Unlock() {
+	defer l.local.Unlock()
+	if l.lease == nil {
+		return
+	}
+	l.stop()
+	l.cancel()
+	f := l.factory
+	f.lock.Lock()
+	l.lease.inUse = false
+	l.lease.lastUsed = f.clock.Now()
+	f.lock.Unlock()
+	l.lease = nil
+}
+
+// hold returns the lease of the given name marked in use, acquiring it unless this replica already holds it.  The
+// caller holds the in-process lock of the lease.
+func (f *LeaseLockFactory) hold(ctx context.Context, name string) (*heldLease, error) {
+	f.lock.Lock()
+	if held, found := f.held[name]; found && held.ctx.Err() == nil {
+		held.inUse = true
+		f.lock.Unlock()
+		return held, nil
+	}
+	f.lock.Unlock()
+
+	var resourceVersion string
+	err := wait.PollUntilContextCancel(ctx, f.retryPeriod, true, func(ctx context.Context) (bool, error) {
+		var acquired bool
+		var err error
+		acquired, resourceVersion, err = f.tryAcquire(ctx, name)
+		if err != nil {
+			klog.Errorf("failed to acquire lease %s/%s: %v", f.namespace, name, err)
+		}
+		return acquired, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lease %s/%s: %w", f.namespace, name, err)
+	}
+	held := &heldLease{resourceVersion: resourceVersion, inUse: true}
+	held.ctx, held.cancel = context.WithCancel(context.Background())
+	f.lock.Lock()
+	f.held[name] = held
+	f.lock.Unlock()
+	go f.renew(name, held)
+	return held, nil
+}
+
+// drop forgets the held lease unless it was replaced, and cancels it.
+func (f *LeaseLockFactory) drop(name string, held *heldLease) {
+	f.lock.Lock()
+	if f.held[name] == held {
+		delete(f.held, name)
+	}
+	f.lock.Unlock()
+	held.cancel()
+}
+
+// renew renews the lease every third of the lease duration until it is cancelled.  The lease is lost once another
+// replica wrote it or it was not renewed within two thirds of the lease duration, before other replicas may consider
+// it expired.  A lease that no admission locked for a renewal period is released, or left to expire if sticky.
+func (f *LeaseLockFactory) renew(name string, held *heldLease) {
+	renewPeriod := f.leaseDuration / 3
+	renewTime := f.clock.Now()
+	for {
+		select {
+		case <-held.ctx.Done():
+			return
+		case <-f.clock.After(renewPeriod):
+		}
+		f.lock.Lock()
+		idle := !held.inUse && f.clock.Since(held.lastUsed) >= renewPeriod
+		if idle && f.held[name] == held {
+			delete(f.held, name)
+		}
+		f.lock.Unlock()
+		if idle {
+			held.cancel()
+			if !f.sticky {
+				f.releaseIdle(name, held)
+			}
+			return
+		}
+
+		renewed, err := f.tryRenew(held.ctx, name, held)
+		if held.ctx.Err() != nil {
+			return
+		}
+		switch {
+		case renewed:
+			renewTime = f.clock.Now()
+			continue
+		case err == nil:
+			klog.Errorf("lost lease %s/%s to another replica", f.namespace, name)
+		case f.clock.Since(renewTime) < 2*renewPeriod:
+			klog.Errorf("failed to renew lease %s/%s: %v", f.namespace, name, err)
+			continue
+		default:
+			klog.Errorf("lost lease %s/%s, failed to renew it in time: %v", f.namespace, name, err)
+		}
+		f.drop(name, held)
+		return
+	}
+}
+
+// releaseIdle releases the idle lease, which expires on its own if it cannot be released.
+func (f *LeaseLockFactory) releaseIdle(name string, held *heldLease) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.leaseDuration)
+	defer cancel()
+	if err := f.release(ctx, name, held); err != nil {
+		klog.Errorf("failed to release lease %s/%s: %v", f.namespace, name, err)
+	}
+}
+
+// tryAcquire creates or takes over the lease, or renews it if this replica already holds it.  It returns the version
+// of the acquired lease.
+func (f *LeaseLockFactory) tryAcquire(ctx context.Context, name string) (bool, string, error) {
+	now := metav1.NewMicroTime(f.clock.Now())
+	lease := &coordinationv1.Lease{}
+	err := f.reader.Get(ctx, types.NamespacedName{Namespace: f.namespace, Name: name}, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: f.namespace, Name: name},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(f.identity),
+				LeaseDurationSeconds: ptr.To(int32(f.leaseDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if err := f.client.Create(ctx, lease); err != nil {
+			return false, "", client.IgnoreAlreadyExists(err)
+		}
+		return true, lease.ResourceVersion, nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if holder != f.identity {
+		if !f.expired(lease) {
+			return false, "", nil
+		}
+		lease.Spec.HolderIdentity = ptr.To(f.identity)
+		lease.Spec.AcquireTime = &now
+		lease.Spec.LeaseTransitions = ptr.To(ptr.Deref(lease.Spec.LeaseTransitions, 0) + 1)
+	}
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(f.leaseDuration.Seconds()))
+	lease.Spec.RenewTime = &now
+	// the update fails with a conflict if another replica acquired the lease in the meantime
+	if err := f.client.Update(ctx, lease); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	return true, lease.ResourceVersion, nil
+}
+
+// tryRenew renews the lease if it is still held: no one wrote it since this replica did.
+func (f *LeaseLockFactory) tryRenew(ctx context.Context, name string, held *heldLease) (bool, error) {
+	lease := &coordinationv1.Lease{}
+	if err := f.reader.Get(ctx, types.NamespacedName{Namespace: f.namespace, Name: name}, lease); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != f.identity || lease.ResourceVersion != held.resourceVersion {
+		return false, nil
+	}
+	lease.Spec.RenewTime = ptr.To(metav1.NewMicroTime(f.clock.Now()))
+	if err := f.client.Update(ctx, lease); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	held.resourceVersion = lease.ResourceVersion
+	return true, nil
+}
+
+// release gives up the lease if it is still held, the update fails with a conflict if the lease was acquired again
+// since.
+func (f *LeaseLockFactory) release(ctx context.Context, name string, held *heldLease) error {
+	lease := &coordinationv1.Lease{}
+	if err := f.reader.Get(ctx, types.NamespacedName{Namespace: f.namespace, Name: name}, lease); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != f.identity || lease.ResourceVersion != held.resourceVersion {
+		return nil
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	return client.IgnoreNotFound(f.client.Update(ctx, lease))
+}
+
+var _ LockFactory = &LeaseLockFactory{}
+
+var _ ContextLocker = &leaseLock{}
@@ -0,0 +1,326 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	testingclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const leaseNamespace = "kube-system"
+
+func newTestLeaseLockFactory(t *testing.T, c client.Client, identity string, fakeClock *testingclock.FakeClock, sticky bool) *LeaseLockFactory {
+	t.Helper()
+	factory, err := NewLeaseLockFactory(c, c, LeaseLockFactoryOptions{Namespace: leaseNamespace, Identity: identity, Sticky: sticky})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	factory.clock = fakeClock
+	factory.retryPeriod = time.Millisecond
+	return factory
+}
+
+func getLease(t *testing.T, c client.Client, key string) *coordinationv1.Lease {
+	t.Helper()
+	lease := &coordinationv1.Lease{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: leaseNamespace, Name: leaseNamePrefix + key}, lease); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return lease
+}
+
+func lockLease(t *testing.T, factory *LeaseLockFactory, key string, timeout time.Duration) (ContextLocker, context.Context, error) {
+	t.Helper()
+	lock := factory.GetLock(key).(ContextLocker)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.Cleanup(cancel)
+	heldCtx, err := lock.LockContext(ctx)
+	return lock, heldCtx, err
+}
+
+// eventually fails the test unless condition becomes true within a second.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	if err := wait.PollUntilContextTimeout(context.Background(), time.Millisecond, time.Second, true,
+		func(context.Context) (bool, error) { return condition(), nil }); err != nil {
+		t.Fatalf("condition not met: %v", err)
+	}
+}
+
+func TestLeaseLockAcquireAndRelease(t *testing.T) {
+	testCases := map[string]struct {
+		sticky         bool
+		expectedHolder string
+	}{
+		"released once idle": {expectedHolder: ""},
+		"kept while sticky":  {sticky: true, expectedHolder: "replica-a"},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var writes atomic.Int32
+			c := clientfake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					writes.Add(1)
+					return c.Create(ctx, obj, opts...)
+				},
+				Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+					writes.Add(1)
+					return c.Update(ctx, obj, opts...)
+				},
+			}).Build()
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			factory := newTestLeaseLockFactory(t, c, "replica-a", fakeClock, testCase.sticky)
+
+			lock, heldCtx, err := lockLease(t, factory, "quota", time.Second)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			lease := getLease(t, c, "quota")
+			if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != "replica-a" {
+				t.Errorf("expected the lease to be held by replica-a, got %q", holder)
+			}
+			if duration := ptr.Deref(lease.Spec.LeaseDurationSeconds, 0); duration != int32(DefaultLeaseDuration.Seconds()) {
+				t.Errorf("expected lease duration %v, got %ds", DefaultLeaseDuration, duration)
+			}
+			lock.Unlock()
+			if heldCtx.Err() == nil {
+				t.Errorf("expected the context of the lock to be cancelled once unlocked")
+			}
+
+			// the lease is kept across admissions without being written
+			for i := 0; i < 3; i++ {
+				lock, _, err := lockLease(t, factory, "quota", time.Second)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				lock.Unlock()
+			}
+			if count := writes.Load(); count != 1 {
+				t.Errorf("expected the lease to be written once, got %d writes", count)
+			}
+			if holder, _ := factory.Holder(context.Background(), "quota"); holder != "replica-a" {
+				t.Errorf("expected the lease to be held by replica-a while used, got %q", holder)
+			}
+
+			// the lease is idle once not locked for a renewal period
+			eventually(t, fakeClock.HasWaiters)
+			fakeClock.Step(DefaultLeaseDuration / 3)
+			eventually(t, func() bool {
+				factory.lock.Lock()
+				defer factory.lock.Unlock()
+				return len(factory.held) == 0
+			})
+			eventually(t, func() bool {
+				holder, err := factory.Holder(context.Background(), "quota")
+				return err == nil && holder == testCase.expectedHolder
+			})
+		})
+	}
+}
+
+func TestLeaseLockExpiry(t *testing.T) {
+	c := clientfake.NewClientBuilder().Build()
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	factory := newTestLeaseLockFactory(t, c, "replica-a", fakeClock, true)
+
+	lock, _, err := lockLease(t, factory, "quota", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lock.Unlock()
+
+	fakeClock.Step(DefaultLeaseDuration - time.Millisecond)
+	if holder, _ := factory.Holder(context.Background(), "quota"); holder != "replica-a" {
+		t.Errorf("expected the lease to be held by replica-a until it expires, got %q", holder)
+	}
+	fakeClock.Step(time.Millisecond)
+	if holder, _ := factory.Holder(context.Background(), "quota"); holder != "" {
+		t.Errorf("expected the lease to expire, got holder %q", holder)
+	}
+}
+
+func TestLeaseLockTakeover(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	// replica-b died while holding the lease
+	c := clientfake.NewClientBuilder().WithObjects(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: leaseNamespace, Name: leaseNamePrefix + "quota"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("replica-b"),
+			LeaseDurationSeconds: ptr.To(int32(DefaultLeaseDuration.Seconds())),
+			RenewTime:            ptr.To(metav1.NewMicroTime(fakeClock.Now())),
+		},
+	}).Build()
+	factory := newTestLeaseLockFactory(t, c, "replica-a", fakeClock, false)
+
+	if _, _, err := lockLease(t, factory, "quota", 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the acquisition to give up with the context, got %v", err)
+	}
+	if holder := ptr.Deref(getLease(t, c, "quota").Spec.HolderIdentity, ""); holder != "replica-b" {
+		t.Errorf("expected the lease to be held by replica-b, got %q", holder)
+	}
+
+	fakeClock.Step(DefaultLeaseDuration)
+	lock, _, err := lockLease(t, factory, "quota", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lock.Unlock()
+	lease := getLease(t, c, "quota")
+	if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != "replica-a" {
+		t.Errorf("expected the lease to be taken over by replica-a, got %q", holder)
+	}
+	if transitions := ptr.Deref(lease.Spec.LeaseTransitions, 0); transitions != 1 {
+		t.Errorf("expected 1 lease transition, got %d", transitions)
+	}
+}
+
+func TestLeaseLockAbandonedWithinReplica(t *testing.T) {
+	c := clientfake.NewClientBuilder().Build()
+	factory := newTestLeaseLockFactory(t, c, "replica-a", testingclock.NewFakeClock(time.Now()), false)
+
+	first, _, err := lockLease(t, factory, "quota", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := lockLease(t, factory, "quota", 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the acquisition to give up with the context, got %v", err)
+	}
+	first.Unlock()
+	// the abandoned acquisition does not keep the lock
+	third, _, err := lockLease(t, factory, "quota", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	third.Unlock()
+}
+
+func TestLeaseLockRenewal(t *testing.T) {
+	testCases := map[string]struct {
+		// update changes the lease after it was acquired
+		update func(t *testing.T, c client.Client)
+		// failRenewal fails the reads of the lease after it was acquired
+		failRenewal bool
+		// steps is the number of renewal periods the clock is stepped by
+		steps        int
+		expectedLost bool
+	}{
+		"renewed": {
+			steps: 3,
+		},
+		"taken over": {
+			update: func(t *testing.T, c client.Client) {
+				lease := getLease(t, c, "quota")
+				lease.Spec.HolderIdentity = ptr.To("replica-b")
+				if err := c.Update(context.Background(), lease); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			},
+			steps:        1,
+			expectedLost: true,
+		},
+		"written by another replica": {
+			update: func(t *testing.T, c client.Client) {
+				lease := getLease(t, c, "quota")
+				lease.Spec.LeaseTransitions = ptr.To(int32(1))
+				if err := c.Update(context.Background(), lease); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			},
+			steps:        1,
+			expectedLost: true,
+		},
+		"deleted": {
+			update: func(t *testing.T, c client.Client) {
+				if err := c.Delete(context.Background(), getLease(t, c, "quota")); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			},
+			steps:        1,
+			expectedLost: true,
+		},
+		"renewal failed once": {
+			failRenewal: true,
+			steps:       1,
+		},
+		"renewal failed until the deadline": {
+			failRenewal:  true,
+			steps:        2,
+			expectedLost: true,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var failGet atomic.Bool
+			c := clientfake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if failGet.Load() {
+						return apierrors.NewServiceUnavailable("unavailable")
+					}
+					return c.Get(ctx, key, obj, opts...)
+				},
+			}).Build()
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			factory := newTestLeaseLockFactory(t, c, "replica-a", fakeClock, false)
+
+			lock, heldCtx, err := lockLease(t, factory, "quota", time.Minute)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if testCase.update != nil {
+				testCase.update(t, c)
+			}
+			failGet.Store(testCase.failRenewal)
+			resourceVersion := ""
+			if !testCase.failRenewal && testCase.update == nil {
+				resourceVersion = getLease(t, c, "quota").ResourceVersion
+			}
+
+			for i := 0; i < testCase.steps; i++ {
+				eventually(t, func() bool { return fakeClock.HasWaiters() || heldCtx.Err() != nil })
+				fakeClock.Step(DefaultLeaseDuration / 3)
+			}
+			if testCase.expectedLost {
+				eventually(t, func() bool { return heldCtx.Err() != nil })
+			} else {
+				// the renewal completed once the next one is scheduled
+				eventually(t, fakeClock.HasWaiters)
+				if heldCtx.Err() != nil {
+					t.Errorf("expected the lease to be held, got %v", heldCtx.Err())
+				}
+			}
+			failGet.Store(false)
+			if len(resourceVersion) > 0 && getLease(t, c, "quota").ResourceVersion == resourceVersion {
+				t.Errorf("expected the lease to be renewed")
+			}
+			lock.Unlock()
+		})
+	}
+}
@@ -6,41 +6,121 @@
 package v1
 
 import (
+	"context"
 	"sync"
 )
 
 // Following code copied from github.com/openshift/apiserver-library-go/pkg/admission/quota/clusterresourcequota
+
+// LockFactory returns the lock serializing the evaluation of the quota with the given UID.
 type LockFactory interface {
 	GetLock(string) sync.Locker
+	// Forget releases what is kept for the quota with the given UID once the quota is deleted.
+	Forget(string)
+}
+
+// ContextLocker is a lock whose acquisition is bounded by a context.  Locks handed out by a LockFactory implement it
+// when they can give up waiting, or can be lost while held.
+type ContextLocker interface {
+	sync.Locker
+	// LockContext blocks until the lock is acquired or ctx is done, in which case it returns the error of ctx and
+	// the lock is not held.  The returned context is derived from ctx and is cancelled once the lock is lost.
+	LockContext(ctx context.Context) (context.Context, error)
 }
 
+// lockContext acquires lock unless ctx is done first.  An acquisition abandoned with ctx is unlocked as soon as
+// it completes.
+func lockContext(ctx context.Context, lock sync.Locker) error {
+	locked := make(chan struct{})
+	go func() {
+		lock.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			lock.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// DefaultLockFactory serializes evaluations within the process.  Its entries are reference counted by the
+// callers holding or waiting for a lock and removed as soon as the last one unlocks, so the factory only
+// keeps the locks of quotas being evaluated.
 type DefaultLockFactory struct {
-	lock sync.RWMutex
+	lock sync.Mutex
 
-	locks map[string]sync.Locker
+	locks map[string]*refCountedLock
+}
+
+type refCountedLock struct {
+	sync.Mutex
+	// refs is the number of callers holding or waiting for the lock, guarded by DefaultLockFactory.lock
+	refs int
 }
 
 func NewDefaultLockFactory() *DefaultLockFactory {
-	return &DefaultLockFactory{locks: map[string]sync.Locker{}}
+	return &DefaultLockFactory{locks: map[string]*refCountedLock{}}
 }
 
+// GetLock returns the lock of the key.  Lockers returned for the same key exclude each other.
 func (f *DefaultLockFactory) GetLock(key string) sync.Locker {
-	lock, exists := f.getExistingLock(key)
-	if exists {
-		return lock
+	return &keyLock{factory: f, key: key}
+}
+
+// Forget is a no-op, entries are removed once unused.
+func (f *DefaultLockFactory) Forget(string) {}
+
+// acquire returns the entry of the key with a reference taken, creating it if needed.
+func (f *DefaultLockFactory) acquire(key string) *refCountedLock {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	lock, exists := f.locks[key]
+	if !exists {
+		lock = &refCountedLock{}
+		f.locks[key] = lock
 	}
+	lock.refs++
+	return lock
+}
 
+// release drops a reference to the entry of the key and removes it once unused.
+func (f *DefaultLockFactory) release(key string) *refCountedLock {
 	f.lock.Lock()
 	defer f.lock.Unlock()
-	lock = &sync.Mutex{}
-	f.locks[key] = lock
+
+	// the entry exists as long as the caller holds a reference
+	lock := f.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(f.locks, key)
+	}
 	return lock
 }
 
-func (f *DefaultLockFactory) getExistingLock(key string) (sync.Locker, bool) {
-	f.lock.RLock()
-	defer f.lock.RUnlock()
+// keyLock looks up the entry of its key on every Lock, so that it never holds on to a removed entry.
+type keyLock struct {
+	factory *DefaultLockFactory
+	key     string
+}
 
-	lock, exists := f.locks[key]
-	return lock, exists
+func (l *keyLock) Lock() {
+	l.factory.acquire(l.key).Lock()
+}
+
+func (l *keyLock) Unlock() {
+	l.factory.release(l.key).Unlock()
+}
+
+// LockContext locks unless ctx is done first, the lock is never lost while held.
+func (l *keyLock) LockContext(ctx context.Context) (context.Context, error) {
+	if err := lockContext(ctx, l); err != nil {
+		return nil, err
+	}
+	return ctx, nil
 }
@@ -0,0 +1,183 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestDefaultLockFactoryMutualExclusion(t *testing.T) {
+	factory := NewDefaultLockFactory()
+	const goroutines, iterations = 50, 200
+
+	// counter is only guarded by the locks handed out for the key, the race detector reports
+	// any two callers that got different locks while holding them at the same time
+	counter := 0
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				lock := factory.GetLock("quota")
+				lock.Lock()
+				counter++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counter != goroutines*iterations {
+		t.Errorf("expected counter %d, got %d", goroutines*iterations, counter)
+	}
+	if len(factory.locks) != 0 {
+		t.Errorf("expected all locks to be released, got %d", len(factory.locks))
+	}
+}
+
+func TestLockAquisitionConcurrent(t *testing.T) {
+	admission := &SharedQuotaAdmission{lockFactory: NewDefaultLockFactory()}
+	const numQuotas, goroutines, iterations = 8, 50, 200
+
+	quotas := make([]corev1.ResourceQuota, numQuotas)
+	for i := range quotas {
+		quotas[i] = corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("quota-%d", i),
+			UID:  types.UID(fmt.Sprintf("uid-%d", i)),
+		}}
+	}
+	counters := make([]int, numQuotas)
+	expected := make([]int, numQuotas)
+	var expectedLock sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < iterations; j++ {
+				// every request matches a random, shuffled subset of the quotas
+				var matched []corev1.ResourceQuota
+				var indexes []int
+				for _, k := range r.Perm(numQuotas)[:1+r.Intn(numQuotas)] {
+					matched = append(matched, quotas[k])
+					indexes = append(indexes, k)
+				}
+				_, release, err := admission.lockAquisition(context.Background(), matched)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				for _, k := range indexes {
+					counters[k]++
+				}
+				release()
+
+				expectedLock.Lock()
+				for _, k := range indexes {
+					expected[k]++
+				}
+				expectedLock.Unlock()
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	for i := range counters {
+		if counters[i] != expected[i] {
+			t.Errorf("quota %d: expected counter %d, got %d", i, expected[i], counters[i])
+		}
+	}
+	factory := admission.lockFactory.(*DefaultLockFactory)
+	if len(factory.locks) != 0 {
+		t.Errorf("expected all locks to be released, got %d", len(factory.locks))
+	}
+}
+
+func TestDefaultLockFactoryReleasesUnusedLocks(t *testing.T) {
+	factory := NewDefaultLockFactory()
+	first := factory.GetLock("quota")
+	second := factory.GetLock("quota")
+
+	first.Lock()
+	acquired := make(chan struct{})
+	go func() {
+		second.Lock()
+		close(acquired)
+	}()
+	// wait until the second caller holds a reference
+	for {
+		factory.lock.Lock()
+		refs := factory.locks["quota"].refs
+		factory.lock.Unlock()
+		if refs == 2 {
+			break
+		}
+	}
+	first.Unlock()
+	<-acquired
+	if len(factory.locks) != 1 {
+		t.Errorf("expected the lock to be kept while held, got %d entries", len(factory.locks))
+	}
+	second.Unlock()
+	if len(factory.locks) != 0 {
+		t.Errorf("expected the lock to be released, got %d entries", len(factory.locks))
+	}
+}
+
+func TestLockAquisitionGivesUp(t *testing.T) {
+	factory := NewDefaultLockFactory()
+	admission := &SharedQuotaAdmission{lockFactory: factory}
+	quotas := []corev1.ResourceQuota{
+		{ObjectMeta: metav1.ObjectMeta{Name: "quota-0", UID: "uid-0"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "quota-1", UID: "uid-1"}},
+	}
+	held := factory.GetLock("uid-1")
+	held.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := admission.lockAquisition(ctx, quotas); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the acquisition to give up with the context, got %v", err)
+	}
+	// the locks acquired before giving up are released
+	first := factory.GetLock("uid-0")
+	first.Lock()
+	first.Unlock()
+
+	held.Unlock()
+	if err := wait.PollUntilContextTimeout(context.Background(), time.Millisecond, time.Second, true, func(context.Context) (bool, error) {
+		factory.lock.Lock()
+		defer factory.lock.Unlock()
+		return len(factory.locks) == 0, nil
+	}); err != nil {
+		t.Errorf("expected the abandoned acquisition to release the lock, got %d entries", len(factory.locks))
+	}
+}
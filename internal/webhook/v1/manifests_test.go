@@ -0,0 +1,96 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/yaml"
+)
+
+// webhookManifests are the files configuring the webhooks, relative to this package.
+var webhookManifests = []string{
+	"../../../deploy/4.webhook.yaml",
+	"../../../deploy/all-in-one.yaml",
+	"../../../config/webhook/manifests.yaml",
+}
+
+// readWebhookConfiguration returns the MutatingWebhookConfiguration of the manifest file.
+func readWebhookConfiguration(t *testing.T, path string) *admissionregistrationv1.MutatingWebhookConfiguration {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, document := range strings.Split(string(data), "\n---") {
+		if !strings.Contains(document, "kind: MutatingWebhookConfiguration") {
+			continue
+		}
+		configuration := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		if err := yaml.UnmarshalStrict([]byte(document), configuration); err != nil {
+			t.Fatalf("invalid webhook configuration in %s: %v", path, err)
+		}
+		return configuration
+	}
+	t.Fatalf("no webhook configuration in %s", path)
+	return nil
+}
+
+// TestWebhookManifestsInSync checks that the webhooks are configured the same way by every manifest, apart from the
+// service they call.
+func TestWebhookManifestsInSync(t *testing.T) {
+	expected := readWebhookConfiguration(t, webhookManifests[0]).Webhooks
+	for _, path := range webhookManifests[1:] {
+		actual := readWebhookConfiguration(t, path).Webhooks
+		if len(actual) != len(expected) {
+			t.Errorf("expected %d webhooks in %s, got %d", len(expected), path, len(actual))
+			continue
+		}
+		for i := range expected {
+			want, got := expected[i].DeepCopy(), actual[i].DeepCopy()
+			want.ClientConfig.Service, got.ClientConfig.Service = nil, nil
+			if !equality.Semantic.DeepEqual(want, got) {
+				t.Errorf("expected webhook %s of %s to match %s:\n%+v\ngot\n%+v", expected[i].Name, path, webhookManifests[0], want, got)
+			}
+		}
+	}
+}
+
+// TestWebhookReleasesChargedResources checks that the usage of every resource charged on creation is released on
+// deletion, instead of staying reserved until the controller recalculates the quotas.
+func TestWebhookReleasesChargedResources(t *testing.T) {
+	for _, path := range webhookManifests {
+		for _, webhook := range readWebhookConfiguration(t, path).Webhooks {
+			if webhook.Name != "sharedquotas.quota.caih.com" {
+				continue
+			}
+			for _, rule := range webhook.Rules {
+				if !slices.Contains(rule.Operations, admissionregistrationv1.Create) {
+					continue
+				}
+				if !slices.Contains(rule.Operations, admissionregistrationv1.Delete) {
+					t.Errorf("expected the deletion of %v/%v to be admitted by %s of %s", rule.APIGroups, rule.Resources,
+						webhook.Name, path)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// unverifiedAdmissionsTotal counts the admissions allowed without being evaluated.
+	unverifiedAdmissionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sharedquota_webhook_unverified_admissions_total",
+		Help: "Number of admissions allowed by the Open failure policy without being evaluated, by resource and reason.",
+	}, []string{"resource", "reason"})
+	// circuitOpen is 1 while the circuit breaker skips evaluations.
+	circuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sharedquota_webhook_circuit_open",
+		Help: "Whether the circuit breaker of the admission webhook is open.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(unverifiedAdmissionsTotal, circuitOpen)
+}
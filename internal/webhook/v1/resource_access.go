@@ -17,16 +17,21 @@ limitations under the License.
 package v1
 
 import (
+	"context"
+
 	corev1 "k8s.io/api/core/v1"
+
+	quotav1 "caih.com/api/v1"
 )
 
 // QuotaAccessor abstracts the get/set logic from the rest of the Evaluator.  This could be a test stub, a straight passthrough,
 // or most commonly a series of deconflicting caches.
 type QuotaAccessor interface {
-	// UpdateQuotaStatus is called to persist final status.  This method should write to persistent storage.
-	// An error indicates that write didn't complete successfully.
-	UpdateQuotaStatus(newQuota *corev1.ResourceQuota) error
+	// UpdateQuotaStatus is called to persist final status, which is the usage returned by GetQuotas plus the given
+	// reservations.  This method should write to persistent storage.  An error indicates that write didn't complete
+	// successfully.  Nothing must be written once ctx is done.
+	UpdateQuotaStatus(ctx context.Context, newQuota *corev1.ResourceQuota, reservations []quotav1.Reservation) error
 
 	// GetQuotas gets all possible quotas for a given namespace
-	GetQuotas(namespace string) ([]corev1.ResourceQuota, error)
+	GetQuotas(ctx context.Context, namespace string) ([]corev1.ResourceQuota, error)
 }
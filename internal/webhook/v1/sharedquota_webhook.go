@@ -18,33 +18,42 @@ package v1
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"net/http"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 	admissionapi "k8s.io/apiserver/pkg/admission"
-	"k8s.io/apiserver/pkg/admission/plugin/resourcequota"
 	resourcequotaapi "k8s.io/apiserver/pkg/admission/plugin/resourcequota/apis/resourcequota"
 	"k8s.io/apiserver/pkg/authentication/user"
+	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	quotav1 "caih.com/api/v1"
 	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/workload"
 	"caih.com/pkg/quota/generic"
 	"caih.com/pkg/quota/install"
 	"caih.com/pkg/scheme"
 )
 
 const (
-	numEvaluatorThreads = 10
+	defaultEvaluatorThreads = 10
 )
 
 type SharedQuotaAdmission struct {
@@ -53,39 +62,232 @@ type SharedQuotaAdmission struct {
 	decoder webhook.AdmissionDecoder
 
 	lockFactory LockFactory
+	// forwarder sends requests to the replica owning the quotas, nil unless forwarding is enabled
+	forwarder *OwnerForwarder
 
 	// these are used to create the evaluator
 	registry quota.Registry
 
-	init      sync.Once
-	evaluator resourcequota.Evaluator
+	// workloads knows how to project the usage of workloads, used unless workloadAdmission is disabled
+	workloads         workload.Registry
+	workloadAdmission WorkloadAdmissionMode
+	// workloadReader reads the workloads scaled through their scale subresource
+	workloadReader client.Reader
+
+	quotaAccessor QuotaAccessor
+	evaluator     Evaluator
+
+	// mappingCache looks up the quotas selecting a namespace without waiting, to find their failure policy
+	mappingCache quotaNamesLookup
+	// failurePolicy applies to admissions whose quotas do not set one
+	failurePolicy atomic.Value
+	breaker       *circuitBreaker
+}
+
+// Options configures the shared quota admission webhook.
+type Options struct {
+	// WorkloadAdmission controls how workloads whose projected usage exceeds the remaining quota are handled.
+	WorkloadAdmission WorkloadAdmissionMode
+	// QuotaLock selects how replicas serialize the evaluation of a quota, defaults to QuotaLockInProcess.
+	QuotaLock QuotaLockMode
+	// ForwardToOwner forwards requests to the replica owning the quotas of the namespace, requires QuotaLockLease.
+	ForwardToOwner bool
+	// LeaseNamespace is the namespace of the quota leases.
+	LeaseNamespace string
+	// Identity identifies this replica in quota leases.  With ForwardToOwner it must be the host:port other
+	// replicas reach this replica's webhook server on.
+	Identity string
+	// ForwardTLSConfig is used to connect to the owning replica, and to authenticate the replicas forwarding
+	// requests to this one.
+	ForwardTLSConfig *tls.Config
+	// MappingCache maps namespaces to the quotas selecting them, created from the manager's cache if not set.
+	MappingCache *quota.QuotaMappingCache
+	// EvaluatorWorkers is the number of namespaces evaluated in parallel, defaults to 10.
+	EvaluatorWorkers int
+	// EvaluationTimeout is how long an admission waits for its evaluation, defaults to DefaultEvaluationTimeout.
+	EvaluationTimeout time.Duration
+	// QuotaLookupTimeout is how long an evaluation waits for the namespace and its quotas to be observed, defaults
+	// to quota.DefaultQuotaLookupTimeout.
+	QuotaLookupTimeout time.Duration
+	// QuotaCacheSize is the number of quotas whose updated ledgers are kept, defaults to quota.DefaultQuotaCacheSize.
+	QuotaCacheSize int
+	// ResourceQuotaConfiguration lists the resources that must be covered by a quota to be consumed, no resource
+	// is limited if nil.
+	ResourceQuotaConfiguration *resourcequotaapi.Configuration
+	// FailurePolicy applies to admissions that cannot be evaluated and whose quotas do not set one, defaults to
+	// quotav1.FailClosed.
+	FailurePolicy quotav1.FailurePolicyType
+	// CircuitBreakerThreshold is the number of consecutive evaluation errors that suspend evaluations, defaults to
+	// DefaultCircuitBreakerThreshold.
+	CircuitBreakerThreshold int
+	// CircuitBreakerOpenDuration is how long evaluations are suspended, defaults to DefaultCircuitBreakerOpenDuration.
+	CircuitBreakerOpenDuration time.Duration
+}
+
+// QuotaLockMode selects the LockFactory of the webhook.
+type QuotaLockMode string
+
+const (
+	// QuotaLockInProcess serializes evaluations within a replica only.  Replicas rely on status update conflicts.
+	QuotaLockInProcess QuotaLockMode = "InProcess"
+	// QuotaLockLease serializes evaluations across replicas with a coordination.k8s.io Lease per quota.
+	QuotaLockLease QuotaLockMode = "Lease"
+)
+
+// Validate returns an error if the mode is unknown.
+func (m QuotaLockMode) Validate() error {
+	switch m {
+	case QuotaLockInProcess, QuotaLockLease:
+		return nil
+	}
+	return fmt.Errorf("unknown quota lock mode %q, must be one of %s, %s", m, QuotaLockInProcess, QuotaLockLease)
 }
 
 const webhookName = "shared-quota-webhook"
 
-// SetupWithManager registers the webhook for Pod in the manager.
-func SetupWithManager(mgr ctrl.Manager) error {
-	sharedQuotaAdmission := &SharedQuotaAdmission{
-		client:      mgr.GetClient(),
-		lockFactory: NewDefaultLockFactory(),
-		decoder:     admission.NewDecoder(mgr.GetScheme()),
-		registry:    generic.NewRegistry(install.NewQuotaConfigurationForAdmission().Evaluators()),
+// complete defaults and validates the options.
+func (opts *Options) complete() error {
+	if opts.EvaluatorWorkers <= 0 {
+		opts.EvaluatorWorkers = defaultEvaluatorThreads
+	}
+	if opts.EvaluationTimeout <= 0 {
+		opts.EvaluationTimeout = DefaultEvaluationTimeout
+	}
+	if opts.QuotaLookupTimeout <= 0 {
+		opts.QuotaLookupTimeout = quota.DefaultQuotaLookupTimeout
+	}
+	if opts.QuotaCacheSize <= 0 {
+		opts.QuotaCacheSize = quota.DefaultQuotaCacheSize
+	}
+	if len(opts.FailurePolicy) == 0 {
+		opts.FailurePolicy = quotav1.FailClosed
+	}
+	if opts.CircuitBreakerThreshold <= 0 {
+		opts.CircuitBreakerThreshold = DefaultCircuitBreakerThreshold
+	}
+	if opts.CircuitBreakerOpenDuration <= 0 {
+		opts.CircuitBreakerOpenDuration = DefaultCircuitBreakerOpenDuration
+	}
+	if len(opts.WorkloadAdmission) == 0 {
+		opts.WorkloadAdmission = WorkloadAdmissionDisabled
+	}
+	if err := opts.WorkloadAdmission.Validate(); err != nil {
+		return err
+	}
+	if len(opts.QuotaLock) == 0 {
+		opts.QuotaLock = QuotaLockInProcess
+	}
+	if err := opts.QuotaLock.Validate(); err != nil {
+		return err
+	}
+	if opts.ForwardToOwner && opts.QuotaLock != QuotaLockLease {
+		return fmt.Errorf("forwarding to quota owners requires quota lock mode %s", QuotaLockLease)
 	}
-	mgr.GetWebhookServer().Register("/validate-quota-caih-com-v1", &webhook.Admission{Handler: sharedQuotaAdmission})
 	return nil
 }
 
-// +kubebuilder:webhook:path=/validate-quota-caih-com-v1,mutating=true,failurePolicy=fail,sideEffects=None,groups="",resources=pods,verbs=create;update,versions=v1,name=mpod-v1.kb.io,admissionReviewVersions=v1
+// SetupWithManager registers the webhook for Pod in the manager.
+func SetupWithManager(mgr ctrl.Manager, opts Options) (*SharedQuotaAdmission, error) {
+	if err := opts.complete(); err != nil {
+		return nil, err
+	}
+	if opts.MappingCache == nil {
+		mappingCache, err := quota.NewQuotaMappingCache(context.Background(), mgr.GetCache())
+		if err != nil {
+			return nil, err
+		}
+		opts.MappingCache = mappingCache
+	}
+	var lockFactory LockFactory = NewDefaultLockFactory()
+	var forwarder *OwnerForwarder
+	if opts.QuotaLock == QuotaLockLease {
+		leaseLockFactory, err := NewLeaseLockFactory(mgr.GetClient(), mgr.GetAPIReader(), LeaseLockFactoryOptions{
+			Namespace: opts.LeaseNamespace,
+			Identity:  opts.Identity,
+			Sticky:    opts.ForwardToOwner,
+		})
+		if err != nil {
+			return nil, err
+		}
+		lockFactory = leaseLockFactory
+		if opts.ForwardToOwner {
+			if forwarder, err = NewOwnerForwarder(leaseLockFactory, opts.ForwardTLSConfig); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := quota.IndexLedgers(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return nil, err
+	}
+	quotaAccessor := quota.NewQuotaAccessor(mgr.GetClient(), mgr.GetAPIReader(), opts.MappingCache, opts.QuotaCacheSize)
+	sharedQuotaAdmission := newSharedQuotaAdmission(mgr.GetClient(), mgr.GetAPIReader(), mgr.GetScheme(), quotaAccessor, lockFactory,
+		forwarder, opts)
+	if err := sharedQuotaAdmission.forgetDeletedQuotas(mgr); err != nil {
+		return nil, err
+	}
+	mgr.GetWebhookServer().Register("/validate-quota-caih-com-v1", withRequestTimeout(&webhook.Admission{Handler: sharedQuotaAdmission}))
+	if forwarder != nil {
+		mgr.GetWebhookServer().Register(forwardPath, authenticateReplicas(
+			withRequestTimeout(&webhook.Admission{Handler: &forwardedAdmission{admission: sharedQuotaAdmission}}), opts.ForwardTLSConfig))
+	}
+	return sharedQuotaAdmission, nil
+}
+
+// NewSharedQuotaAdmission returns an admission handler evaluating requests against the quotas served by
+// quotaAccessor, to drive Handle in-process.  Quotas are locked within the process and requests are never
+// forwarded.  Without a mapping cache in the options, the failure policy of the quotas is ignored.
+func NewSharedQuotaAdmission(c client.Client, scheme *runtime.Scheme, quotaAccessor QuotaAccessor, opts Options) (*SharedQuotaAdmission, error) {
+	if opts.QuotaLock == QuotaLockLease || opts.ForwardToOwner {
+		return nil, fmt.Errorf("in-process admission requires quota lock mode %s without forwarding", QuotaLockInProcess)
+	}
+	if err := opts.complete(); err != nil {
+		return nil, err
+	}
+	return newSharedQuotaAdmission(c, c, scheme, quotaAccessor, NewDefaultLockFactory(), nil, opts), nil
+}
 
-// PodCustomDefaulter struct is responsible for setting default values on the custom resource of the
-// Kind Pod when those are created or updated.
-//
-// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
-// as it is used only for temporary operations and does not need to be deeply copied.
+func newSharedQuotaAdmission(c client.Client, apiReader client.Reader, scheme *runtime.Scheme, quotaAccessor QuotaAccessor,
+	lockFactory LockFactory, forwarder *OwnerForwarder, opts Options) *SharedQuotaAdmission {
+	sharedQuotaAdmission := &SharedQuotaAdmission{
+		client:            c,
+		lockFactory:       lockFactory,
+		forwarder:         forwarder,
+		decoder:           admission.NewDecoder(scheme),
+		registry:          generic.NewRegistry(install.NewQuotaConfigurationForAdmission(c, apiReader).Evaluators()),
+		workloads:         workload.NewRegistry(clock.RealClock{}),
+		workloadAdmission: opts.WorkloadAdmission,
+		workloadReader:    apiReader,
+		quotaAccessor:     quotaAccessor,
+		breaker:           newCircuitBreaker(clock.RealClock{}, opts.CircuitBreakerThreshold, opts.CircuitBreakerOpenDuration),
+	}
+	if opts.MappingCache != nil {
+		sharedQuotaAdmission.mappingCache = opts.MappingCache
+	}
+	sharedQuotaAdmission.evaluator = NewQuotaEvaluator(quotaAccessor, install.DefaultIgnoredResources(),
+		sharedQuotaAdmission.registry, sharedQuotaAdmission.lockAquisition, opts.ResourceQuotaConfiguration, opts.EvaluatorWorkers, utilwait.NeverStop)
+	sharedQuotaAdmission.SetTimeouts(opts.EvaluationTimeout, opts.QuotaLookupTimeout)
+	sharedQuotaAdmission.SetFailurePolicy(opts.FailurePolicy)
+	return sharedQuotaAdmission
+}
 
+// Handle evaluates the admission request against the shared quotas.  The webhooks sending requests to Handle are
+// configured in deploy/4.webhook.yaml and config/webhook/manifests.yaml rather than with +kubebuilder:webhook markers,
+// their rules and match conditions cannot be expressed with markers.
 func (a *SharedQuotaAdmission) Handle(ctx context.Context, req webhook.AdmissionRequest) webhook.AdmissionResponse {
-	// ignore all operations that correspond to sub-resource actions
-	if len(req.RequestSubResource) != 0 {
+	return a.handle(ctx, req, a.forwarder != nil)
+}
+
+// handle evaluates the request, or forwards it to the replica owning the quotas if forward is set.
+func (a *SharedQuotaAdmission) handle(ctx context.Context, req webhook.AdmissionRequest, forward bool) webhook.AdmissionResponse {
+	// workloads are sent to the webhook whether or not their usage is projected
+	if a.workloads.Get(schema.GroupResource{Group: req.Resource.Group, Resource: req.Resource.Resource}) != nil &&
+		a.workloadAdmission == WorkloadAdmissionDisabled {
+		return webhook.Allowed("")
+	}
+	// ignore all operations that correspond to sub-resource actions, except pod status updates which release usage
+	// when the pod reaches a terminal phase, and workload scaling which is projected like an update of the replicas
+	if len(req.SubResource) != 0 && !isPodStatus(req) &&
+		!isWorkloadScale(schema.GroupResource{Group: req.Resource.Group, Resource: req.Resource.Resource}, req.SubResource) {
 		return webhook.Allowed("")
 	}
 	// ignore cluster level resources
@@ -93,28 +295,125 @@ func (a *SharedQuotaAdmission) Handle(ctx context.Context, req webhook.Admission
 		return webhook.Allowed("")
 	}
 
-	a.init.Do(func() {
-		resourceQuotaAccessor := quota.NewQuotaAccessor(a.client)
-		a.evaluator = NewQuotaEvaluator(resourceQuotaAccessor, install.DefaultIgnoredResources(),
-			a.registry, a.lockAquisition, &resourcequotaapi.Configuration{}, numEvaluatorThreads, utilwait.NeverStop)
-	})
+	// releases are never denied, the controller recalculates the usage they failed to release
+	if req.Operation == admissionv1.Delete || isPodStatus(req) {
+		if _, err := a.admit(ctx, req, forward); err != nil {
+			klog.Errorf("failed to release usage of %s %s/%s: %v", req.Resource.Resource, req.Namespace, req.Name, err)
+		}
+		return webhook.Allowed("")
+	}
+
+	if !a.breaker.Allow() {
+		return a.degrade(ctx, req, reasonCircuitOpen, errCircuitOpen)
+	}
+	resp, err := a.admit(ctx, req, forward)
+	if err != nil {
+		a.breaker.Failure()
+		klog.Error(err)
+		return a.degrade(ctx, req, reasonEvaluationFailed, err)
+	}
+	a.breaker.Success()
+	return resp
+}
+
+// isPodStatus returns true for requests to the status subresource of pods, which only release usage.
+func isPodStatus(req webhook.AdmissionRequest) bool {
+	return req.Resource.Group == "" && req.Resource.Resource == "pods" && req.SubResource == "status"
+}
+
+// admit evaluates the request, or forwards it to the replica owning the quotas if forward is set.  It returns an
+// error if the request could not be evaluated.
+func (a *SharedQuotaAdmission) admit(ctx context.Context, req webhook.AdmissionRequest, forward bool) (webhook.AdmissionResponse, error) {
+	if forward {
+		quotas, err := a.quotaAccessor.GetQuotas(ctx, req.Namespace)
+		if err != nil {
+			return webhook.AdmissionResponse{}, err
+		}
+		if resp, ok := a.forwarder.Forward(ctx, req, quotas); ok {
+			return resp, nil
+		}
+	}
 
 	attributesRecord, err := convertToAdmissionAttributes(req)
 	if err != nil {
 		klog.Error(err)
-		return webhook.Errored(http.StatusBadRequest, err)
+		return webhook.Errored(http.StatusBadRequest, err), nil
 	}
 
-	if err := a.evaluator.Evaluate(attributesRecord); err != nil {
+	var warnings []string
+	if a.workloadAdmission != WorkloadAdmissionDisabled {
+		workloadAttributes, err := a.workloadAttributes(ctx, attributesRecord)
+		if err != nil {
+			return webhook.AdmissionResponse{}, err
+		}
+		evaluator := a.workloads.Get(workloadAttributes.GetResource().GroupResource())
+		if evaluator != nil && evaluator.Handles(workloadAttributes) {
+			if err := a.checkWorkload(ctx, evaluator, workloadAttributes); err != nil {
+				if !errors.IsForbidden(err) {
+					return webhook.AdmissionResponse{}, err
+				}
+				if a.workloadAdmission == WorkloadAdmissionDeny {
+					klog.Info(err)
+					return webhook.Denied(err.Error()), nil
+				}
+				warnings = append(warnings, err.Error())
+			}
+		}
+		// the scale only carries the replicas, which are never charged
+		if attributesRecord.GetSubresource() == scaleSubresource {
+			return webhook.Allowed("").WithWarnings(warnings...), nil
+		}
+	}
+
+	if err := a.evaluator.Evaluate(ctx, attributesRecord); err != nil {
 		if errors.IsForbidden(err) {
 			klog.Info(err)
-			return webhook.Denied(err.Error())
+			return webhook.Denied(err.Error()), nil
 		}
-		klog.Error(err)
-		return webhook.Errored(http.StatusInternalServerError, err)
+		return webhook.AdmissionResponse{}, err
 	}
 
-	return webhook.Allowed("")
+	return webhook.Allowed("").WithWarnings(warnings...), nil
+}
+
+// SetTimeouts sets how long an admission waits for its evaluation, and how long the evaluation waits for the
+// namespace and its quotas to be observed.  It is safe to call while admissions are evaluated.
+func (a *SharedQuotaAdmission) SetTimeouts(evaluation, quotaLookup time.Duration) {
+	if evaluator, ok := a.evaluator.(interface{ SetTimeout(time.Duration) }); ok {
+		evaluator.SetTimeout(evaluation)
+	}
+	if quotaAccessor, ok := a.quotaAccessor.(interface{ SetLookupTimeout(time.Duration) }); ok {
+		quotaAccessor.SetLookupTimeout(quotaLookup)
+	}
+}
+
+// forgetDeletedQuotas releases the locks kept for shared quotas and namespaced resource quotas, and the ledgers kept
+// for shared quotas, once they are deleted.
+func (a *SharedQuotaAdmission) forgetDeletedQuotas(mgr ctrl.Manager) error {
+	for _, obj := range []client.Object{&quotav1.SharedQuota{}, &corev1.ResourceQuota{}} {
+		informer, err := mgr.GetCache().GetInformer(context.Background(), obj)
+		if err != nil {
+			return err
+		}
+		if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if quota, ok := obj.(client.Object); ok {
+					a.lockFactory.Forget(string(quota.GetUID()))
+				}
+				if sharedQuota, ok := obj.(*quotav1.SharedQuota); ok {
+					if quotaAccessor, ok := a.quotaAccessor.(interface{ Forget(string) }); ok {
+						quotaAccessor.Forget(sharedQuota.Name)
+					}
+				}
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type ByName []corev1.ResourceQuota
@@ -123,29 +422,49 @@ func (v ByName) Len() int           { return len(v) }
 func (v ByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
 func (v ByName) Less(i, j int) bool { return v[i].Name < v[j].Name }
 
-func (a *SharedQuotaAdmission) lockAquisition(quotas []corev1.ResourceQuota) func() {
+// lockAquisition locks the quotas unless ctx is done first.  The returned context is cancelled once one of the locks
+// is lost, the quotas must not be updated after that.
+func (a *SharedQuotaAdmission) lockAquisition(ctx context.Context, quotas []corev1.ResourceQuota) (context.Context, func(), error) {
 	var locks []sync.Locker
+	release := func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
 
 	// acquire the locks in alphabetical order because I'm too lazy to think of something clever
 	sort.Sort(ByName(quotas))
 	for _, q := range quotas {
 		lock := a.lockFactory.GetLock(string(q.UID))
-		lock.Lock()
+		if contextLock, ok := lock.(ContextLocker); ok {
+			var err error
+			if ctx, err = contextLock.LockContext(ctx); err != nil {
+				release()
+				return nil, nil, err
+			}
+		} else {
+			lock.Lock()
+		}
 		locks = append(locks, lock)
 	}
+	return ctx, release, nil
+}
 
-	return func() {
-		for i := len(locks) - 1; i >= 0; i-- {
-			locks[i].Unlock()
-		}
+// decodeObject decodes the raw object, falling back to unstructured for kinds that are not registered in
+// the scheme, such as custom resources.
+func decodeObject(raw []byte) (runtime.Object, error) {
+	object, _, err := scheme.Codecs.UniversalDeserializer().Decode(raw, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		object, _, err = unstructured.UnstructuredJSONScheme.Decode(raw, nil, nil)
 	}
+	return object, err
 }
 
 func convertToAdmissionAttributes(req admission.Request) (admissionapi.Attributes, error) {
 	var err error
 	var object runtime.Object
 	if len(req.Object.Raw) > 0 {
-		object, _, err = scheme.Codecs.UniversalDeserializer().Decode(req.Object.Raw, nil, nil)
+		object, err = decodeObject(req.Object.Raw)
 		if err != nil {
 			return nil, err
 		}
@@ -153,7 +472,7 @@ func convertToAdmissionAttributes(req admission.Request) (admissionapi.Attribute
 
 	var oldObject runtime.Object
 	if len(req.OldObject.Raw) > 0 {
-		oldObject, _, err = scheme.Codecs.UniversalDeserializer().Decode(req.OldObject.Raw, nil, nil)
+		oldObject, err = decodeObject(req.OldObject.Raw)
 		if err != nil {
 			klog.Error(err)
 			return nil, err
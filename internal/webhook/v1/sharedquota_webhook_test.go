@@ -0,0 +1,139 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"caih.com/internal/webhook/v1/fake"
+	"caih.com/pkg/quota"
+	"caih.com/pkg/scheme"
+)
+
+// newPodRequest returns a request for the pod named name, or its subresource if set.
+func newPodRequest(t *testing.T, operation admissionv1.Operation, subresource string, obj, oldObj *corev1.Pod) admission.Request {
+	raw := func(obj *corev1.Pod) runtime.RawExtension {
+		if obj == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: data}
+	}
+	kind := metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	pods := metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		UID:                "uid",
+		Kind:               kind,
+		Resource:           pods,
+		SubResource:        subresource,
+		RequestKind:        &kind,
+		RequestResource:    &pods,
+		RequestSubResource: subresource,
+		Namespace:          "namespace",
+		Name:               "pod",
+		Operation:          operation,
+		Object:             raw(obj),
+		OldObject:          raw(oldObj),
+		DryRun:             ptr.To(false),
+	}}
+}
+
+// TestPodRelease checks that the usage of a pod is released once, by its deletion or its status update to a
+// terminal phase, and that other status updates are not charged.
+func TestPodRelease(t *testing.T) {
+	accessor := fake.NewQuotaAccessor()
+	accessor.AddQuota("quota", corev1.ResourceList{
+		corev1.ResourcePods:        resource.MustParse("4"),
+		corev1.ResourceRequestsCPU: resource.MustParse("1"),
+	}, "namespace")
+	c := clientfake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	sharedQuotaAdmission, err := NewSharedQuotaAdmission(c, scheme.Scheme, accessor, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		request admission.Request
+		// expectPods is the number of pods charged once the request is admitted, each requesting 100m of cpu
+		expectPods int64
+	}{
+		{
+			name:       "create",
+			request:    newPodRequest(t, admissionv1.Create, "", newReleasedPod(corev1.PodPending, false), nil),
+			expectPods: 1,
+		},
+		{
+			name:       "create another",
+			request:    newPodRequest(t, admissionv1.Create, "", newReleasedPod(corev1.PodPending, false), nil),
+			expectPods: 2,
+		},
+		{
+			name:       "status update in a running phase",
+			request:    newPodRequest(t, admissionv1.Update, "status", newReleasedPod("", false), newReleasedPod(corev1.PodPending, false)),
+			expectPods: 2,
+		},
+		{
+			name:       "graceful deletion",
+			request:    newPodRequest(t, admissionv1.Delete, "", nil, newReleasedPod("", false)),
+			expectPods: 1,
+		},
+		{
+			name:       "status update to a terminal phase of the deleted pod",
+			request:    newPodRequest(t, admissionv1.Update, "status", newReleasedPod(corev1.PodSucceeded, true), newReleasedPod("", true)),
+			expectPods: 1,
+		},
+		{
+			name:       "final deletion",
+			request:    newPodRequest(t, admissionv1.Delete, "", nil, newReleasedPod(corev1.PodSucceeded, true)),
+			expectPods: 1,
+		},
+		{
+			name:       "status update to a terminal phase",
+			request:    newPodRequest(t, admissionv1.Update, "status", newReleasedPod(corev1.PodFailed, false), newReleasedPod("", false)),
+			expectPods: 0,
+		},
+	}
+	for _, step := range steps {
+		resp := sharedQuotaAdmission.Handle(context.Background(), step.request)
+		if !resp.Allowed {
+			t.Fatalf("%s: expected the request to be allowed, got %v", step.name, resp.Result)
+		}
+		resourceQuota, _ := accessor.Quota("quota")
+		expect := corev1.ResourceList{
+			corev1.ResourcePods:        *resource.NewQuantity(step.expectPods, resource.DecimalSI),
+			corev1.ResourceRequestsCPU: *resource.NewMilliQuantity(100*step.expectPods, resource.DecimalSI),
+		}
+		if !quota.Equals(resourceQuota.Status.Used, expect) {
+			t.Fatalf("%s: expected used %v, got %v", step.name, expect, resourceQuota.Status.Used)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simulation replays interleaved admissions against the quota evaluator of the webhook, backed by an
+// in-memory quota accessor, and checks that quotas are never exceeded and that their usage does not leak.  The
+// admissions and the injected faults are derived from a seed, the interleaving is left to the scheduler.
+package simulation
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/clock"
+
+	webhookv1 "caih.com/internal/webhook/v1"
+	"caih.com/internal/webhook/v1/fake"
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+	"caih.com/pkg/quota/generic"
+	"caih.com/pkg/quota/install"
+)
+
+// Config describes a simulation.
+type Config struct {
+	// Seed derives the quotas, the admissions and the injected faults.
+	Seed int64
+	// Namespaces is the number of namespaces, each selected by one or two quotas.
+	Namespaces int
+	// Quotas is the number of shared quotas.
+	Quotas int
+	// Admissions is the number of pod creations and deletions replayed.
+	Admissions int
+	// Concurrency is the number of admissions waiting for their evaluation at the same time.
+	Concurrency int
+	// Workers is the number of namespaces evaluated in parallel.
+	Workers int
+	// ReleaseRate is the fraction of admissions deleting a previously admitted pod.
+	ReleaseRate float64
+	// AbandonRate is the fraction of admissions abandoned before their evaluation completes.
+	AbandonRate float64
+	// ConflictRate is the fraction of quota status updates failing with an injected conflict.
+	ConflictRate float64
+	// MaxLatency bounds the latency of every quota lookup and update.
+	MaxLatency time.Duration
+	// LockQuotas serializes the evaluations of a quota across namespaces, as the webhook does.  Without it, only
+	// the resource version of the quotas prevents lost updates.
+	LockQuotas bool
+}
+
+// Result counts the outcomes of a simulation.
+type Result struct {
+	// Admitted is the number of pod creations allowed.
+	Admitted int
+	// Denied is the number of pod creations rejected for exceeding a quota.
+	Denied int
+	// Failed is the number of pod creations that could not be evaluated, including abandoned ones.
+	Failed int
+	// Released is the number of pod deletions whose usage was released.
+	Released int
+	// Abandoned is the number of admissions abandoned before their evaluation completed.
+	Abandoned int
+	// Stats are the calls served by the quota accessor.
+	Stats fake.Stats
+}
+
+// accounted are the resources of the quotas of a simulation.
+var accounted = []corev1.ResourceName{corev1.ResourcePods, corev1.ResourceRequestsCPU}
+
+// operation is a pod creation, or the deletion of an admitted pod of the namespace if release is set.
+type operation struct {
+	namespace string
+	release   bool
+	// pod is the created pod, or selects the deleted pod among the admitted pods of the namespace
+	pod *corev1.Pod
+	// abandonAfter is when the admission is abandoned, negative if it never is
+	abandonAfter time.Duration
+}
+
+// simulation is the state of a running simulation.
+type simulation struct {
+	accessor  *fake.QuotaAccessor
+	evaluator webhookv1.Evaluator
+
+	lock sync.Mutex
+	// admitted holds the admitted pods that were not deleted yet by namespace
+	admitted map[string][]*corev1.Pod
+	// slack is the usage every quota may have been charged for admissions with an unknown outcome
+	slack  map[string]corev1.ResourceList
+	result Result
+}
+
+// Run replays the admissions of the configuration and checks the invariants of the quotas once they are all
+// evaluated.  It returns an error listing every violated invariant.
+func Run(cfg Config) (Result, error) {
+	if cfg.Namespaces <= 0 || cfg.Quotas <= 0 || cfg.Concurrency <= 0 || cfg.Workers <= 0 {
+		return Result{}, fmt.Errorf("namespaces, quotas, concurrency and workers must be positive")
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+
+	accessor := fake.NewQuotaAccessor()
+	namespaces := make([]string, cfg.Namespaces)
+	quotaNamespaces := map[string][]string{}
+	for i := range namespaces {
+		namespaces[i] = fmt.Sprintf("namespace-%d", i)
+		names := []string{fmt.Sprintf("quota-%d", i%cfg.Quotas)}
+		if cfg.Quotas > 1 && rng.Intn(2) == 0 {
+			if other := fmt.Sprintf("quota-%d", rng.Intn(cfg.Quotas)); other != names[0] {
+				names = append(names, other)
+			}
+		}
+		for _, name := range names {
+			quotaNamespaces[name] = append(quotaNamespaces[name], namespaces[i])
+		}
+	}
+	for i := 0; i < cfg.Quotas; i++ {
+		name := fmt.Sprintf("quota-%d", i)
+		pods := 5 + rng.Intn(20)
+		accessor.AddQuota(name, corev1.ResourceList{
+			corev1.ResourcePods:        *resource.NewQuantity(int64(pods), resource.DecimalSI),
+			corev1.ResourceRequestsCPU: *resource.NewMilliQuantity(int64(pods*(200+rng.Intn(400))), resource.DecimalSI),
+		}, quotaNamespaces[name]...)
+	}
+	if cfg.ConflictRate > 0 {
+		accessor.Conflict = func(name, resourceVersion string) bool {
+			return fraction(cfg.Seed, name, resourceVersion) < cfg.ConflictRate
+		}
+	}
+	if cfg.MaxLatency > 0 {
+		var latencyLock sync.Mutex
+		latencyRand := rand.New(rand.NewSource(cfg.Seed + 1))
+		accessor.Latency = func() time.Duration {
+			latencyLock.Lock()
+			defer latencyLock.Unlock()
+			return time.Duration(latencyRand.Int63n(int64(cfg.MaxLatency) + 1))
+		}
+	}
+
+	operations := make([]operation, cfg.Admissions)
+	for i := range operations {
+		op := operation{
+			namespace:    namespaces[rng.Intn(len(namespaces))],
+			release:      rng.Float64() < cfg.ReleaseRate,
+			abandonAfter: -1,
+		}
+		op.pod = newPod(op.namespace, fmt.Sprintf("pod-%d", i), int64(100*(1+rng.Intn(10))))
+		if rng.Float64() < cfg.AbandonRate {
+			op.abandonAfter = time.Duration(rng.Int63n(3*int64(cfg.MaxLatency) + 1))
+		}
+		operations[i] = op
+	}
+
+	var lockAcquisition webhookv1.LockAcquisitionFunc
+	if cfg.LockQuotas {
+		lockAcquisition = lockQuotas(webhookv1.NewDefaultLockFactory())
+	}
+	registry := generic.NewRegistry([]quota.Evaluator{core.NewPodEvaluator(nil, clock.RealClock{})})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	s := &simulation{
+		accessor: accessor,
+		evaluator: webhookv1.NewQuotaEvaluator(accessor, install.DefaultIgnoredResources(), registry, lockAcquisition,
+			nil, cfg.Workers, stopCh),
+		admitted: map[string][]*corev1.Pod{},
+		slack:    map[string]corev1.ResourceList{},
+	}
+
+	queue := make(chan operation)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for op := range queue {
+				s.apply(op)
+			}
+		}()
+	}
+	for _, op := range operations {
+		queue <- op
+	}
+	close(queue)
+	wg.Wait()
+
+	s.result.Stats = accessor.Stats()
+	return s.result, s.check()
+}
+
+// apply evaluates the operation and records its outcome.
+func (s *simulation) apply(op operation) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if op.abandonAfter >= 0 {
+		ctx, cancel = context.WithTimeout(ctx, op.abandonAfter)
+		defer cancel()
+	}
+
+	if !op.release {
+		err := s.evaluator.Evaluate(ctx, podAttributes(op.pod, admission.Create))
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.countAbandoned(ctx, err)
+		switch {
+		case err == nil:
+			s.result.Admitted++
+			s.admitted[op.namespace] = append(s.admitted[op.namespace], op.pod)
+		case apierrors.IsForbidden(err):
+			s.result.Denied++
+			// a pod charged to a first quota and denied by a second one when checked again after a conflict keeps
+			// its usage in the first quota, the controller recalculates it
+			if s.quotaCount(op.namespace) > 1 {
+				s.addSlack(op.pod)
+			}
+		default:
+			// the usage of the pod may have been committed to some of the quotas
+			s.result.Failed++
+			s.addSlack(op.pod)
+		}
+		return
+	}
+
+	// the pod is deleted whatever the outcome of its admission
+	s.lock.Lock()
+	pods := s.admitted[op.namespace]
+	if len(pods) == 0 {
+		s.lock.Unlock()
+		return
+	}
+	index := int(fraction(0, op.pod.Name, "") * float64(len(pods)))
+	pod := pods[index]
+	s.admitted[op.namespace] = append(pods[:index:index], pods[index+1:]...)
+	s.lock.Unlock()
+
+	err := s.evaluator.Evaluate(ctx, podAttributes(pod, admission.Delete))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.countAbandoned(ctx, err)
+	if err == nil {
+		s.result.Released++
+		return
+	}
+	// the usage of the pod may not have been released from some of the quotas
+	s.addSlack(pod)
+}
+
+func (s *simulation) countAbandoned(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		s.result.Abandoned++
+	}
+}
+
+// quotaCount returns the number of quotas selecting the namespace.
+func (s *simulation) quotaCount(namespace string) int {
+	count := 0
+	for _, name := range s.accessor.QuotaNames() {
+		if s.accessor.Selects(name, namespace) {
+			count++
+		}
+	}
+	return count
+}
+
+// addSlack records that the quotas of the pod's namespace may be charged for the pod.  Must be called with the
+// lock held.
+func (s *simulation) addSlack(pod *corev1.Pod) {
+	for _, name := range s.accessor.QuotaNames() {
+		if s.accessor.Selects(name, pod.Namespace) {
+			s.slack[name] = quota.Add(s.slack[name], podUsage(pod))
+		}
+	}
+}
+
+// check verifies for every quota that the admitted pods fit into it, and that its recorded usage covers the
+// admitted pods and exceeds them by no more than the pods with an unknown outcome.
+func (s *simulation) check() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var errs []error
+	for _, name := range s.accessor.QuotaNames() {
+		resourceQuota, _ := s.accessor.Quota(name)
+		used := corev1.ResourceList{}
+		for namespace, pods := range s.admitted {
+			if !s.accessor.Selects(name, namespace) {
+				continue
+			}
+			for _, pod := range pods {
+				used = quota.Add(used, podUsage(pod))
+			}
+		}
+		recorded := quota.Mask(resourceQuota.Status.Used, accounted)
+		if ok, exceeded := quota.LessThanOrEqual(used, resourceQuota.Status.Hard); !ok {
+			errs = append(errs, fmt.Errorf("quota %s over-admitted %v: admitted %v, hard %v",
+				name, exceeded, used, resourceQuota.Status.Hard))
+		}
+		if ok, exceeded := quota.LessThanOrEqual(used, recorded); !ok {
+			errs = append(errs, fmt.Errorf("quota %s under-counts %v: admitted %v, recorded %v",
+				name, exceeded, used, recorded))
+		}
+		if ok, exceeded := quota.LessThanOrEqual(recorded, quota.Add(used, s.slack[name])); !ok {
+			errs = append(errs, fmt.Errorf("quota %s leaked %v: admitted %v, recorded %v, unknown outcomes %v",
+				name, exceeded, used, recorded, s.slack[name]))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// lockQuotas returns a lock acquisition function locking the quotas in name order.
+func lockQuotas(factory webhookv1.LockFactory) webhookv1.LockAcquisitionFunc {
+	return func(ctx context.Context, quotas []corev1.ResourceQuota) (context.Context, func(), error) {
+		names := make([]string, 0, len(quotas))
+		for _, resourceQuota := range quotas {
+			names = append(names, string(resourceQuota.UID))
+		}
+		sort.Strings(names)
+		locks := make([]sync.Locker, 0, len(names))
+		for _, name := range names {
+			lock := factory.GetLock(name)
+			lock.Lock()
+			locks = append(locks, lock)
+		}
+		return ctx, func() {
+			for i := len(locks) - 1; i >= 0; i-- {
+				locks[i].Unlock()
+			}
+		}, nil
+	}
+}
+
+// fraction hashes its arguments to a number in [0, 1).
+func fraction(seed int64, name, resourceVersion string) float64 {
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, seed)
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(resourceVersion))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+func newPod(namespace, name string, milliCPU int64) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: *resource.NewMilliQuantity(milliCPU, resource.DecimalSI)},
+				},
+			}},
+		},
+	}
+}
+
+func podUsage(pod *corev1.Pod) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourcePods:        *resource.NewQuantity(1, resource.DecimalSI),
+		corev1.ResourceRequestsCPU: pod.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU],
+	}
+}
+
+func podAttributes(pod *corev1.Pod, operation admission.Operation) admission.Attributes {
+	var object, oldObject, options runtime.Object
+	if operation == admission.Delete {
+		oldObject = pod
+		options = &metav1.DeleteOptions{}
+	} else {
+		object = pod
+		options = &metav1.CreateOptions{}
+	}
+	return admission.NewAttributesRecord(object, oldObject, corev1.SchemeGroupVersion.WithKind("Pod"), pod.Namespace,
+		pod.Name, corev1.SchemeGroupVersion.WithResource("pods"), "", operation, options, false, nil)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulation(t *testing.T) {
+	base := Config{
+		Seed:        1,
+		Namespaces:  20,
+		Quotas:      5,
+		Admissions:  2000,
+		Concurrency: 50,
+		Workers:     10,
+		ReleaseRate: 0.3,
+	}
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		// exact is set if every admission has a known outcome
+		exact bool
+	}{
+		{
+			name:   "no faults",
+			modify: func(*Config) {},
+			exact:  true,
+		},
+		{
+			name: "locked quotas",
+			modify: func(cfg *Config) {
+				cfg.LockQuotas = true
+			},
+			exact: true,
+		},
+		{
+			name: "conflicts",
+			modify: func(cfg *Config) {
+				cfg.ConflictRate = 0.3
+			},
+		},
+		{
+			name: "latency",
+			modify: func(cfg *Config) {
+				cfg.MaxLatency = time.Millisecond
+				cfg.LockQuotas = true
+			},
+			exact: true,
+		},
+		{
+			name: "abandoned admissions",
+			modify: func(cfg *Config) {
+				cfg.MaxLatency = time.Millisecond
+				cfg.AbandonRate = 0.2
+				cfg.ConflictRate = 0.1
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := base
+			tc.modify(&cfg)
+			result, err := Run(cfg)
+			t.Logf("%+v", result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Admitted == 0 || result.Denied == 0 {
+				t.Errorf("expected admissions to be both admitted and denied, got %+v", result)
+			}
+			if tc.exact && result.Failed != 0 {
+				t.Errorf("expected no failed admission, got %+v", result)
+			}
+		})
+	}
+}
+
+func FuzzSimulation(f *testing.F) {
+	f.Add(int64(1), uint8(0), uint8(0), uint8(30), false)
+	f.Add(int64(2), uint8(50), uint8(0), uint8(50), true)
+	f.Add(int64(3), uint8(90), uint8(20), uint8(10), false)
+	f.Fuzz(func(t *testing.T, seed int64, conflictPercent, abandonPercent, releasePercent uint8, lockQuotas bool) {
+		_, err := Run(Config{
+			Seed:         seed,
+			Namespaces:   8,
+			Quotas:       3,
+			Admissions:   200,
+			Concurrency:  20,
+			Workers:      4,
+			ReleaseRate:  float64(releasePercent%100) / 100,
+			AbandonRate:  float64(abandonPercent%100) / 100,
+			ConflictRate: float64(conflictPercent%100) / 100,
+			MaxLatency:   100 * time.Microsecond,
+			LockQuotas:   lockQuotas,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRequestTimeout(t *testing.T) {
+	testCases := map[string]struct {
+		query          string
+		expectDeadline bool
+		expectTimeout  time.Duration
+	}{
+		"no timeout": {
+			query: "",
+		},
+		"invalid timeout": {
+			query: "?timeout=ten",
+		},
+		"negative timeout": {
+			query: "?timeout=-10s",
+		},
+		"timeout with response margin": {
+			query:          "?timeout=10s",
+			expectDeadline: true,
+			expectTimeout:  10*time.Second - responseMargin,
+		},
+		"timeout shorter than the response margin": {
+			query:          "?timeout=500ms",
+			expectDeadline: true,
+			expectTimeout:  250 * time.Millisecond,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var deadline time.Time
+			var hasDeadline bool
+			handler := withRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, hasDeadline = r.Context().Deadline()
+			}))
+			before := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/validate"+tc.query, nil))
+			after := time.Now()
+
+			if hasDeadline != tc.expectDeadline {
+				t.Fatalf("expected deadline %t, got %t", tc.expectDeadline, hasDeadline)
+			}
+			if !tc.expectDeadline {
+				return
+			}
+			if deadline.Before(before.Add(tc.expectTimeout)) || deadline.After(after.Add(tc.expectTimeout)) {
+				t.Errorf("expected a timeout of %v, got %v", tc.expectTimeout, deadline.Sub(before))
+			}
+		})
+	}
+}
+
+func TestRemainingTimeout(t *testing.T) {
+	if timeout, ok := remainingTimeout(context.Background()); ok {
+		t.Errorf("expected no timeout without deadline, got %s", timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	timeout, ok := remainingTimeout(ctx)
+	if !ok {
+		t.Fatalf("expected a timeout with deadline")
+	}
+	remaining, err := time.ParseDuration(timeout)
+	if err != nil {
+		t.Fatalf("unexpected error parsing %q: %v", timeout, err)
+	}
+	if remaining > time.Minute || remaining < time.Minute-10*time.Second {
+		t.Errorf("expected about a minute, got %v", remaining)
+	}
+}
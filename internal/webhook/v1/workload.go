@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/workload"
+)
+
+// WorkloadAdmissionMode controls how workloads whose projected usage exceeds the remaining quota are handled.
+type WorkloadAdmissionMode string
+
+const (
+	// WorkloadAdmissionDisabled does not project the usage of workloads.
+	WorkloadAdmissionDisabled WorkloadAdmissionMode = "Disabled"
+	// WorkloadAdmissionWarn admits the workload and returns a warning to the client.
+	WorkloadAdmissionWarn WorkloadAdmissionMode = "Warn"
+	// WorkloadAdmissionDeny rejects the workload.
+	WorkloadAdmissionDeny WorkloadAdmissionMode = "Deny"
+)
+
+// Validate returns an error if the mode is unknown.
+func (m WorkloadAdmissionMode) Validate() error {
+	switch m {
+	case WorkloadAdmissionDisabled, WorkloadAdmissionWarn, WorkloadAdmissionDeny:
+		return nil
+	}
+	return fmt.Errorf("unknown workload admission mode %q, must be one of %s, %s, %s",
+		m, WorkloadAdmissionDisabled, WorkloadAdmissionWarn, WorkloadAdmissionDeny)
+}
+
+// scaleSubresource is the subresource kubectl scale and autoscalers change the replicas of a workload with.
+const scaleSubresource = "scale"
+
+// scalableWorkload describes a workload whose scale subresource is projected like an update of its replicas.
+type scalableWorkload struct {
+	kind string
+	// newObject returns an empty workload to read
+	newObject func() client.Object
+	// setReplicas sets the replicas of the workload
+	setReplicas func(obj client.Object, replicas int32)
+}
+
+// scalableWorkloads are the workloads with a scale subresource by group resource.
+var scalableWorkloads = map[schema.GroupResource]scalableWorkload{
+	appsv1.SchemeGroupVersion.WithResource("deployments").GroupResource(): {
+		kind:        "Deployment",
+		newObject:   func() client.Object { return &appsv1.Deployment{} },
+		setReplicas: func(obj client.Object, replicas int32) { obj.(*appsv1.Deployment).Spec.Replicas = &replicas },
+	},
+	appsv1.SchemeGroupVersion.WithResource("statefulsets").GroupResource(): {
+		kind:        "StatefulSet",
+		newObject:   func() client.Object { return &appsv1.StatefulSet{} },
+		setReplicas: func(obj client.Object, replicas int32) { obj.(*appsv1.StatefulSet).Spec.Replicas = &replicas },
+	},
+	appsv1.SchemeGroupVersion.WithResource("replicasets").GroupResource(): {
+		kind:        "ReplicaSet",
+		newObject:   func() client.Object { return &appsv1.ReplicaSet{} },
+		setReplicas: func(obj client.Object, replicas int32) { obj.(*appsv1.ReplicaSet).Spec.Replicas = &replicas },
+	},
+}
+
+// isWorkloadScale returns true if the request scales a workload through its scale subresource.
+func isWorkloadScale(resource schema.GroupResource, subresource string) bool {
+	_, found := scalableWorkloads[resource]
+	return found && subresource == scaleSubresource
+}
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;replicasets,verbs=get
+
+// workloadAttributes returns the attributes to project the usage of: the update of the workload's replicas a scale
+// subresource request amounts to, or the attributes as is for other requests.  The workload is read from the API
+// server, the scale only carries its replicas.
+func (a *SharedQuotaAdmission) workloadAttributes(ctx context.Context, attributes admission.Attributes) (admission.Attributes, error) {
+	workload, found := scalableWorkloads[attributes.GetResource().GroupResource()]
+	if !found || attributes.GetSubresource() != scaleSubresource {
+		return attributes, nil
+	}
+	scale, ok := attributes.GetObject().(*autoscalingv1.Scale)
+	if !ok {
+		return nil, fmt.Errorf("expect *autoscalingv1.Scale, got %T", attributes.GetObject())
+	}
+	obj := workload.newObject()
+	if err := a.workloadReader.Get(ctx, client.ObjectKey{Namespace: attributes.GetNamespace(), Name: attributes.GetName()}, obj); err != nil {
+		return nil, err
+	}
+	oldObj := obj.DeepCopyObject().(client.Object)
+	if oldScale, ok := attributes.GetOldObject().(*autoscalingv1.Scale); ok {
+		workload.setReplicas(oldObj, oldScale.Spec.Replicas)
+	}
+	workload.setReplicas(obj, scale.Spec.Replicas)
+	resource := attributes.GetResource()
+	return admission.NewAttributesRecord(obj, oldObj, resource.GroupVersion().WithKind(workload.kind), attributes.GetNamespace(),
+		attributes.GetName(), resource, "", admission.Update, attributes.GetOperationOptions(), attributes.IsDryRun(),
+		attributes.GetUserInfo()), nil
+}
+
+// checkWorkload verifies that the pods the workload is going to create fit into the remaining quota.
+// It never updates quota usage, the pods are charged when they are admitted.
+func (a *SharedQuotaAdmission) checkWorkload(ctx context.Context, evaluator workload.Evaluator, attributes admission.Attributes) error {
+	projectedUsage, err := evaluator.ProjectedUsage(attributes)
+	if err != nil {
+		return err
+	}
+	if quota.IsZero(projectedUsage) {
+		return nil
+	}
+	pod, err := evaluator.PodTemplate(attributes.GetObject())
+	if err != nil {
+		return err
+	}
+	quotas, err := a.quotaAccessor.GetQuotas(ctx, attributes.GetNamespace())
+	if err != nil {
+		return err
+	}
+	podEvaluator := a.registry.Get(corev1.SchemeGroupVersion.WithResource("pods").GroupResource())
+	if podEvaluator == nil {
+		return nil
+	}
+	return CheckProjectedUsage(quotas, attributes, pod, podEvaluator, projectedUsage)
+}
+
+// CheckProjectedUsage verifies that the projected usage of a workload fits into the remaining usage of every
+// quota matching the workload's pod template.  It returns a forbidden error naming the first exceeded quota.
+func CheckProjectedUsage(quotas []corev1.ResourceQuota, a admission.Attributes, pod *corev1.Pod, podEvaluator quota.Evaluator,
+	projectedUsage corev1.ResourceList) error {
+	for i := range quotas {
+		resourceQuota := quotas[i]
+		match, err := podEvaluator.Matches(&resourceQuota, pod)
+		if err != nil {
+			return err
+		}
+		if !match {
+			continue
+		}
+
+		hardResources := quota.ResourceNames(resourceQuota.Status.Hard)
+		requestedUsage := quota.Mask(projectedUsage, hardResources)
+		newUsage := quota.Add(resourceQuota.Status.Used, requestedUsage)
+		maskedNewUsage := quota.Mask(newUsage, quota.ResourceNames(requestedUsage))
+
+		if allowed, exceeded := quota.LessThanOrEqual(maskedNewUsage, resourceQuota.Status.Hard); !allowed {
+			failedRequestedUsage := quota.Mask(requestedUsage, exceeded)
+			failedUsed := quota.Mask(resourceQuota.Status.Used, exceeded)
+			failedHard := quota.Mask(resourceQuota.Status.Hard, exceeded)
+			return admission.NewForbidden(a,
+				fmt.Errorf("projected usage exceeds quota: %s, requested: %s, used: %s, limited: %s",
+					resourceQuota.Name,
+					prettyPrint(failedRequestedUsage),
+					prettyPrint(failedUsed),
+					prettyPrint(failedHard)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"caih.com/internal/webhook/v1/fake"
+	"caih.com/pkg/scheme"
+)
+
+func newWorkloadDeployment(replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "deployment"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:      "app",
+						Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func newScale(replicas int32) *autoscalingv1.Scale {
+	return &autoscalingv1.Scale{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "autoscaling/v1", Kind: "Scale"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "deployment"},
+		Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+	}
+}
+
+// newWorkloadRequest returns a request for the deployments resource, or its subresource if set.
+func newWorkloadRequest(t *testing.T, operation admissionv1.Operation, subresource string, obj, oldObj runtime.Object) admission.Request {
+	raw := func(obj runtime.Object) runtime.RawExtension {
+		if obj == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: data}
+	}
+	kind := metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	if subresource == scaleSubresource {
+		kind = metav1.GroupVersionKind{Group: "autoscaling", Version: "v1", Kind: "Scale"}
+	}
+	deployments := metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		UID:                "uid",
+		Kind:               kind,
+		Resource:           deployments,
+		SubResource:        subresource,
+		RequestKind:        &kind,
+		RequestResource:    &deployments,
+		RequestSubResource: subresource,
+		Namespace:          "namespace",
+		Name:               "deployment",
+		Operation:          operation,
+		Object:             raw(obj),
+		OldObject:          raw(oldObj),
+		DryRun:             ptr.To(false),
+	}}
+}
+
+func newWorkloadAdmission(t *testing.T, mode WorkloadAdmissionMode, objects ...client.Object) *SharedQuotaAdmission {
+	accessor := fake.NewQuotaAccessor()
+	accessor.AddQuota("quota", corev1.ResourceList{
+		corev1.ResourcePods:        resource.MustParse("4"),
+		corev1.ResourceRequestsCPU: resource.MustParse("1"),
+	}, "namespace")
+	c := clientfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+	sharedQuotaAdmission, err := NewSharedQuotaAdmission(c, scheme.Scheme, accessor, Options{WorkloadAdmission: mode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sharedQuotaAdmission
+}
+
+func TestWorkloadAdmission(t *testing.T) {
+	testCases := map[string]struct {
+		mode     WorkloadAdmissionMode
+		request  func(t *testing.T) admission.Request
+		allowed  bool
+		warnings bool
+	}{
+		"fitting deployment": {
+			mode: WorkloadAdmissionDeny,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Create, "", newWorkloadDeployment(4), nil)
+			},
+			allowed: true,
+		},
+		"exceeding deployment denied": {
+			mode: WorkloadAdmissionDeny,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Create, "", newWorkloadDeployment(5), nil)
+			},
+			allowed: false,
+		},
+		"exceeding deployment warned": {
+			mode: WorkloadAdmissionWarn,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Create, "", newWorkloadDeployment(5), nil)
+			},
+			allowed:  true,
+			warnings: true,
+		},
+		"exceeding deployment not projected": {
+			mode: WorkloadAdmissionDisabled,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Create, "", newWorkloadDeployment(5), nil)
+			},
+			allowed: true,
+		},
+		"exceeding scale denied": {
+			mode: WorkloadAdmissionDeny,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Update, scaleSubresource, newScale(7), newScale(2))
+			},
+			allowed: false,
+		},
+		"exceeding scale warned": {
+			mode: WorkloadAdmissionWarn,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Update, scaleSubresource, newScale(7), newScale(2))
+			},
+			allowed:  true,
+			warnings: true,
+		},
+		"fitting scale": {
+			mode: WorkloadAdmissionDeny,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Update, scaleSubresource, newScale(4), newScale(2))
+			},
+			allowed: true,
+		},
+		"scale not projected": {
+			mode: WorkloadAdmissionDisabled,
+			request: func(t *testing.T) admission.Request {
+				return newWorkloadRequest(t, admissionv1.Update, scaleSubresource, newScale(7), newScale(2))
+			},
+			allowed: true,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sharedQuotaAdmission := newWorkloadAdmission(t, testCase.mode, newWorkloadDeployment(2))
+			resp := sharedQuotaAdmission.Handle(context.Background(), testCase.request(t))
+			if resp.Allowed != testCase.allowed {
+				t.Errorf("expected allowed %v, got %v: %v", testCase.allowed, resp.Allowed, resp.Result)
+			}
+			if (len(resp.Warnings) > 0) != testCase.warnings {
+				t.Errorf("expected warnings %v, got %v", testCase.warnings, resp.Warnings)
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation"
 )
 
@@ -96,3 +97,87 @@ func ScopedResourceSelectorRequirementsAsSelector(ssr v1.ScopedResourceSelectorR
 	selector = selector.Add(*r)
 	return selector, nil
 }
+
+var standardQuotaResources = sets.New(
+	v1.ResourceCPU,
+	v1.ResourceMemory,
+	v1.ResourceEphemeralStorage,
+	v1.ResourceRequestsCPU,
+	v1.ResourceRequestsMemory,
+	v1.ResourceRequestsStorage,
+	v1.ResourceRequestsEphemeralStorage,
+	v1.ResourceLimitsCPU,
+	v1.ResourceLimitsMemory,
+	v1.ResourceLimitsEphemeralStorage,
+	v1.ResourcePods,
+	v1.ResourceQuotas,
+	v1.ResourceServices,
+	v1.ResourceReplicationControllers,
+	v1.ResourceSecrets,
+	v1.ResourcePersistentVolumeClaims,
+	v1.ResourceConfigMaps,
+	v1.ResourceServicesNodePorts,
+	v1.ResourceServicesLoadBalancers,
+)
+
+// IsStandardQuotaResourceName returns true if the resource is known to
+// the quota tracking system
+func IsStandardQuotaResourceName(name v1.ResourceName) bool {
+	return standardQuotaResources.Has(name) || IsQuotaHugePageResourceName(name)
+}
+
+// IsQuotaHugePageResourceName returns true if the resource name has the quota
+// related huge page resource prefix.
+func IsQuotaHugePageResourceName(name v1.ResourceName) bool {
+	return strings.HasPrefix(string(name), v1.ResourceHugePagesPrefix) || strings.HasPrefix(string(name), v1.ResourceRequestsHugePagesPrefix)
+}
+
+// IsValidQuotaResourceName returns true if the resource name passes the
+// validation of the hard limits of a ResourceQuota: it is qualified, and
+// standard unless it is prefixed.
+func IsValidQuotaResourceName(name v1.ResourceName) bool {
+	if errs := validation.IsQualifiedName(string(name)); len(errs) != 0 {
+		return false
+	}
+	return strings.Contains(string(name), "/") || IsStandardQuotaResourceName(name)
+}
+
+var standardResourceQuotaScopes = sets.New(
+	v1.ResourceQuotaScopeTerminating,
+	v1.ResourceQuotaScopeNotTerminating,
+	v1.ResourceQuotaScopeBestEffort,
+	v1.ResourceQuotaScopeNotBestEffort,
+	v1.ResourceQuotaScopePriorityClass,
+	v1.ResourceQuotaScopeCrossNamespacePodAffinity,
+)
+
+// IsStandardResourceQuotaScope returns true if the scope is a standard value
+func IsStandardResourceQuotaScope(scope v1.ResourceQuotaScope) bool {
+	return standardResourceQuotaScopes.Has(scope)
+}
+
+var podObjectCountQuotaResources = sets.New(
+	v1.ResourcePods,
+)
+
+var podComputeQuotaResources = sets.New(
+	v1.ResourceCPU,
+	v1.ResourceMemory,
+	v1.ResourceLimitsCPU,
+	v1.ResourceLimitsMemory,
+	v1.ResourceRequestsCPU,
+	v1.ResourceRequestsMemory,
+)
+
+// IsResourceQuotaScopeValidForResource returns true if the resource applies to the specified scope
+func IsResourceQuotaScopeValidForResource(scope v1.ResourceQuotaScope, resource v1.ResourceName) bool {
+	switch scope {
+	case v1.ResourceQuotaScopeTerminating, v1.ResourceQuotaScopeNotTerminating, v1.ResourceQuotaScopeNotBestEffort,
+		v1.ResourceQuotaScopePriorityClass, v1.ResourceQuotaScopeCrossNamespacePodAffinity:
+		return podObjectCountQuotaResources.Has(resource) || podComputeQuotaResources.Has(resource)
+	case v1.ResourceQuotaScopeBestEffort:
+		return podObjectCountQuotaResources.Has(resource)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads the shared quota component configuration and reloads it when the file changes.
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission/plugin/resourcequota"
+	resourcequotaapi "k8s.io/apiserver/pkg/admission/plugin/resourcequota/apis/resourcequota"
+	resourcequotavalidation "k8s.io/apiserver/pkg/admission/plugin/resourcequota/apis/resourcequota/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"caih.com/pkg/config/v1alpha1"
+)
+
+// DefaultReloadInterval is how often the configuration file is checked for changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// Load reads, defaults and validates the configuration file.  An empty path returns the default configuration.
+func Load(path string) (*v1alpha1.SharedQuotaConfiguration, error) {
+	var data []byte
+	if len(path) > 0 {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return decode(data)
+}
+
+// LoadResourceQuotaConfiguration reads and validates a kube-apiserver ResourceQuota admission configuration file.
+// An empty path returns the default configuration, which limits no resource.
+func LoadResourceQuotaConfiguration(path string) (*resourcequotaapi.Configuration, error) {
+	var reader io.Reader
+	if len(path) > 0 {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	cfg, err := resourcequota.LoadConfiguration(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode resource quota configuration: %w", err)
+	}
+	if errs := resourcequotavalidation.ValidateConfiguration(cfg); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid resource quota configuration: %w", errs.ToAggregate())
+	}
+	return cfg, nil
+}
+
+func decode(data []byte) (*v1alpha1.SharedQuotaConfiguration, error) {
+	cfg := &v1alpha1.SharedQuotaConfiguration{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	v1alpha1.SetDefaults_SharedQuotaConfiguration(cfg)
+	if errs := v1alpha1.ValidateSharedQuotaConfiguration(cfg); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errs.ToAggregate())
+	}
+	return cfg, nil
+}
+
+// Watcher reloads the configuration file and notifies its listeners of the new configuration.  Fields that require
+// a restart keep their value from the configuration the process started with.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	lock      sync.Mutex
+	data      []byte
+	current   *v1alpha1.SharedQuotaConfiguration
+	listeners []func(*v1alpha1.SharedQuotaConfiguration)
+}
+
+// NewWatcher returns a watcher of the file the current configuration was loaded from.
+func NewWatcher(path string, current *v1alpha1.SharedQuotaConfiguration) (*Watcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{path: path, interval: DefaultReloadInterval, data: data, current: current}, nil
+}
+
+// AddListener registers a function called with the new configuration after every change.  Listeners must not
+// modify the configuration.
+func (w *Watcher) AddListener(listener func(*v1alpha1.SharedQuotaConfiguration)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.listeners = append(w.listeners, listener)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica reloads its configuration.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start checks the file for changes until the context is done.
+func (w *Watcher) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := w.reload(); err != nil {
+			klog.Errorf("failed to reload configuration %s, keeping the current configuration: %v", w.path, err)
+		}
+	}, w.interval)
+	return nil
+}
+
+func (w *Watcher) reload() error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if bytes.Equal(data, w.data) {
+		return nil
+	}
+	cfg, err := decode(data)
+	if err != nil {
+		return err
+	}
+	w.data = data
+
+	// structural fields size workers and caches that are only created at startup
+	if *cfg.Controller.MaxConcurrentReconciles != *w.current.Controller.MaxConcurrentReconciles ||
+		*cfg.Controller.ResourceQuotaViews != *w.current.Controller.ResourceQuotaViews ||
+		*cfg.Webhook.EvaluatorWorkers != *w.current.Webhook.EvaluatorWorkers ||
+		*cfg.Webhook.QuotaCacheSize != *w.current.Webhook.QuotaCacheSize ||
+		cfg.Webhook.ResourceQuotaConfigurationFile != w.current.Webhook.ResourceQuotaConfigurationFile {
+		klog.Warningf("configuration %s changed fields that require a restart, they are ignored until then", w.path)
+	}
+	cfg.Controller.MaxConcurrentReconciles = w.current.Controller.MaxConcurrentReconciles
+	cfg.Controller.ResourceQuotaViews = w.current.Controller.ResourceQuotaViews
+	cfg.Webhook.EvaluatorWorkers = w.current.Webhook.EvaluatorWorkers
+	cfg.Webhook.QuotaCacheSize = w.current.Webhook.QuotaCacheSize
+	cfg.Webhook.ResourceQuotaConfigurationFile = w.current.Webhook.ResourceQuotaConfigurationFile
+	if equality.Semantic.DeepEqual(cfg, w.current) {
+		return nil
+	}
+
+	klog.Infof("reloaded configuration %s", w.path)
+	w.current = cfg
+	for _, listener := range w.listeners {
+		listener(cfg)
+	}
+	return nil
+}
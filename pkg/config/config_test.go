@@ -0,0 +1,370 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+
+	quotav1 "caih.com/api/v1"
+	"caih.com/pkg/config/v1alpha1"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func defaultConfiguration() *v1alpha1.SharedQuotaConfiguration {
+	cfg := &v1alpha1.SharedQuotaConfiguration{}
+	v1alpha1.SetDefaults_SharedQuotaConfiguration(cfg)
+	return cfg
+}
+
+func TestLoad(t *testing.T) {
+	testCases := map[string]struct {
+		data        string
+		expected    func(cfg *v1alpha1.SharedQuotaConfiguration)
+		expectedErr string
+	}{
+		"defaults": {
+			data: `apiVersion: config.quota.caih.com/v1alpha1
+kind: SharedQuotaConfiguration
+`,
+		},
+		"kind defaults": {
+			data: `controller:
+  resyncPeriod: 1m
+`,
+			expected: func(cfg *v1alpha1.SharedQuotaConfiguration) {
+				cfg.Controller.ResyncPeriod = &metav1.Duration{Duration: time.Minute}
+			},
+		},
+		"every field": {
+			data: `apiVersion: config.quota.caih.com/v1alpha1
+kind: SharedQuotaConfiguration
+controller:
+  maxConcurrentReconciles: 2
+  resyncPeriod: 1m
+  resourceQuotaViews: true
+webhook:
+  evaluatorWorkers: 4
+  evaluationTimeout: 5s
+  quotaLookupTimeout: 4s
+  quotaCacheSize: 10
+  resourceQuotaConfigurationFile: /etc/quota/resourcequota.yaml
+  failurePolicy: Open
+  circuitBreaker:
+    failureThreshold: 3
+    openDuration: 1m
+`,
+			expected: func(cfg *v1alpha1.SharedQuotaConfiguration) {
+				cfg.Controller.MaxConcurrentReconciles = ptr.To[int32](2)
+				cfg.Controller.ResyncPeriod = &metav1.Duration{Duration: time.Minute}
+				cfg.Controller.ResourceQuotaViews = ptr.To(true)
+				cfg.Webhook.EvaluatorWorkers = ptr.To[int32](4)
+				cfg.Webhook.EvaluationTimeout = &metav1.Duration{Duration: 5 * time.Second}
+				cfg.Webhook.QuotaLookupTimeout = &metav1.Duration{Duration: 4 * time.Second}
+				cfg.Webhook.QuotaCacheSize = ptr.To[int32](10)
+				cfg.Webhook.ResourceQuotaConfigurationFile = "/etc/quota/resourcequota.yaml"
+				cfg.Webhook.FailurePolicy = quotav1.FailOpen
+				cfg.Webhook.CircuitBreaker.FailureThreshold = ptr.To[int32](3)
+				cfg.Webhook.CircuitBreaker.OpenDuration = &metav1.Duration{Duration: time.Minute}
+			},
+		},
+		"unknown field": {
+			data: `webhook:
+  evaluationTimeouts: 5s
+`,
+			expectedErr: "failed to decode configuration",
+		},
+		"unsupported version": {
+			data: `apiVersion: config.quota.caih.com/v1
+kind: SharedQuotaConfiguration
+`,
+			expectedErr: "apiVersion",
+		},
+		"lookup timeout as long as the evaluation timeout": {
+			data: `webhook:
+  evaluationTimeout: 5s
+  quotaLookupTimeout: 5s
+`,
+			expectedErr: "webhook.quotaLookupTimeout",
+		},
+		"lookup timeout longer than the default evaluation timeout": {
+			data: `webhook:
+  quotaLookupTimeout: 12s
+`,
+			expectedErr: "must be shorter than webhook.evaluationTimeout",
+		},
+		"zero workers": {
+			data: `webhook:
+  evaluatorWorkers: 0
+`,
+			expectedErr: "webhook.evaluatorWorkers",
+		},
+		"negative resync period": {
+			data: `controller:
+  resyncPeriod: -1m
+`,
+			expectedErr: "controller.resyncPeriod",
+		},
+		"unsupported failure policy": {
+			data: `webhook:
+  failurePolicy: Ignore
+`,
+			expectedErr: "webhook.failurePolicy",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			writeFile(t, path, tc.data)
+			cfg, err := Load(path)
+			if len(tc.expectedErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := defaultConfiguration()
+			if tc.expected != nil {
+				tc.expected(expected)
+			}
+			if !equality.Semantic.DeepEqual(cfg, expected) {
+				t.Errorf("expected %+v, got %+v", expected, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(cfg, defaultConfiguration()) {
+		t.Errorf("expected the default configuration, got %+v", cfg)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestLoadResourceQuotaConfiguration(t *testing.T) {
+	cfg, err := LoadResourceQuotaConfiguration("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.LimitedResources) != 0 {
+		t.Errorf("expected no limited resources by default, got %+v", cfg.LimitedResources)
+	}
+
+	path := filepath.Join(t.TempDir(), "resourcequota.yaml")
+	writeFile(t, path, `apiVersion: apiserver.config.k8s.io/v1
+kind: ResourceQuotaConfiguration
+limitedResources:
+- resource: pods
+  matchContains:
+  - requests.cpu
+`)
+	cfg, err = LoadResourceQuotaConfiguration(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.LimitedResources) != 1 || cfg.LimitedResources[0].Resource != "pods" ||
+		len(cfg.LimitedResources[0].MatchContains) != 1 || cfg.LimitedResources[0].MatchContains[0] != "requests.cpu" {
+		t.Errorf("unexpected limited resources %+v", cfg.LimitedResources)
+	}
+
+	writeFile(t, path, `apiVersion: apiserver.config.k8s.io/v1
+kind: ResourceQuotaConfiguration
+limitedResources:
+- matchContains:
+  - requests.cpu
+`)
+	if _, err := LoadResourceQuotaConfiguration(path); err == nil || !strings.Contains(err.Error(), "invalid resource quota configuration") {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, `webhook:
+  evaluationTimeout: 5s
+  quotaLookupTimeout: 4s
+`)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w, err := NewWatcher(path, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var reloaded []*v1alpha1.SharedQuotaConfiguration
+	w.AddListener(func(cfg *v1alpha1.SharedQuotaConfiguration) {
+		reloaded = append(reloaded, cfg)
+	})
+
+	steps := []struct {
+		name          string
+		data          string
+		expectedErr   bool
+		expectedCalls int
+		expected      func(cfg *v1alpha1.SharedQuotaConfiguration)
+	}{
+		{
+			name: "unchanged file",
+			data: `webhook:
+  evaluationTimeout: 5s
+  quotaLookupTimeout: 4s
+`,
+		},
+		{
+			name: "reformatted file",
+			data: `webhook: {evaluationTimeout: 5s, quotaLookupTimeout: 4s}
+`,
+		},
+		{
+			name: "changed timeouts",
+			data: `webhook:
+  evaluationTimeout: 20s
+  quotaLookupTimeout: 15s
+`,
+			expectedCalls: 1,
+			expected: func(cfg *v1alpha1.SharedQuotaConfiguration) {
+				cfg.Webhook.EvaluationTimeout = &metav1.Duration{Duration: 20 * time.Second}
+				cfg.Webhook.QuotaLookupTimeout = &metav1.Duration{Duration: 15 * time.Second}
+			},
+		},
+		{
+			name: "invalid configuration",
+			data: `webhook:
+  evaluationTimeout: 5s
+  quotaLookupTimeout: 15s
+`,
+			expectedErr:   true,
+			expectedCalls: 1,
+		},
+		{
+			name: "fields that require a restart",
+			data: `controller:
+  maxConcurrentReconciles: 1
+  resourceQuotaViews: true
+webhook:
+  evaluatorWorkers: 1
+  evaluationTimeout: 20s
+  quotaLookupTimeout: 15s
+  quotaCacheSize: 1
+  resourceQuotaConfigurationFile: /etc/quota/resourcequota.yaml
+`,
+			expectedCalls: 1,
+		},
+		{
+			name: "fields that require a restart with a reloadable one",
+			data: `controller:
+  maxConcurrentReconciles: 1
+webhook:
+  evaluationTimeout: 20s
+  quotaLookupTimeout: 15s
+  failurePolicy: Open
+`,
+			expectedCalls: 2,
+			expected: func(cfg *v1alpha1.SharedQuotaConfiguration) {
+				cfg.Webhook.FailurePolicy = quotav1.FailOpen
+			},
+		},
+	}
+	// loaded apart from the configuration the watcher replaces
+	expected, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, step := range steps {
+		writeFile(t, path, step.data)
+		err := w.reload()
+		if step.expectedErr != (err != nil) {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if len(reloaded) != step.expectedCalls {
+			t.Fatalf("%s: expected %d reloads, got %d", step.name, step.expectedCalls, len(reloaded))
+		}
+		if step.expected != nil {
+			step.expected(expected)
+		}
+		if !equality.Semantic.DeepEqual(w.current, expected) {
+			t.Errorf("%s: expected %+v, got %+v", step.name, expected, w.current)
+		}
+	}
+}
+
+func TestWatcherStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "")
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w, err := NewWatcher(path, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.interval = 10 * time.Millisecond
+	reloaded := make(chan *v1alpha1.SharedQuotaConfiguration, 1)
+	w.AddListener(func(cfg *v1alpha1.SharedQuotaConfiguration) {
+		reloaded <- cfg
+	})
+	if w.NeedLeaderElection() {
+		t.Errorf("expected every replica to reload its configuration")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Start(ctx)
+	}()
+	writeFile(t, path, `webhook:
+  failurePolicy: Open
+`)
+	select {
+	case cfg := <-reloaded:
+		if cfg.Webhook.FailurePolicy != quotav1.FailOpen {
+			t.Errorf("expected the reloaded failure policy, got %v", cfg.Webhook.FailurePolicy)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the configuration to be reloaded")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
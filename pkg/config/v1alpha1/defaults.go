@@ -0,0 +1,79 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	quotav1 "caih.com/api/v1"
+)
+
+const (
+	DefaultMaxConcurrentReconciles = 8
+	DefaultResyncPeriod            = 5 * time.Minute
+	DefaultEvaluatorWorkers        = 10
+	DefaultEvaluationTimeout       = 10 * time.Second
+	DefaultQuotaLookupTimeout      = 8 * time.Second
+	DefaultQuotaCacheSize          = 100
+	DefaultFailureThreshold        = 5
+	DefaultOpenDuration            = 30 * time.Second
+)
+
+// SetDefaults_SharedQuotaConfiguration sets the unset fields of the configuration to their default.
+func SetDefaults_SharedQuotaConfiguration(obj *SharedQuotaConfiguration) {
+	if len(obj.APIVersion) == 0 {
+		obj.APIVersion = SchemeGroupVersion.String()
+	}
+	if len(obj.Kind) == 0 {
+		obj.Kind = "SharedQuotaConfiguration"
+	}
+	controller := &obj.Controller
+	if controller.MaxConcurrentReconciles == nil {
+		controller.MaxConcurrentReconciles = ptr.To[int32](DefaultMaxConcurrentReconciles)
+	}
+	if controller.ResyncPeriod == nil {
+		controller.ResyncPeriod = &metav1.Duration{Duration: DefaultResyncPeriod}
+	}
+	if controller.ResourceQuotaViews == nil {
+		controller.ResourceQuotaViews = ptr.To(false)
+	}
+	webhook := &obj.Webhook
+	if webhook.EvaluatorWorkers == nil {
+		webhook.EvaluatorWorkers = ptr.To[int32](DefaultEvaluatorWorkers)
+	}
+	if webhook.EvaluationTimeout == nil {
+		webhook.EvaluationTimeout = &metav1.Duration{Duration: DefaultEvaluationTimeout}
+	}
+	if webhook.QuotaLookupTimeout == nil {
+		webhook.QuotaLookupTimeout = &metav1.Duration{Duration: DefaultQuotaLookupTimeout}
+	}
+	if webhook.QuotaCacheSize == nil {
+		webhook.QuotaCacheSize = ptr.To[int32](DefaultQuotaCacheSize)
+	}
+	if len(webhook.FailurePolicy) == 0 {
+		webhook.FailurePolicy = quotav1.FailClosed
+	}
+	if webhook.CircuitBreaker.FailureThreshold == nil {
+		webhook.CircuitBreaker.FailureThreshold = ptr.To[int32](DefaultFailureThreshold)
+	}
+	if webhook.CircuitBreaker.OpenDuration == nil {
+		webhook.CircuitBreaker.OpenDuration = &metav1.Duration{Duration: DefaultOpenDuration}
+	}
+}
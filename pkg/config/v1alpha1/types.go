@@ -0,0 +1,110 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the v1alpha1 version of the shared quota component configuration.
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// GroupName is the group of the component configuration.
+const GroupName = "config.quota.caih.com"
+
+// SchemeGroupVersion is the group version of the component configuration.
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+
+// SharedQuotaConfiguration configures the shared quota controller and admission webhook.
+type SharedQuotaConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Controller configures the SharedQuota controller.
+	// +optional
+	Controller ControllerConfiguration `json:"controller,omitempty"`
+
+	// Webhook configures the shared quota admission webhook.
+	// +optional
+	Webhook WebhookConfiguration `json:"webhook,omitempty"`
+}
+
+// ControllerConfiguration configures the SharedQuota controller.
+type ControllerConfiguration struct {
+	// MaxConcurrentReconciles is the number of SharedQuotas reconciled in parallel.  Changes require a restart.
+	// Defaults to 8.
+	// +optional
+	MaxConcurrentReconciles *int32 `json:"maxConcurrentReconciles,omitempty"`
+
+	// ResyncPeriod is the period of the full recalculation of the usage of a SharedQuota.  Defaults to 5m.
+	// +optional
+	ResyncPeriod *metav1.Duration `json:"resyncPeriod,omitempty"`
+
+	// ResourceQuotaViews mirrors every SharedQuota into a ResourceQuota in each namespace it selects, for the tools
+	// that only understand ResourceQuotas.  Changes require a restart.  Defaults to false.
+	// +optional
+	ResourceQuotaViews *bool `json:"resourceQuotaViews,omitempty"`
+}
+
+// WebhookConfiguration configures the shared quota admission webhook.
+type WebhookConfiguration struct {
+	// EvaluatorWorkers is the number of namespaces whose admissions are evaluated in parallel.  Changes require a
+	// restart.  Defaults to 10.
+	// +optional
+	EvaluatorWorkers *int32 `json:"evaluatorWorkers,omitempty"`
+
+	// EvaluationTimeout is how long an admission waits for its evaluation before failing.  Defaults to 10s.
+	// +optional
+	EvaluationTimeout *metav1.Duration `json:"evaluationTimeout,omitempty"`
+
+	// QuotaLookupTimeout is how long an evaluation waits for the namespace and its quotas to be observed by the
+	// cache.  It must be shorter than EvaluationTimeout.  Defaults to 8s.
+	// +optional
+	QuotaLookupTimeout *metav1.Duration `json:"quotaLookupTimeout,omitempty"`
+
+	// QuotaCacheSize is the number of quotas whose ledgers updated by this replica are kept to evaluate back to
+	// back admissions against the latest usage.  Changes require a restart.  Defaults to 100.
+	// +optional
+	QuotaCacheSize *int32 `json:"quotaCacheSize,omitempty"`
+
+	// ResourceQuotaConfigurationFile is the path of a kube-apiserver ResourceQuota admission configuration
+	// (apiserver.config.k8s.io/v1 ResourceQuotaConfiguration).  Its limitedResources must be covered by a quota for
+	// objects consuming them to be admitted.  Changes require a restart.
+	// +optional
+	ResourceQuotaConfigurationFile string `json:"resourceQuotaConfigurationFile,omitempty"`
+
+	// FailurePolicy is how admissions are handled when they cannot be evaluated, Open admits them and marks them as
+	// unverified, Closed rejects them.  SharedQuotas can override it.  Defaults to Closed.
+	// +optional
+	FailurePolicy quotav1.FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// CircuitBreaker stops evaluating admissions after repeated errors.
+	// +optional
+	CircuitBreaker CircuitBreakerConfiguration `json:"circuitBreaker,omitempty"`
+}
+
+// CircuitBreakerConfiguration configures the circuit breaker of the admission webhook.  While the breaker is open,
+// admissions are handled by the failure policy without being evaluated.
+type CircuitBreakerConfiguration struct {
+	// FailureThreshold is the number of consecutive evaluation errors that open the breaker.  Defaults to 5.
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+
+	// OpenDuration is how long the breaker stays open before an admission is evaluated again.  Defaults to 30s.
+	// +optional
+	OpenDuration *metav1.Duration `json:"openDuration,omitempty"`
+}
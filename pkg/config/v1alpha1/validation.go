@@ -0,0 +1,80 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// ValidateSharedQuotaConfiguration validates a defaulted configuration.
+func ValidateSharedQuotaConfiguration(obj *SharedQuotaConfiguration) field.ErrorList {
+	var allErrs field.ErrorList
+	if obj.APIVersion != SchemeGroupVersion.String() {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("apiVersion"), obj.APIVersion, []string{SchemeGroupVersion.String()}))
+	}
+	if obj.Kind != "SharedQuotaConfiguration" {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("kind"), obj.Kind, []string{"SharedQuotaConfiguration"}))
+	}
+
+	controllerPath := field.NewPath("controller")
+	allErrs = append(allErrs, validatePositive(controllerPath.Child("maxConcurrentReconciles"), obj.Controller.MaxConcurrentReconciles)...)
+	allErrs = append(allErrs, validatePositiveDuration(controllerPath.Child("resyncPeriod"), obj.Controller.ResyncPeriod)...)
+
+	webhookPath := field.NewPath("webhook")
+	allErrs = append(allErrs, validatePositive(webhookPath.Child("evaluatorWorkers"), obj.Webhook.EvaluatorWorkers)...)
+	allErrs = append(allErrs, validatePositiveDuration(webhookPath.Child("evaluationTimeout"), obj.Webhook.EvaluationTimeout)...)
+	allErrs = append(allErrs, validatePositiveDuration(webhookPath.Child("quotaLookupTimeout"), obj.Webhook.QuotaLookupTimeout)...)
+	allErrs = append(allErrs, validatePositive(webhookPath.Child("quotaCacheSize"), obj.Webhook.QuotaCacheSize)...)
+	switch obj.Webhook.FailurePolicy {
+	case quotav1.FailOpen, quotav1.FailClosed:
+	default:
+		allErrs = append(allErrs, field.NotSupported(webhookPath.Child("failurePolicy"), obj.Webhook.FailurePolicy,
+			[]string{string(quotav1.FailOpen), string(quotav1.FailClosed)}))
+	}
+	circuitBreakerPath := webhookPath.Child("circuitBreaker")
+	allErrs = append(allErrs, validatePositive(circuitBreakerPath.Child("failureThreshold"), obj.Webhook.CircuitBreaker.FailureThreshold)...)
+	allErrs = append(allErrs, validatePositiveDuration(circuitBreakerPath.Child("openDuration"), obj.Webhook.CircuitBreaker.OpenDuration)...)
+	if obj.Webhook.EvaluationTimeout != nil && obj.Webhook.QuotaLookupTimeout != nil &&
+		obj.Webhook.QuotaLookupTimeout.Duration >= obj.Webhook.EvaluationTimeout.Duration {
+		allErrs = append(allErrs, field.Invalid(webhookPath.Child("quotaLookupTimeout"), obj.Webhook.QuotaLookupTimeout.Duration.String(),
+			"must be shorter than webhook.evaluationTimeout"))
+	}
+	return allErrs
+}
+
+func validatePositive(path *field.Path, value *int32) field.ErrorList {
+	if value == nil {
+		return field.ErrorList{field.Required(path, "")}
+	}
+	if *value <= 0 {
+		return field.ErrorList{field.Invalid(path, *value, "must be greater than zero")}
+	}
+	return nil
+}
+
+func validatePositiveDuration(path *field.Path, value *metav1.Duration) field.ErrorList {
+	if value == nil {
+		return field.ErrorList{field.Required(path, "")}
+	}
+	if value.Duration <= 0 {
+		return field.ErrorList{field.Invalid(path, value.Duration.String(), "must be greater than zero")}
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package features
 
 import (
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/component-base/featuregate"
 )
 
@@ -27,3 +29,15 @@ const (
 
 	ExpandPersistentVolumes featuregate.Feature = "ExpandPersistentVolumes"
 )
+
+func init() {
+	utilruntime.Must(utilfeature.DefaultMutableFeatureGate.Add(defaultSharedQuotaFeatureGates))
+}
+
+// defaultSharedQuotaFeatureGates consists of all known feature keys specific to shared quota.
+// To add a new feature, define a key for it above and add it here. The features will be
+// available throughout the binary via utilfeature.DefaultFeatureGate and can be toggled
+// with the --feature-gates flag.
+var defaultSharedQuotaFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	ExpandPersistentVolumes: {Default: true, PreRelease: featuregate.Beta},
+}
@@ -2,114 +2,323 @@ package quota
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/storage"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	quotav1 "caih.com/api/v1"
 )
 
+// UsageErrorAnnotation is set on the quotas returned by GetQuotas whose usage could not be calculated, to the message
+// of their UsageCalculated condition.  Their usage is stale, admissions matching them are rejected.
+const UsageErrorAnnotation = "quota.caih.com/usage-error"
+
+// ResourceQuotaViewPrefix prefixes the name of the SharedQuota mirrored by a ResourceQuota.
+const ResourceQuotaViewPrefix = "sharedquota-"
+
+const (
+	// ResourceQuotaViewUsedAnnotation is set on a ResourceQuota view to the usage of the SharedQuota across all its
+	// namespaces, as a JSON resource list.
+	ResourceQuotaViewUsedAnnotation = "quota.caih.com/total-used"
+	// ResourceQuotaViewRemainingAnnotation is set on a ResourceQuota view to the headroom left in the SharedQuota, as
+	// a JSON resource list.
+	ResourceQuotaViewRemainingAnnotation = "quota.caih.com/remaining"
+)
+
+// IsResourceQuotaViewOf returns true if the ResourceQuota mirrors the SharedQuota of the given name: it is named after
+// the SharedQuota and controlled by it.  The label of a view can be set on any ResourceQuota, so it is not trusted.
+func IsResourceQuotaViewOf(resourceQuota *corev1.ResourceQuota, name string) bool {
+	if resourceQuota.Name != ResourceQuotaViewPrefix+name {
+		return false
+	}
+	owner := metav1.GetControllerOf(resourceQuota)
+	return owner != nil && owner.Kind == "SharedQuota" && owner.Name == name &&
+		strings.HasPrefix(owner.APIVersion, quotav1.GroupVersion.Group+"/")
+}
+
+// FieldManager owns the reservations applied to the ledgers by admission.
+const FieldManager = "sharedquota-admission"
+
+const (
+	// DefaultQuotaCacheSize is the number of quotas whose updated ledgers are kept by the accessor.
+	DefaultQuotaCacheSize = 100
+	// DefaultQuotaLookupTimeout is how long the accessor waits for the namespace and its quotas to be observed.
+	DefaultQuotaLookupTimeout = 8 * time.Second
+)
+
 type accessor struct {
 	client client.Client
+	// reader reads the quota and its ledger in the namespace from the API server before usage is reserved
+	reader       client.Reader
+	mappingCache *QuotaMappingCache
+	clock        clock.Clock
+	// lookupTimeout bounds the wait for the mapping cache, in nanoseconds
+	lookupTimeout atomic.Int64
 
-	// updatedResourceQuotas holds a cache of quotas that we've updated.  This is used to pull the "really latest" during back to
-	// back quota evaluations that touch the same quota doc.  This only works because we can compare etcd resourceVersions
-	// for the same resource as integers.  Before this change: 22 updates with 12 conflicts.  after this change: 15 updates with 0 conflicts
-	updatedResourceQuotas *lru.Cache
+	// updatedLedgers holds a cache of ledgers that we've read or updated, by quota name and then namespace.  This is
+	// used to pull the "really latest" during back to back quota evaluations that touch the same quota doc.  This only
+	// works because we can compare etcd resourceVersions for the same resource as integers.  The maps are replaced,
+	// not modified, under ledgersLock.
+	updatedLedgers *lru.Cache
+	ledgersLock    sync.Mutex
 }
 
 // NewQuotaAccessor creates an object that conforms to the QuotaAccessor interface to be used to retrieve quota objects.
-func NewQuotaAccessor(client client.Client) *accessor {
-	updatedCache, err := lru.New(100)
+// Quotas are checked against the objects of the client's cache and their reservations are committed after reading
+// them again with the reader.  It keeps the updated ledgers of up to cacheSize quotas, which must be positive.  The
+// cache of the client is indexed by IndexLedgers.
+func NewQuotaAccessor(client client.Client, reader client.Reader, mappingCache *QuotaMappingCache, cacheSize int) *accessor {
+	updatedCache, err := lru.New(cacheSize)
 	if err != nil {
 		// this should never happen
 		panic(err)
 	}
 
-	return &accessor{
-		client:                client,
-		updatedResourceQuotas: updatedCache,
+	a := &accessor{
+		client:         client,
+		reader:         reader,
+		mappingCache:   mappingCache,
+		clock:          clock.RealClock{},
+		updatedLedgers: updatedCache,
 	}
+	a.SetLookupTimeout(DefaultQuotaLookupTimeout)
+	return a
+}
+
+// SetLookupTimeout sets how long GetQuotas waits for the namespace and its quotas to be observed.
+func (a *accessor) SetLookupTimeout(timeout time.Duration) {
+	a.lookupTimeout.Store(int64(timeout))
 }
 
-// UpdateQuotaStatus the newQuota coming in will be incremented from the original.  The difference between the original
-// and the new is the amount to add to the namespace total, but the total status is the used value itself
-func (a *accessor) UpdateQuotaStatus(newQuota *corev1.ResourceQuota) error {
+// UpdateQuotaStatus the newQuota coming in will be incremented from the original by the given reservations.  They are
+// recorded in the ledger of the quota in the namespace, the controller drops them once the admitted objects are
+// counted by the status of the quota.  Nothing is written once ctx is done.
+func (a *accessor) UpdateQuotaStatus(ctx context.Context, newQuota *corev1.ResourceQuota, reservations []quotav1.Reservation) error {
 	// skipping namespaced resource quota
 	if newQuota.APIVersion != quotav1.GroupVersion.String() {
 		klog.V(6).Infof("skipping namespaced resource quota %v %v", newQuota.Namespace, newQuota.Name)
 		return nil
 	}
-	ctx := context.TODO()
+	// the ledgers are read before the quota, a recalculation of the status in between counts the objects of the
+	// reservations it drops twice instead of not at all.  The ledger of the namespace is read again, its resource
+	// version fails the update on concurrent reservations, the others are checked against the look-aside cache.
+	ledgers, err := a.getLedgers(ctx, newQuota.Name)
+	if err != nil {
+		klog.Errorf("failed to fetch ledgers of resource quota: %s, %v", newQuota.Name, err)
+		return err
+	}
+	delete(ledgers, newQuota.Namespace)
+	ledger := &quotav1.SharedQuotaLedger{}
+	err = a.reader.Get(ctx, types.NamespacedName{Namespace: newQuota.Namespace, Name: newQuota.Name}, ledger)
+	switch {
+	case err == nil:
+		ledgers[newQuota.Namespace] = ledger
+	case !apierrors.IsNotFound(err):
+		klog.Errorf("failed to fetch resource quota ledger: %s/%s, %v", newQuota.Namespace, newQuota.Name, err)
+		return err
+	}
 	resourceQuota := &quotav1.SharedQuota{}
-	err := a.client.Get(ctx, types.NamespacedName{Name: newQuota.Name}, resourceQuota)
+	err = a.reader.Get(ctx, types.NamespacedName{Name: newQuota.Name}, resourceQuota)
 	if err != nil {
 		klog.Errorf("failed to fetch resource quota: %s, %v", newQuota.Name, err)
 		return err
 	}
-	resourceQuota = a.checkCache(resourceQuota)
-
-	// re-assign objectmeta
-	// make a copy
-	updatedQuota := resourceQuota.DeepCopy()
-	updatedQuota.ObjectMeta = newQuota.ObjectMeta
-	updatedQuota.Namespace = ""
-
-	// determine change in usage
-	usageDiff := Subtract(newQuota.Status.Used, updatedQuota.Status.Total.Used)
-
-	// update aggregate usage
-	updatedQuota.Status.Total.Used = newQuota.Status.Used
+	// the usage was checked against limits that changed since
+	if resourceQuota.UID != newQuota.UID || resourceQuota.Generation != newQuota.Generation {
+		return apierrors.NewConflict(quotav1.GroupVersion.WithResource("sharedquotas").GroupResource(), newQuota.Name,
+			fmt.Errorf("spec of the quota changed"))
+	}
 
-	// update per namespace totals
-	oldNamespaceTotals, _ := getResourceQuotasStatusByNamespace(updatedQuota.Status.Namespaces, newQuota.Namespace)
-	namespaceTotalCopy := oldNamespaceTotals.DeepCopy()
-	newNamespaceTotals := *namespaceTotalCopy
-	newNamespaceTotals.Used = Add(oldNamespaceTotals.Used, usageDiff)
-	insertResourceQuotasStatus(&updatedQuota.Status.Namespaces, quotav1.ResourceQuotaStatusByNamespace{
-		Namespace:           newQuota.Namespace,
-		ResourceQuotaStatus: newNamespaceTotals,
-	})
+	// the requests were checked against the usage returned by GetQuotas, a recalculation of the status or the
+	// reservations of other requests since only conflict when they raised it
+	reserved := corev1.ResourceList{}
+	for _, reservation := range reservations {
+		reserved = Add(reserved, reservation.Used)
+	}
+	checkedUsage := Subtract(newQuota.Status.Used, reserved)
+	currentUsage := Add(resourceQuota.Status.Total.Used, ReservedUsage(ledgerValues(ledgers)...))
+	hardResources := ResourceNames(resourceQuota.Spec.Quota.Hard)
+	if lessThanOrEqual, exceeded := LessThanOrEqual(Mask(currentUsage, hardResources), Mask(checkedUsage, hardResources)); !lessThanOrEqual {
+		return apierrors.NewConflict(quotav1.GroupVersion.WithResource("sharedquotas").GroupResource(), newQuota.Name,
+			fmt.Errorf("usage of the quota changed: %v", exceeded))
+	}
 
-	klog.V(6).Infof("update resource quota: %+v", updatedQuota)
-	err = a.client.Status().Update(ctx, updatedQuota)
+	// the request was abandoned while its usage was checked
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := metav1.NewTime(a.clock.Now())
+	ledger = ledgers[newQuota.Namespace]
+	if ledger == nil {
+		ledger = &quotav1.SharedQuotaLedger{ObjectMeta: metav1.ObjectMeta{
+			Name:      newQuota.Name,
+			Namespace: newQuota.Namespace,
+			Labels:    map[string]string{quotav1.SharedQuotaLabel: newQuota.Name},
+			// the ledger is garbage collected with its quota
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(resourceQuota, quotav1.GroupVersion.WithKind("SharedQuota"))},
+		}}
+		for _, reservation := range reservations {
+			reservation.Timestamp = now
+			AddReservation(ledger, reservation)
+		}
+		klog.V(6).Infof("create resource quota ledger: %+v", ledger)
+		err = a.client.Create(ctx, ledger)
+	} else {
+		ledger = ledger.DeepCopy()
+		for _, reservation := range reservations {
+			reservation.Timestamp = now
+			AddReservation(ledger, reservation)
+		}
+		// the reservations are applied whole, the resource version fails the patch on concurrent reservations
+		ledger = &quotav1.SharedQuotaLedger{
+			TypeMeta:   metav1.TypeMeta{APIVersion: quotav1.GroupVersion.String(), Kind: "SharedQuotaLedger"},
+			ObjectMeta: metav1.ObjectMeta{Name: ledger.Name, Namespace: ledger.Namespace, ResourceVersion: ledger.ResourceVersion},
+			Spec:       ledger.Spec,
+		}
+		klog.V(6).Infof("apply resource quota ledger: %+v", ledger)
+		err = a.client.Patch(ctx, ledger, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+	}
 	if err != nil {
-		klog.Errorf("failed to update resource quota: %v", err)
+		// released usage does not need to be reserved, it is freed once the controller recalculates the quota.  The
+		// ledger cannot be created in a terminating namespace, which must not block the deletion of its objects.
+		if releasedOnly(reserved) && (apierrors.IsForbidden(err) || apierrors.IsNotFound(err)) {
+			klog.V(4).Infof("skipping the reservation of released usage in resource quota ledger %s/%s: %v", newQuota.Namespace, newQuota.Name, err)
+			return nil
+		}
+		klog.Errorf("failed to update resource quota ledger: %v", err)
+		// the ledger was deleted with its quota
+		if apierrors.IsNotFound(err) {
+			a.Forget(newQuota.Name)
+		}
 		return err
 	}
 
-	a.updatedResourceQuotas.Add(resourceQuota.Name, updatedQuota)
+	a.cacheLedgers(ledger.Name, map[string]*quotav1.SharedQuotaLedger{ledger.Namespace: ledger})
 	return nil
 }
 
+// Forget drops the updated ledgers kept for the deleted quota of the given name.
+func (a *accessor) Forget(name string) {
+	a.ledgersLock.Lock()
+	defer a.ledgersLock.Unlock()
+	a.updatedLedgers.Remove(name)
+}
+
 var storageVersioner = storage.APIObjectVersioner{}
 
-// checkCache compares the passed quota against the value in the look-aside cache and returns the newer
+// LedgerQuotaIndex indexes the ledgers in the cache of the accessor by the name of their quota.
+const LedgerQuotaIndex = "ledger.quota"
+
+// IndexLedgerQuota returns the name of the quota of the ledger, for LedgerQuotaIndex.
+func IndexLedgerQuota(obj client.Object) []string {
+	if name, ok := obj.GetLabels()[quotav1.SharedQuotaLabel]; ok {
+		return []string{name}
+	}
+	return nil
+}
+
+// IndexLedgers adds LedgerQuotaIndex to the cache read by the accessor.
+func IndexLedgers(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &quotav1.SharedQuotaLedger{}, LedgerQuotaIndex, IndexLedgerQuota)
+}
+
+// getLedgers returns the ledgers of the quota by namespace.  Namespaces without reserved usage have no ledger.
+func (a *accessor) getLedgers(ctx context.Context, name string) (map[string]*quotav1.SharedQuotaLedger, error) {
+	ledgerList := &quotav1.SharedQuotaLedgerList{}
+	if err := a.client.List(ctx, ledgerList, client.MatchingFields{LedgerQuotaIndex: name}); err != nil {
+		return nil, err
+	}
+	ledgers := make(map[string]*quotav1.SharedQuotaLedger, len(ledgerList.Items))
+	for i := range ledgerList.Items {
+		ledgers[ledgerList.Items[i].Namespace] = &ledgerList.Items[i]
+	}
+	return a.checkCache(name, ledgers), nil
+}
+
+// checkCache compares the passed ledgers against the values in the look-aside cache and returns the newer
 // if the cache is out of date, it deletes the stale entry.  This only works because of etcd resourceVersions
 // being monotonically increasing integers
-func (a *accessor) checkCache(resourceQuota *quotav1.SharedQuota) *quotav1.SharedQuota {
-	uncastCachedQuota, ok := a.updatedResourceQuotas.Get(resourceQuota.Name)
+func (a *accessor) checkCache(name string, ledgers map[string]*quotav1.SharedQuotaLedger) map[string]*quotav1.SharedQuotaLedger {
+	a.ledgersLock.Lock()
+	defer a.ledgersLock.Unlock()
+	uncastCachedLedgers, ok := a.updatedLedgers.Get(name)
 	if !ok {
-		return resourceQuota
+		return ledgers
+	}
+	cachedLedgers := uncastCachedLedgers.(map[string]*quotav1.SharedQuotaLedger)
+
+	freshLedgers := make(map[string]*quotav1.SharedQuotaLedger, len(cachedLedgers))
+	for namespace, cachedLedger := range cachedLedgers {
+		ledger, found := ledgers[namespace]
+		// a ledger missing from the list was either not observed yet, or deleted with its quota
+		if !found || storageVersioner.CompareResourceVersion(ledger, cachedLedger) < 0 {
+			ledgers[namespace] = cachedLedger
+			freshLedgers[namespace] = cachedLedger
+		}
+	}
+	if len(freshLedgers) == 0 {
+		a.updatedLedgers.Remove(name)
+	} else if len(freshLedgers) < len(cachedLedgers) {
+		a.updatedLedgers.Add(name, freshLedgers)
 	}
-	cachedQuota := uncastCachedQuota.(*quotav1.SharedQuota)
+	return ledgers
+}
 
-	if storageVersioner.CompareResourceVersion(resourceQuota, cachedQuota) >= 0 {
-		a.updatedResourceQuotas.Remove(resourceQuota.Name)
-		return resourceQuota
+// cacheLedgers keeps the ledgers of the quota until they are observed.
+func (a *accessor) cacheLedgers(name string, ledgers map[string]*quotav1.SharedQuotaLedger) {
+	if len(ledgers) == 0 {
+		return
+	}
+	a.ledgersLock.Lock()
+	defer a.ledgersLock.Unlock()
+	cachedLedgers := map[string]*quotav1.SharedQuotaLedger{}
+	if uncastCachedLedgers, ok := a.updatedLedgers.Get(name); ok {
+		for namespace, cachedLedger := range uncastCachedLedgers.(map[string]*quotav1.SharedQuotaLedger) {
+			cachedLedgers[namespace] = cachedLedger
+		}
+	}
+	for namespace, ledger := range ledgers {
+		if cachedLedger, found := cachedLedgers[namespace]; !found || storageVersioner.CompareResourceVersion(ledger, cachedLedger) > 0 {
+			cachedLedgers[namespace] = ledger
+		}
+	}
+	a.updatedLedgers.Add(name, cachedLedgers)
+}
+
+// releasedOnly returns true if the usage does not increase any resource.
+func releasedOnly(usage corev1.ResourceList) bool {
+	for _, quantity := range usage {
+		if quantity.Sign() > 0 {
+			return false
+		}
 	}
-	return cachedQuota
+	return true
 }
 
-func (a *accessor) GetQuotas(namespaceName string) ([]corev1.ResourceQuota, error) {
-	resourceQuotaNames, err := a.waitForReadyResourceQuotaNames(namespaceName)
+func ledgerValues(ledgers map[string]*quotav1.SharedQuotaLedger) []*quotav1.SharedQuotaLedger {
+	values := make([]*quotav1.SharedQuotaLedger, 0, len(ledgers))
+	for _, ledger := range ledgers {
+		values = append(values, ledger)
+	}
+	return values
+}
+
+func (a *accessor) GetQuotas(ctx context.Context, namespaceName string) ([]corev1.ResourceQuota, error) {
+	resourceQuotaNames, err := a.waitForReadyResourceQuotaNames(ctx, namespaceName)
 	if err != nil {
 		klog.Errorf("failed to fetch resource quota names: %v, %v", namespaceName, err)
 		return nil, err
@@ -117,41 +326,56 @@ func (a *accessor) GetQuotas(namespaceName string) ([]corev1.ResourceQuota, erro
 	var result []corev1.ResourceQuota
 	for _, resourceQuotaName := range resourceQuotaNames {
 		resourceQuota := &quotav1.SharedQuota{}
-		err = a.client.Get(context.TODO(), types.NamespacedName{Name: resourceQuotaName}, resourceQuota)
+		err = a.client.Get(ctx, types.NamespacedName{Name: resourceQuotaName}, resourceQuota)
 		if err != nil {
 			klog.Errorf("failed to fetch resource quota %s: %v", resourceQuotaName, err)
 			return result, err
 		}
-		resourceQuota = a.checkCache(resourceQuota)
+		ledgers, err := a.getLedgers(ctx, resourceQuotaName)
+		if err != nil {
+			klog.Errorf("failed to fetch ledgers of resource quota %s: %v", resourceQuotaName, err)
+			return result, err
+		}
 
-		// now convert to a ResourceQuota
+		// now convert to a ResourceQuota, the usage includes the reservations not yet folded into the status
 		convertedQuota := corev1.ResourceQuota{}
 		convertedQuota.APIVersion = quotav1.GroupVersion.String()
-		convertedQuota.ObjectMeta = resourceQuota.ObjectMeta
+		convertedQuota.ObjectMeta = *resourceQuota.ObjectMeta.DeepCopy()
 		convertedQuota.Namespace = namespaceName
+		if condition := meta.FindStatusCondition(resourceQuota.Status.Conditions, quotav1.ConditionUsageCalculated); condition != nil && condition.Status == metav1.ConditionFalse {
+			if convertedQuota.Annotations == nil {
+				convertedQuota.Annotations = map[string]string{}
+			}
+			convertedQuota.Annotations[UsageErrorAnnotation] = condition.Message
+		}
 		convertedQuota.Spec = resourceQuota.Spec.Quota
 		convertedQuota.Status = resourceQuota.Status.Total
+		convertedQuota.Status.Used = Add(resourceQuota.Status.Total.Used, ReservedUsage(ledgerValues(ledgers)...))
 		result = append(result, convertedQuota)
 	}
 
 	// avoid conflicts with namespaced resource quota
-	namespacedResourceQuotas, err := a.waitForReadyNamespacedResourceQuotas(namespaceName)
+	namespacedResourceQuotas, err := a.waitForReadyNamespacedResourceQuotas(ctx, namespaceName)
 	if err != nil {
 		klog.Errorf("failed to fetch namespaced resource quotas: %v, %v", namespaceName, err)
 		return nil, err
 	}
 	for _, resourceQuota := range namespacedResourceQuotas {
+		// the views of the shared quotas are already evaluated as the shared quotas
+		if name, found := resourceQuota.Labels[quotav1.SharedQuotaLabel]; found && IsResourceQuotaViewOf(&resourceQuota, name) {
+			continue
+		}
 		resourceQuota.APIVersion = corev1.SchemeGroupVersion.String()
 		result = append(result, resourceQuota)
 	}
 	return result, nil
 }
 
-func (a *accessor) waitForReadyResourceQuotaNames(namespaceName string) ([]string, error) {
+func (a *accessor) waitForReadyResourceQuotaNames(ctx context.Context, namespaceName string) ([]string, error) {
 	var resourceQuotaNames []string
-	// wait for a valid mapping cache.  The overall response can be delayed for up to 10 seconds.
-	err := utilwait.PollUntilContextTimeout(context.TODO(), 100*time.Millisecond, 8*time.Second, true, func(ctx context.Context) (done bool, err error) {
-		resourceQuotaNames, err = ResourceQuotaNamesFor(ctx, a.client, namespaceName)
+	// wait for a valid mapping cache.  The overall response can be delayed up to the evaluation timeout.
+	err := utilwait.PollUntilContextTimeout(ctx, 100*time.Millisecond, time.Duration(a.lookupTimeout.Load()), true, func(ctx context.Context) (done bool, err error) {
+		resourceQuotaNames, err = a.mappingCache.ResourceQuotaNamesFor(namespaceName)
 		// if we can't find the namespace yet, just wait for the cache to update.  Requests to non-existent namespaces
 		// may hang, but those people are doing something wrong and namespace lifecycle should reject them.
 		if apierrors.IsNotFound(err) {
@@ -165,10 +389,10 @@ func (a *accessor) waitForReadyResourceQuotaNames(namespaceName string) ([]strin
 	return resourceQuotaNames, err
 }
 
-func (a *accessor) waitForReadyNamespacedResourceQuotas(namespaceName string) ([]corev1.ResourceQuota, error) {
+func (a *accessor) waitForReadyNamespacedResourceQuotas(ctx context.Context, namespaceName string) ([]corev1.ResourceQuota, error) {
 	var resourceQuotas []corev1.ResourceQuota
-	// wait for a valid mapping cache.  The overall response can be delayed for up to 10 seconds.
-	err := utilwait.PollUntilContextTimeout(context.TODO(), 100*time.Millisecond, 8*time.Second, true, func(ctx context.Context) (done bool, err error) {
+	// wait for a valid mapping cache.  The overall response can be delayed up to the evaluation timeout.
+	err := utilwait.PollUntilContextTimeout(ctx, 100*time.Millisecond, time.Duration(a.lookupTimeout.Load()), true, func(ctx context.Context) (done bool, err error) {
 		resourceQuotaList := &corev1.ResourceQuotaList{}
 		err = a.client.List(ctx, resourceQuotaList, &client.ListOptions{Namespace: namespaceName})
 		if err != nil {
@@ -0,0 +1,241 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	quotav1 "caih.com/api/v1"
+)
+
+func TestUpdateQuotaStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = quotav1.AddToScheme(scheme)
+
+	// the requests were checked against a status of 4 pods and 1 pod reserved in another namespace
+	checked := &corev1.ResourceQuota{
+		TypeMeta:   metav1.TypeMeta{APIVersion: quotav1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "namespace", UID: "uid", Generation: 1, ResourceVersion: "1"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: pods("10")},
+		Status:     corev1.ResourceQuotaStatus{Hard: pods("10"), Used: pods("5")},
+	}
+	sharedQuota := func(generation int64, used string) *quotav1.SharedQuota {
+		return &quotav1.SharedQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", UID: "uid", Generation: generation},
+			Spec:       quotav1.SharedQuotaSpec{Quota: corev1.ResourceQuotaSpec{Hard: pods("10")}},
+			Status:     quotav1.SharedQuotaStatus{Total: corev1.ResourceQuotaStatus{Hard: pods("10"), Used: pods(used)}},
+		}
+	}
+	otherLedger := func(used string) *quotav1.SharedQuotaLedger {
+		ledger := &quotav1.SharedQuotaLedger{ObjectMeta: metav1.ObjectMeta{
+			Name: "quota", Namespace: "other", Labels: map[string]string{quotav1.SharedQuotaLabel: "quota"},
+		}}
+		if used != "0" {
+			AddReservation(ledger, reservation(createdPod("other"), pods(used), ledgerNow))
+		}
+		return ledger
+	}
+
+	namespaceLedger := func(used string) *quotav1.SharedQuotaLedger {
+		ledger := otherLedger("0")
+		ledger.Namespace = "namespace"
+		ledger.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(sharedQuota(1, "0"), quotav1.GroupVersion.WithKind("SharedQuota"))}
+		AddReservation(ledger, reservation(createdPod("b"), pods(used), ledgerNow))
+		return ledger
+	}
+
+	testCases := map[string]struct {
+		objects      []client.Object
+		reservations []quotav1.Reservation
+		createErr    error
+		cacheLag     bool
+		expectedErr  func(error) bool
+		expectedUsed corev1.ResourceList
+	}{
+		"unchanged usage": {
+			objects:      []client.Object{sharedQuota(1, "4"), otherLedger("1")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			expectedUsed: pods("1"),
+		},
+		"recalculated status folding the reservations of another namespace": {
+			objects:      []client.Object{sharedQuota(1, "5"), otherLedger("0")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			expectedUsed: pods("1"),
+		},
+		"lowered usage": {
+			objects:      []client.Object{sharedQuota(1, "2"), otherLedger("1")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			expectedUsed: pods("1"),
+		},
+		"reservations of another namespace": {
+			objects:      []client.Object{sharedQuota(1, "4"), otherLedger("2")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			expectedErr:  apierrors.IsConflict,
+		},
+		"recalculated status counting more objects": {
+			objects:      []client.Object{sharedQuota(1, "5"), otherLedger("1")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			expectedErr:  apierrors.IsConflict,
+		},
+		"changed spec": {
+			objects:      []client.Object{sharedQuota(2, "4"), otherLedger("1")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			expectedErr:  apierrors.IsConflict,
+		},
+		"release in a terminating namespace": {
+			objects:      []client.Object{sharedQuota(1, "4"), otherLedger("1")},
+			reservations: []quotav1.Reservation{{Object: deletedPod("a", "uid-a", "1"), Used: pods("-1")}},
+			createErr:    apierrors.NewForbidden(quotav1.GroupVersion.WithResource("sharedquotaledgers").GroupResource(), "quota", nil),
+		},
+		"ledger of the namespace missing from the cache": {
+			objects:      []client.Object{sharedQuota(1, "3"), otherLedger("1"), namespaceLedger("1")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			cacheLag:     true,
+			expectedUsed: pods("2"),
+		},
+		"reservation in a terminating namespace": {
+			objects:      []client.Object{sharedQuota(1, "4"), otherLedger("1")},
+			reservations: []quotav1.Reservation{{Object: createdPod("a"), Used: pods("1")}},
+			createErr:    apierrors.NewForbidden(quotav1.GroupVersion.WithResource("sharedquotaledgers").GroupResource(), "quota", nil),
+			expectedErr:  apierrors.IsForbidden,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objects...).
+				WithIndex(&quotav1.SharedQuotaLedger{}, LedgerQuotaIndex, IndexLedgerQuota).WithInterceptorFuncs(interceptor.Funcs{
+				// the cache has not observed the ledger of the namespace yet
+				List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					if err := c.List(ctx, list, opts...); err != nil || !tc.cacheLag {
+						return err
+					}
+					ledgerList := list.(*quotav1.SharedQuotaLedgerList)
+					ledgerList.Items = slices.DeleteFunc(ledgerList.Items, func(ledger quotav1.SharedQuotaLedger) bool {
+						return ledger.Namespace == "namespace"
+					})
+					return nil
+				},
+				// the fake client does not apply, the applied ledger is updated on its resource version instead
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if patch != client.Apply {
+						return c.Patch(ctx, obj, patch, opts...)
+					}
+					ledger := &quotav1.SharedQuotaLedger{}
+					if err := c.Get(ctx, client.ObjectKeyFromObject(obj), ledger); err != nil {
+						return err
+					}
+					ledger.ResourceVersion = obj.GetResourceVersion()
+					ledger.Spec = obj.(*quotav1.SharedQuotaLedger).Spec
+					return c.Update(ctx, ledger)
+				},
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					if tc.createErr != nil {
+						return tc.createErr
+					}
+					return c.Create(ctx, obj, opts...)
+				},
+			}).Build()
+			a := NewQuotaAccessor(c, c, nil, DefaultQuotaCacheSize)
+			a.clock = testingclock.NewFakeClock(ledgerNow)
+
+			newQuota := checked.DeepCopy()
+			for _, reservation := range tc.reservations {
+				newQuota.Status.Used = Add(newQuota.Status.Used, reservation.Used)
+			}
+			err := a.UpdateQuotaStatus(context.Background(), newQuota, tc.reservations)
+			if tc.expectedErr != nil {
+				if err == nil || !tc.expectedErr(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ledger := &quotav1.SharedQuotaLedger{}
+			err = c.Get(context.Background(), types.NamespacedName{Namespace: "namespace", Name: "quota"}, ledger)
+			if tc.expectedUsed == nil {
+				if !apierrors.IsNotFound(err) {
+					t.Fatalf("expected no ledger, got %+v, %v", ledger, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if usage := ReservedUsage(ledger); !Equals(usage, tc.expectedUsed) {
+				t.Errorf("expected reserved usage %v, got %v", tc.expectedUsed, usage)
+			}
+			if ledger.Labels[quotav1.SharedQuotaLabel] != "quota" || !metav1.IsControlledBy(ledger, sharedQuota(1, "0")) {
+				t.Errorf("expected the ledger to be labeled and controlled by the quota, got %+v", ledger.ObjectMeta)
+			}
+			if ledgers, _ := a.getLedgers(context.Background(), "quota"); ledgers["namespace"] == nil || ledgers["other"] == nil {
+				t.Errorf("expected the ledgers of both namespaces, got %v", ledgers)
+			}
+		})
+	}
+}
+
+func TestIsResourceQuotaViewOf(t *testing.T) {
+	sharedQuota := &quotav1.SharedQuota{ObjectMeta: metav1.ObjectMeta{Name: "quota", UID: "uid"}}
+	controllerRef := *metav1.NewControllerRef(sharedQuota, quotav1.GroupVersion.WithKind("SharedQuota"))
+	otherRef := *metav1.NewControllerRef(&quotav1.SharedQuota{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other"}},
+		quotav1.GroupVersion.WithKind("SharedQuota"))
+	ownerRef := controllerRef
+	ownerRef.Controller = nil
+
+	testCases := map[string]struct {
+		name     string
+		owners   []metav1.OwnerReference
+		expected bool
+	}{
+		"view":                         {name: ResourceQuotaViewPrefix + "quota", owners: []metav1.OwnerReference{controllerRef}, expected: true},
+		"not named after the quota":    {name: "compute", owners: []metav1.OwnerReference{controllerRef}},
+		"not controlled":               {name: ResourceQuotaViewPrefix + "quota"},
+		"owned but not controlled":     {name: ResourceQuotaViewPrefix + "quota", owners: []metav1.OwnerReference{ownerRef}},
+		"controlled by another quota":  {name: ResourceQuotaViewPrefix + "quota", owners: []metav1.OwnerReference{otherRef}},
+		"controlled by another object": {name: ResourceQuotaViewPrefix + "quota", owners: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: "quota", Controller: controllerRef.Controller}}},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			resourceQuota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{
+				Name:            testCase.name,
+				Namespace:       "namespace",
+				Labels:          map[string]string{quotav1.SharedQuotaLabel: "quota"},
+				OwnerReferences: testCase.owners,
+			}}
+			if actual := IsResourceQuotaViewOf(resourceQuota, "quota"); actual != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package accounting maintains the usage of shared quotas incrementally from informer events, so that the
+// controller does not list every object of every matched namespace on each reconcile.
+package accounting
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"caih.com/pkg/quota"
+)
+
+// Engine maintains the usage of quotas per namespace.  The objects of tracked resources are fed by informer event
+// handlers, together with their usage as measured by their evaluator.  The usage of a quota in a namespace is
+// computed once from the tracked objects and then updated with the delta of every event.  Resources that are not
+// tracked, or whose informer has not synced yet, are measured by their evaluator's UsageStats.
+type Engine struct {
+	registry quota.Registry
+
+	lock sync.Mutex
+	// tracked holds the informer registration of every tracked resource
+	tracked map[schema.GroupResource]toolscache.ResourceEventHandlerRegistration
+	// objects holds the tracked objects by resource, namespace and name
+	objects map[schema.GroupResource]map[string]map[string]*trackedObject
+	// quotas holds the usage of tracked resources of every quota that was asked for
+	quotas map[string]*quotaUsage
+}
+
+type trackedObject struct {
+	groupResource schema.GroupResource
+	object        runtime.Object
+	usage         corev1.ResourceList
+}
+
+// quotaUsage is the usage of tracked resources of a quota, by namespace.
+type quotaUsage struct {
+	spec       corev1.ResourceQuotaSpec
+	namespaces map[string]corev1.ResourceList
+}
+
+// NewEngine returns an engine measuring usage with the evaluators of the registry.
+func NewEngine(registry quota.Registry) *Engine {
+	return &Engine{
+		registry: registry,
+		tracked:  map[schema.GroupResource]toolscache.ResourceEventHandlerRegistration{},
+		objects:  map[schema.GroupResource]map[string]map[string]*trackedObject{},
+		quotas:   map[string]*quotaUsage{},
+	}
+}
+
+// Track feeds the objects of the informer to the engine.  The informer must hold objects of the given resource.
+func (e *Engine) Track(groupResource schema.GroupResource, informer toolscache.SharedInformer) error {
+	if e.registry.Get(groupResource) == nil {
+		return nil
+	}
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			e.update(groupResource, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			e.update(groupResource, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			e.delete(groupResource, obj)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.tracked[groupResource] = registration
+	return nil
+}
+
+// Usage returns the usage of the quota in the namespace.
+func (e *Engine) Usage(name string, spec corev1.ResourceQuotaSpec, namespace string) (corev1.ResourceList, error) {
+	hardResources := quota.ResourceNames(spec.Hard)
+	matchedResources := e.matchedResources(hardResources)
+
+	e.lock.Lock()
+	synced := e.synced()
+	tracked := make(map[schema.GroupResource]bool, len(e.tracked))
+	for groupResource := range e.tracked {
+		tracked[groupResource] = true
+	}
+	e.lock.Unlock()
+
+	var errs []error
+	newUsage := corev1.ResourceList{}
+	for _, evaluator := range e.registry.List() {
+		// only trigger the evaluator if it matches a resource in the quota, otherwise, skip calculating anything
+		intersection := evaluator.MatchingResources(matchedResources)
+		if len(intersection) == 0 {
+			continue
+		}
+		if synced && tracked[evaluator.GroupResource()] {
+			// default each tracked resource to zero, as UsageStats does
+			for _, resourceName := range intersection {
+				newUsage = quota.Add(newUsage, corev1.ResourceList{resourceName: resource.Quantity{Format: resource.DecimalSI}})
+			}
+			continue
+		}
+		stats, err := evaluator.UsageStats(quota.UsageStatsOptions{Namespace: namespace, Scopes: spec.Scopes, Resources: intersection, ScopeSelector: spec.ScopeSelector})
+		if err != nil {
+			errs = append(errs, err)
+			// exclude resources which encountered calculation errors
+			matchedResources = quota.Difference(matchedResources, intersection)
+			continue
+		}
+		newUsage = quota.Add(newUsage, stats.Used)
+	}
+
+	if synced {
+		e.lock.Lock()
+		trackedUsage, err := e.trackedUsage(name, spec, namespace)
+		e.lock.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		newUsage = quota.Add(newUsage, trackedUsage)
+	}
+
+	// mask the observed usage to only the set of resources tracked by this quota
+	return quota.Mask(newUsage, matchedResources), utilerrors.NewAggregate(errs)
+}
+
+// Correct compares the usage of the quota in the namespace with a full recalculation.  It returns true if they
+// differ, in which case the usage of the namespace is measured again from the tracked objects.
+func (e *Engine) Correct(name string, spec corev1.ResourceQuotaSpec, namespace string, recalculated corev1.ResourceList) (bool, error) {
+	usage, err := e.Usage(name, spec, namespace)
+	if err != nil {
+		return false, err
+	}
+	if quota.Equals(usage, recalculated) {
+		return false, nil
+	}
+	klog.V(2).Infof("usage of quota %s in namespace %s drifted, tracked: %v, recalculated: %v", name, namespace, usage, recalculated)
+	usageDriftTotal.WithLabelValues(name).Inc()
+
+	// usage that depends on time, such as terminating pods past their grace period, changes without events.  The
+	// objects are measured without the lock, those replaced since were measured by their event.
+	e.lock.Lock()
+	measured := map[*trackedObject]corev1.ResourceList{}
+	for _, namespaces := range e.objects {
+		for _, object := range namespaces[namespace] {
+			measured[object] = nil
+		}
+	}
+	e.lock.Unlock()
+	for object := range measured {
+		measured[object] = e.objectUsage(object.groupResource, object.object)
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, namespaces := range e.objects {
+		for _, object := range namespaces[namespace] {
+			if usage, found := measured[object]; found {
+				object.usage = usage
+			}
+		}
+	}
+	for _, usage := range e.quotas {
+		delete(usage.namespaces, namespace)
+	}
+	return true, nil
+}
+
+// Forget drops the usage of the quota in the given namespaces, or all of its usage if no namespace is given.
+func (e *Engine) Forget(name string, namespaces ...string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	usage, found := e.quotas[name]
+	if !found {
+		return
+	}
+	if len(namespaces) == 0 {
+		delete(e.quotas, name)
+		return
+	}
+	for _, namespace := range namespaces {
+		delete(usage.namespaces, namespace)
+	}
+}
+
+// Observed returns the object of the resource observed in the namespace, nil if there is none.  known is false if
+// the resource is not tracked or its informer has not synced, the usage of its objects is not measured from what
+// the engine observed then.
+func (e *Engine) Observed(groupResource schema.GroupResource, namespace, name string) (object metav1.Object, known bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, tracked := e.tracked[groupResource]; !tracked || !e.synced() {
+		return nil, false
+	}
+	trackedObject, found := e.objects[groupResource][namespace][name]
+	if !found {
+		return nil, true
+	}
+	object, err := meta.Accessor(trackedObject.object)
+	if err != nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// matchedResources returns the resources of the quota that an evaluator can measure.
+func (e *Engine) matchedResources(hardResources []corev1.ResourceName) []corev1.ResourceName {
+	potentialResources := []corev1.ResourceName{}
+	for _, evaluator := range e.registry.List() {
+		potentialResources = append(potentialResources, evaluator.MatchingResources(hardResources)...)
+	}
+	// NOTE: the intersection just removes duplicates since the evaluator match intersects with hard
+	return quota.Intersection(hardResources, potentialResources)
+}
+
+// synced returns true once the informers of all tracked resources have synced.  Until then, the usage of every
+// resource is measured by UsageStats.  Must be called with the lock held.
+func (e *Engine) synced() bool {
+	for _, registration := range e.tracked {
+		if !registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// trackedUsage returns the usage of tracked resources of the quota in the namespace, computing it from the
+// tracked objects if needed.  Must be called with the lock held.
+func (e *Engine) trackedUsage(name string, spec corev1.ResourceQuotaSpec, namespace string) (corev1.ResourceList, error) {
+	usage, found := e.quotas[name]
+	if !found || !equality.Semantic.DeepEqual(usage.spec, spec) {
+		usage = &quotaUsage{spec: *spec.DeepCopy(), namespaces: map[string]corev1.ResourceList{}}
+		e.quotas[name] = usage
+	}
+	if used, found := usage.namespaces[namespace]; found {
+		return used, nil
+	}
+
+	var errs []error
+	used := corev1.ResourceList{}
+	for _, namespaces := range e.objects {
+		for _, object := range namespaces[namespace] {
+			contribution, err := e.contribution(usage.spec, object)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			used = quota.Add(used, contribution)
+		}
+	}
+	if len(errs) > 0 {
+		// measure again on the next call
+		return used, utilerrors.NewAggregate(errs)
+	}
+	usage.namespaces[namespace] = used
+	return used, nil
+}
+
+// contribution returns the part of the object's usage charged to a quota with the given spec.
+func (e *Engine) contribution(spec corev1.ResourceQuotaSpec, object *trackedObject) (corev1.ResourceList, error) {
+	if object == nil || object.usage == nil {
+		return nil, nil
+	}
+	evaluator := e.registry.Get(object.groupResource)
+	if evaluator == nil {
+		return nil, nil
+	}
+	resourceQuota := &corev1.ResourceQuota{Spec: spec, Status: corev1.ResourceQuotaStatus{Hard: spec.Hard}}
+	match, err := evaluator.Matches(resourceQuota, object.object)
+	if err != nil || !match {
+		return nil, err
+	}
+	return quota.Mask(object.usage, evaluator.MatchingResources(quota.ResourceNames(spec.Hard))), nil
+}
+
+func (e *Engine) update(groupResource schema.GroupResource, obj interface{}) {
+	object, ok := obj.(runtime.Object)
+	if !ok {
+		return
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return
+	}
+	// the events of an informer are handled in order, the object is measured without the lock
+	newObject := &trackedObject{groupResource: groupResource, object: object, usage: e.objectUsage(groupResource, object)}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	oldObject := e.objects[groupResource][accessor.GetNamespace()][accessor.GetName()]
+	if e.objects[groupResource] == nil {
+		e.objects[groupResource] = map[string]map[string]*trackedObject{}
+	}
+	if e.objects[groupResource][accessor.GetNamespace()] == nil {
+		e.objects[groupResource][accessor.GetNamespace()] = map[string]*trackedObject{}
+	}
+	e.objects[groupResource][accessor.GetNamespace()][accessor.GetName()] = newObject
+	e.applyDelta(groupResource, accessor.GetNamespace(), oldObject, newObject)
+}
+
+func (e *Engine) delete(groupResource schema.GroupResource, obj interface{}) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	namespaces := e.objects[groupResource]
+	oldObject, found := namespaces[accessor.GetNamespace()][accessor.GetName()]
+	if !found {
+		return
+	}
+	delete(namespaces[accessor.GetNamespace()], accessor.GetName())
+	if len(namespaces[accessor.GetNamespace()]) == 0 {
+		delete(namespaces, accessor.GetNamespace())
+	}
+	e.applyDelta(groupResource, accessor.GetNamespace(), oldObject, nil)
+}
+
+// applyDelta updates the usage of every quota measured in the namespace.  Must be called with the lock held.
+func (e *Engine) applyDelta(groupResource schema.GroupResource, namespace string, oldObject, newObject *trackedObject) {
+	if !e.synced() {
+		// the usage is measured from the objects once the informers synced
+		return
+	}
+	for _, usage := range e.quotas {
+		used, found := usage.namespaces[namespace]
+		if !found {
+			continue
+		}
+		oldContribution, oldErr := e.contribution(usage.spec, oldObject)
+		newContribution, newErr := e.contribution(usage.spec, newObject)
+		if oldErr != nil || newErr != nil {
+			// measure again on the next call
+			delete(usage.namespaces, namespace)
+			continue
+		}
+		usage.namespaces[namespace] = quota.Add(quota.Subtract(used, oldContribution), newContribution)
+	}
+}
+
+// objectUsage returns the usage of the object, nil if it cannot be measured.
+func (e *Engine) objectUsage(groupResource schema.GroupResource, object runtime.Object) corev1.ResourceList {
+	evaluator := e.registry.Get(groupResource)
+	if evaluator == nil {
+		return nil
+	}
+	usage, err := evaluator.Usage(object)
+	if err != nil {
+		klog.Errorf("failed to measure usage of %T: %v", object, err)
+		return nil
+	}
+	return usage
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/clock"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+	"caih.com/pkg/quota/generic"
+)
+
+// syncedRegistration is the registration of an informer that has synced.
+type syncedRegistration struct{}
+
+func (syncedRegistration) HasSynced() bool {
+	return true
+}
+
+func newPod(namespace, name, cpu string, phase corev1.PodPhase, priorityClassName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			PriorityClassName: priorityClassName,
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+// TestIncrementalUsage checks that the usage maintained from the deltas of the events matches a full recalculation
+// after every event.
+func TestIncrementalUsage(t *testing.T) {
+	hard := corev1.ResourceList{
+		corev1.ResourcePods:        resource.MustParse("100"),
+		corev1.ResourceRequestsCPU: resource.MustParse("100"),
+	}
+	specs := map[string]corev1.ResourceQuotaSpec{
+		"all": {Hard: hard},
+		"best-effort": {
+			Hard:   corev1.ResourceList{corev1.ResourcePods: resource.MustParse("100")},
+			Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+		},
+		"high-priority": {
+			Hard: hard,
+			ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{{
+				ScopeName: corev1.ResourceQuotaScopePriorityClass,
+				Operator:  corev1.ScopeSelectorOpIn,
+				Values:    []string{"high"},
+			}}},
+		},
+	}
+	namespaces := []string{"a", "b"}
+
+	bestEffort := newPod("a", "batch", "1", corev1.PodRunning, "")
+	bestEffort.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+	steps := []struct {
+		name      string
+		operation string
+		pod       *corev1.Pod
+	}{
+		{"create a pod", "create", newPod("a", "web", "1", corev1.PodRunning, "")},
+		{"create a high priority pod", "create", newPod("a", "db", "2", corev1.PodRunning, "high")},
+		{"create a pod in another namespace", "create", newPod("b", "web", "500m", corev1.PodPending, "high")},
+		{"create a best effort pod", "create", bestEffort},
+		{"raise the requests of a pod", "update", newPod("a", "web", "3", corev1.PodRunning, "")},
+		{"change the priority class of a pod", "update", newPod("a", "web", "3", corev1.PodRunning, "high")},
+		{"a pod succeeds", "update", newPod("a", "db", "2", corev1.PodSucceeded, "high")},
+		{"delete a succeeded pod", "delete", newPod("a", "db", "2", corev1.PodSucceeded, "high")},
+		{"delete a pending pod", "delete", newPod("b", "web", "500m", corev1.PodPending, "high")},
+	}
+
+	ctx := context.Background()
+	c := clientfake.NewClientBuilder().Build()
+	registry := generic.NewRegistry([]quota.Evaluator{core.NewPodEvaluator(c, clock.RealClock{})})
+	engine := NewEngine(registry)
+	podResource := corev1.SchemeGroupVersion.WithResource("pods").GroupResource()
+	engine.tracked[podResource] = syncedRegistration{}
+
+	check := func(step string) {
+		for name, spec := range specs {
+			for _, namespace := range namespaces {
+				recalculated, err := quota.CalculateUsage(namespace, spec.Scopes, spec.Hard, registry, spec.ScopeSelector)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", step, err)
+				}
+				usage, err := engine.Usage(name, spec, namespace)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", step, err)
+				}
+				if !quota.Equals(usage, recalculated) {
+					t.Errorf("%s: quota %s in namespace %s: expected usage %v, got %v", step, name, namespace, recalculated, usage)
+				}
+			}
+		}
+	}
+	// measure the usage of every namespace once, it is only updated by deltas from then on
+	check("initial")
+	for _, step := range steps {
+		var err error
+		switch step.operation {
+		case "create":
+			err = c.Create(ctx, step.pod.DeepCopy())
+			engine.update(podResource, step.pod)
+		case "update":
+			// the status of pods is a subresource
+			if err = c.Update(ctx, step.pod.DeepCopy()); err == nil {
+				err = c.Status().Update(ctx, step.pod.DeepCopy())
+			}
+			engine.update(podResource, step.pod)
+		case "delete":
+			err = c.Delete(ctx, step.pod.DeepCopy())
+			engine.delete(podResource, step.pod)
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		check(step.name)
+	}
+
+	if len(engine.quotas["all"].namespaces) != len(namespaces) {
+		t.Fatalf("expected the usage of every namespace to be maintained, got %v", engine.quotas["all"].namespaces)
+	}
+	engine.Forget("all", "b")
+	if _, found := engine.quotas["all"].namespaces["b"]; found {
+		t.Errorf("expected the usage of the forgotten namespace to be dropped")
+	}
+	if _, found := engine.quotas["all"].namespaces["a"]; !found {
+		t.Errorf("expected the usage of the other namespaces to be kept")
+	}
+	engine.Forget("all")
+	if _, found := engine.quotas["all"]; found {
+		t.Errorf("expected the usage of the forgotten quota to be dropped")
+	}
+}
+
+func TestObserved(t *testing.T) {
+	podResource := corev1.SchemeGroupVersion.WithResource("pods").GroupResource()
+	engine := NewEngine(generic.NewRegistry([]quota.Evaluator{core.NewPodEvaluator(nil, clock.RealClock{})}))
+	pod := newPod("namespace", "web", "1", corev1.PodRunning, "")
+	pod.UID = "uid"
+
+	if _, known := engine.Observed(podResource, "namespace", "web"); known {
+		t.Errorf("expected the objects of a resource that is not tracked to be unknown")
+	}
+	engine.tracked[podResource] = syncedRegistration{}
+	engine.update(podResource, pod)
+	for _, name := range []string{"web", "db"} {
+		t.Run(fmt.Sprintf("pod %s", name), func(t *testing.T) {
+			observed, known := engine.Observed(podResource, "namespace", name)
+			if !known {
+				t.Fatalf("expected the objects of a tracked resource to be known")
+			}
+			if name == "web" && (observed == nil || observed.GetUID() != "uid") {
+				t.Errorf("expected the observed pod, got %v", observed)
+			}
+			if name == "db" && observed != nil {
+				t.Errorf("expected no pod, got %v", observed)
+			}
+		})
+	}
+	engine.delete(podResource, pod)
+	if observed, _ := engine.Observed(podResource, "namespace", "web"); observed != nil {
+		t.Errorf("expected the deleted pod to be gone, got %v", observed)
+	}
+}
+
+// unlockedEvaluator fails the test if objects are measured with the lock of the engine held.
+type unlockedEvaluator struct {
+	quota.Evaluator
+	t      *testing.T
+	engine *Engine
+}
+
+func (e *unlockedEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	if !e.engine.lock.TryLock() {
+		e.t.Errorf("expected the object to be measured without the lock")
+	} else {
+		e.engine.lock.Unlock()
+	}
+	return e.Evaluator.Usage(item)
+}
+
+func TestUsageMeasuredWithoutLock(t *testing.T) {
+	podResource := corev1.SchemeGroupVersion.WithResource("pods").GroupResource()
+	spec := corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}}
+	evaluator := &unlockedEvaluator{Evaluator: core.NewPodEvaluator(nil, clock.RealClock{}), t: t}
+	engine := NewEngine(generic.NewRegistry([]quota.Evaluator{evaluator}))
+	evaluator.engine = engine
+	engine.tracked[podResource] = syncedRegistration{}
+
+	engine.update(podResource, newPod("namespace", "web", "1", corev1.PodRunning, ""))
+	if _, err := engine.Usage("quota", spec, "namespace"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	corrected, err := engine.Correct("quota", spec, "namespace", corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")})
+	if err != nil || !corrected {
+		t.Fatalf("expected the usage to be corrected, got %v, %v", corrected, err)
+	}
+	if usage, err := engine.Usage("quota", spec, "namespace"); err != nil || !quota.Equals(usage, corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}) {
+		t.Errorf("expected the usage measured again from the tracked objects, got %v, %v", usage, err)
+	}
+}
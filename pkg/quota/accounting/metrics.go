@@ -0,0 +1,32 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounting
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// usageDriftTotal counts the full recalculations that found a usage different from the tracked one.
+var usageDriftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "sharedquota_usage_drift_total",
+	Help: "Number of namespaces whose incrementally tracked usage differed from a full recalculation, by shared quota.",
+}, []string{"sharedquota"})
+
+func init() {
+	metrics.Registry.MustRegister(usageDriftTotal)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/strings/slices"
+
+	"caih.com/pkg/quota/generic"
+)
+
+// Scopes that restrict a quota to the objects implemented by a given class, e.g.
+//
+//	scopeSelector:
+//	  matchExpressions:
+//	  - scopeName: LoadBalancerClass
+//	    operator: In
+//	    values: ["service.k8s.aws/nlb"]
+const (
+	// ResourceQuotaScopeLoadBalancerClass matches services by spec.loadBalancerClass
+	ResourceQuotaScopeLoadBalancerClass corev1.ResourceQuotaScope = "LoadBalancerClass"
+	// ResourceQuotaScopeIngressClass matches ingresses by spec.ingressClassName
+	ResourceQuotaScopeIngressClass corev1.ResourceQuotaScope = "IngressClass"
+	// ResourceQuotaScopeGatewayClass matches gateways by spec.gatewayClassName
+	ResourceQuotaScopeGatewayClass corev1.ResourceQuotaScope = "GatewayClass"
+)
+
+// classMatchesScope evaluates a scope selector against the class of an object, an empty class meaning none is set.
+// Class names are often domain-prefixed (service.k8s.aws/nlb), which is not a valid label value, so the selector is
+// evaluated directly instead of being converted to a label selector.
+func classMatchesScope(selector corev1.ScopedResourceSelectorRequirement, class string) (bool, error) {
+	switch selector.Operator {
+	case corev1.ScopeSelectorOpIn:
+		return len(class) > 0 && slices.Contains(selector.Values, class), nil
+	case corev1.ScopeSelectorOpNotIn:
+		return len(class) == 0 || !slices.Contains(selector.Values, class), nil
+	// scopes without operator come from quota.Spec.Scopes and behave like Exists
+	case corev1.ScopeSelectorOpExists, "":
+		return len(class) > 0, nil
+	case corev1.ScopeSelectorOpDoesNotExist:
+		return len(class) == 0, nil
+	}
+	return false, fmt.Errorf("%q is not a valid scope selector operator", selector.Operator)
+}
+
+// matchingScopes returns the scope selectors the item matches.
+func matchingScopes(item runtime.Object, scopeSelectors []corev1.ScopedResourceSelectorRequirement, scopeFunc generic.MatchesScopeFunc) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	matchedScopes := []corev1.ScopedResourceSelectorRequirement{}
+	for _, selector := range scopeSelectors {
+		match, err := scopeFunc(selector, item)
+		if err != nil {
+			return []corev1.ScopedResourceSelectorRequirement{}, fmt.Errorf("error on matching scope %v: %v", selector, err)
+		}
+		if match {
+			matchedScopes = append(matchedScopes, selector)
+		}
+	}
+	return matchedScopes, nil
+}
+
+// uncoveredQuotaScopes returns the limited scopes that have no matched quota scope of the same name.
+func uncoveredQuotaScopes(limitedScopes []corev1.ScopedResourceSelectorRequirement, matchedQuotaScopes []corev1.ScopedResourceSelectorRequirement) []corev1.ScopedResourceSelectorRequirement {
+	uncoveredScopes := []corev1.ScopedResourceSelectorRequirement{}
+	for _, selector := range limitedScopes {
+		isCovered := false
+		for _, matchedScopeSelector := range matchedQuotaScopes {
+			if matchedScopeSelector.ScopeName == selector.ScopeName {
+				isCovered = true
+				break
+			}
+		}
+
+		if !isCovered {
+			uncoveredScopes = append(uncoveredScopes, selector)
+		}
+	}
+	return uncoveredScopes
+}
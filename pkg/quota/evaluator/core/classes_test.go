@@ -0,0 +1,232 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+
+	"caih.com/pkg/quota"
+)
+
+func TestClassMatchesScope(t *testing.T) {
+	testCases := map[string]struct {
+		operator corev1.ScopeSelectorOperator
+		values   []string
+		class    string
+		expected bool
+		err      bool
+	}{
+		"in":                     {operator: corev1.ScopeSelectorOpIn, values: []string{"service.k8s.aws/nlb"}, class: "service.k8s.aws/nlb", expected: true},
+		"in another class":       {operator: corev1.ScopeSelectorOpIn, values: []string{"service.k8s.aws/nlb"}, class: "metallb", expected: false},
+		"in without class":       {operator: corev1.ScopeSelectorOpIn, values: []string{"service.k8s.aws/nlb"}, expected: false},
+		"not in":                 {operator: corev1.ScopeSelectorOpNotIn, values: []string{"service.k8s.aws/nlb"}, class: "metallb", expected: true},
+		"not in the class":       {operator: corev1.ScopeSelectorOpNotIn, values: []string{"service.k8s.aws/nlb"}, class: "service.k8s.aws/nlb", expected: false},
+		"not in without class":   {operator: corev1.ScopeSelectorOpNotIn, values: []string{"service.k8s.aws/nlb"}, expected: true},
+		"exists":                 {operator: corev1.ScopeSelectorOpExists, class: "metallb", expected: true},
+		"exists without class":   {operator: corev1.ScopeSelectorOpExists, expected: false},
+		"spec scope":             {class: "metallb", expected: true},
+		"does not exist":         {operator: corev1.ScopeSelectorOpDoesNotExist, expected: true},
+		"does not exist a class": {operator: corev1.ScopeSelectorOpDoesNotExist, class: "metallb", expected: false},
+		"invalid operator":       {operator: "Equals", class: "metallb", err: true},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			selector := corev1.ScopedResourceSelectorRequirement{
+				ScopeName: ResourceQuotaScopeLoadBalancerClass,
+				Operator:  testCase.operator,
+				Values:    testCase.values,
+			}
+			actual, err := classMatchesScope(selector, testCase.class)
+			if (err != nil) != testCase.err {
+				t.Fatalf("expected error %v, got %v", testCase.err, err)
+			}
+			if actual != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func newGateway(className string) *unstructured.Unstructured {
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	gateway.SetGroupVersionKind(GatewayGroupVersionKind)
+	gateway.SetNamespace("namespace")
+	gateway.SetName("gateway")
+	if len(className) > 0 {
+		_ = unstructured.SetNestedField(gateway.Object, className, "spec", "gatewayClassName")
+	}
+	return gateway
+}
+
+func TestClassScopes(t *testing.T) {
+	quotaFor := func(resourceName corev1.ResourceName, scope corev1.ResourceQuotaScope, values ...string) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			Spec: corev1.ResourceQuotaSpec{
+				ScopeSelector: &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{{
+					ScopeName: scope, Operator: corev1.ScopeSelectorOpIn, Values: values,
+				}}},
+			},
+			Status: corev1.ResourceQuotaStatus{Hard: corev1.ResourceList{resourceName: resource.MustParse("10")}},
+		}
+	}
+	loadBalancer := func(class *string) *corev1.Service {
+		return &corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerClass: class}}
+	}
+	ingress := func(class *string, annotation string) *networkingv1.Ingress {
+		ingress := &networkingv1.Ingress{Spec: networkingv1.IngressSpec{IngressClassName: class}}
+		if len(annotation) > 0 {
+			ingress.Annotations = map[string]string{ingressClassAnnotation: annotation}
+		}
+		return ingress
+	}
+
+	testCases := map[string]struct {
+		evaluator quota.Evaluator
+		quota     *corev1.ResourceQuota
+		item      runtime.Object
+		expected  bool
+	}{
+		"load balancer of the class": {
+			evaluator: NewServiceEvaluator(nil),
+			quota:     quotaFor(corev1.ResourceServicesLoadBalancers, ResourceQuotaScopeLoadBalancerClass, "service.k8s.aws/nlb"),
+			item:      loadBalancer(ptr.To("service.k8s.aws/nlb")),
+			expected:  true,
+		},
+		"load balancer of another class": {
+			evaluator: NewServiceEvaluator(nil),
+			quota:     quotaFor(corev1.ResourceServicesLoadBalancers, ResourceQuotaScopeLoadBalancerClass, "service.k8s.aws/nlb"),
+			item:      loadBalancer(nil),
+			expected:  false,
+		},
+		"ingress of the class": {
+			evaluator: NewIngressEvaluator(nil),
+			quota:     quotaFor(ResourceIngressesHostnames, ResourceQuotaScopeIngressClass, "nginx"),
+			item:      ingress(ptr.To("nginx"), ""),
+			expected:  true,
+		},
+		"ingress of the class by annotation": {
+			evaluator: NewIngressEvaluator(nil),
+			quota:     quotaFor(ResourceIngressesHostnames, ResourceQuotaScopeIngressClass, "nginx"),
+			item:      ingress(nil, "nginx"),
+			expected:  true,
+		},
+		"ingress class takes precedence over the annotation": {
+			evaluator: NewIngressEvaluator(nil),
+			quota:     quotaFor(ResourceIngressesHostnames, ResourceQuotaScopeIngressClass, "nginx"),
+			item:      ingress(ptr.To("traefik"), "nginx"),
+			expected:  false,
+		},
+		"ingress quota scoped by another kind of class": {
+			evaluator: NewIngressEvaluator(nil),
+			quota:     quotaFor(ResourceIngressesHostnames, ResourceQuotaScopeLoadBalancerClass, "nginx"),
+			item:      ingress(ptr.To("nginx"), ""),
+			expected:  false,
+		},
+		"gateway of the class": {
+			evaluator: NewGatewayEvaluator(nil),
+			quota:     quotaFor(gatewayObjectCountName, ResourceQuotaScopeGatewayClass, "istio"),
+			item:      newGateway("istio"),
+			expected:  true,
+		},
+		"gateway of another class": {
+			evaluator: NewGatewayEvaluator(nil),
+			quota:     quotaFor(gatewayObjectCountName, ResourceQuotaScopeGatewayClass, "istio"),
+			item:      newGateway("cilium"),
+			expected:  false,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := testCase.evaluator.Matches(testCase.quota, testCase.item)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIngressUsage(t *testing.T) {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "ingress"},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "a.example.com"}, {Host: "b.example.com"}, {}},
+			TLS:   []networkingv1.IngressTLS{{Hosts: []string{"a.example.com", "c.example.com"}}},
+		},
+	}
+	usage, err := NewIngressEvaluator(nil).Usage(ingress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := corev1.ResourceList{
+		ingressObjectCountName:     resource.MustParse("1"),
+		ResourceIngressesHostnames: resource.MustParse("3"),
+	}
+	if !quota.Equals(usage, expected) {
+		t.Errorf("expected %v, got %v", expected, usage)
+	}
+}
+
+func TestGatewayUsage(t *testing.T) {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	route.SetGroupVersionKind(HTTPRouteGroupVersionKind)
+	_ = unstructured.SetNestedStringSlice(route.Object, []string{"a.example.com", "b.example.com", "a.example.com"}, "spec", "hostnames")
+
+	testCases := map[string]struct {
+		evaluator quota.Evaluator
+		item      runtime.Object
+		expected  corev1.ResourceList
+	}{
+		"gateway": {
+			evaluator: NewGatewayEvaluator(nil),
+			item:      newGateway("istio"),
+			expected:  corev1.ResourceList{gatewayObjectCountName: resource.MustParse("1")},
+		},
+		"http route": {
+			evaluator: NewHTTPRouteEvaluator(nil),
+			item:      route,
+			expected: corev1.ResourceList{
+				httpRouteObjectCountName:    resource.MustParse("1"),
+				ResourceHTTPRoutesHostnames: resource.MustParse("2"),
+			},
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			usage, err := testCase.evaluator.Usage(testCase.item)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !quota.Equals(usage, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, usage)
+			}
+		})
+	}
+	if _, err := NewGatewayEvaluator(nil).Usage(route); err == nil {
+		t.Errorf("expected an error measuring an http route as a gateway")
+	}
+}
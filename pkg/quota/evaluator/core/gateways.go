@@ -0,0 +1,245 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/generic"
+)
+
+// The Gateway API is a set of CRDs, so gateways and routes are handled as unstructured objects.
+var (
+	// GatewayGroupVersionKind is the kind of the Gateway API Gateway
+	GatewayGroupVersionKind = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+	// HTTPRouteGroupVersionKind is the kind of the Gateway API HTTPRoute
+	HTTPRouteGroupVersionKind = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+)
+
+// the names used for object count quota
+var (
+	gatewayObjectCountName = generic.ObjectCountQuotaResourceNameFor(
+		GatewayGroupVersionKind.GroupVersion().WithResource("gateways").GroupResource())
+	httpRouteObjectCountName = generic.ObjectCountQuotaResourceNameFor(
+		HTTPRouteGroupVersionKind.GroupVersion().WithResource("httproutes").GroupResource())
+)
+
+// ResourceHTTPRoutesHostnames is the number of distinct hostnames served by http routes
+const ResourceHTTPRoutesHostnames corev1.ResourceName = "httproutes.hostnames"
+
+// gatewayResources are the set of resources managed by quota associated with gateways.
+var gatewayResources = []corev1.ResourceName{
+	gatewayObjectCountName,
+}
+
+// httpRouteResources are the set of resources managed by quota associated with http routes.
+var httpRouteResources = []corev1.ResourceName{
+	httpRouteObjectCountName,
+	ResourceHTTPRoutesHostnames,
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways;httproutes,verbs=get;list;watch
+
+// NewGatewayEvaluator returns an evaluator that can evaluate gateways.
+func NewGatewayEvaluator(cache client.Reader) quota.Evaluator {
+	return &gatewayEvaluator{cache: cache}
+}
+
+// gatewayEvaluator knows how to measure usage for gateways.
+type gatewayEvaluator struct {
+	// knows how to list items by namespace
+	cache client.Reader
+}
+
+// Constraints verifies that all required resources are present on the item
+func (g *gatewayEvaluator) Constraints(required []corev1.ResourceName, item runtime.Object) error {
+	// this is a no-op for gateways
+	return nil
+}
+
+// GroupResource that this evaluator tracks
+func (g *gatewayEvaluator) GroupResource() schema.GroupResource {
+	return GatewayGroupVersionKind.GroupVersion().WithResource("gateways").GroupResource()
+}
+
+// Handles returns true of the evaluator should handle the specified operation.
+func (g *gatewayEvaluator) Handles(a admission.Attributes) bool {
+	operation := a.GetOperation()
+	// We handle update because the gateway class of a gateway can change.
+	return admission.Create == operation || admission.Update == operation
+}
+
+// Matches returns true if the evaluator matches the specified quota with the provided input item
+func (g *gatewayEvaluator) Matches(resourceQuota *corev1.ResourceQuota, item runtime.Object) (bool, error) {
+	return generic.Matches(resourceQuota, item, g.MatchingResources, gatewayMatchesScopeFunc)
+}
+
+// MatchingResources takes the input specified list of resources and returns the set of resources it matches.
+func (g *gatewayEvaluator) MatchingResources(input []corev1.ResourceName) []corev1.ResourceName {
+	return quota.Intersection(input, gatewayResources)
+}
+
+// MatchingScopes takes the input specified list of scopes and input object. Returns the set of scopes resource matches.
+func (g *gatewayEvaluator) MatchingScopes(item runtime.Object, scopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return matchingScopes(item, scopes, gatewayMatchesScopeFunc)
+}
+
+// UncoveredQuotaScopes takes the input matched scopes which are limited by configuration and the matched quota scopes.
+// It returns the scopes which are in limited scopes but dont have a corresponding covering quota scope
+func (g *gatewayEvaluator) UncoveredQuotaScopes(limitedScopes []corev1.ScopedResourceSelectorRequirement, matchedQuotaScopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return uncoveredQuotaScopes(limitedScopes, matchedQuotaScopes), nil
+}
+
+// Usage knows how to measure usage associated with gateways
+func (g *gatewayEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	result := corev1.ResourceList{}
+	if _, err := toUnstructuredOrError(item, GatewayGroupVersionKind); err != nil {
+		return result, err
+	}
+	result[gatewayObjectCountName] = *(resource.NewQuantity(1, resource.DecimalSI))
+	return result, nil
+}
+
+// UsageStats calculates aggregate usage for the object.
+func (g *gatewayEvaluator) UsageStats(options quota.UsageStatsOptions) (quota.UsageStats, error) {
+	return generic.CalculateUsageStats(options, listUnstructuredFunc(g.cache, GatewayGroupVersionKind), gatewayMatchesScopeFunc, g.Usage)
+}
+
+var _ quota.Evaluator = &gatewayEvaluator{}
+
+// gatewayMatchesScopeFunc is a function that knows how to evaluate if a gateway matches a scope
+func gatewayMatchesScopeFunc(selector corev1.ScopedResourceSelectorRequirement, object runtime.Object) (bool, error) {
+	gateway, err := toUnstructuredOrError(object, GatewayGroupVersionKind)
+	if err != nil {
+		return false, err
+	}
+	if selector.ScopeName == ResourceQuotaScopeGatewayClass {
+		className, _, _ := unstructured.NestedString(gateway.Object, "spec", "gatewayClassName")
+		return classMatchesScope(selector, className)
+	}
+	return false, nil
+}
+
+// NewHTTPRouteEvaluator returns an evaluator that can evaluate http routes.
+func NewHTTPRouteEvaluator(cache client.Reader) quota.Evaluator {
+	return &httpRouteEvaluator{cache: cache}
+}
+
+// httpRouteEvaluator knows how to measure usage for http routes.
+type httpRouteEvaluator struct {
+	// knows how to list items by namespace
+	cache client.Reader
+}
+
+// Constraints verifies that all required resources are present on the item
+func (h *httpRouteEvaluator) Constraints(required []corev1.ResourceName, item runtime.Object) error {
+	// this is a no-op for http routes
+	return nil
+}
+
+// GroupResource that this evaluator tracks
+func (h *httpRouteEvaluator) GroupResource() schema.GroupResource {
+	return HTTPRouteGroupVersionKind.GroupVersion().WithResource("httproutes").GroupResource()
+}
+
+// Handles returns true of the evaluator should handle the specified operation.
+func (h *httpRouteEvaluator) Handles(a admission.Attributes) bool {
+	operation := a.GetOperation()
+	// We handle create and update because hostnames can be added to a route.
+	return admission.Create == operation || admission.Update == operation
+}
+
+// Matches returns true if the evaluator matches the specified quota with the provided input item
+func (h *httpRouteEvaluator) Matches(resourceQuota *corev1.ResourceQuota, item runtime.Object) (bool, error) {
+	return generic.Matches(resourceQuota, item, h.MatchingResources, generic.MatchesNoScopeFunc)
+}
+
+// MatchingResources takes the input specified list of resources and returns the set of resources it matches.
+func (h *httpRouteEvaluator) MatchingResources(input []corev1.ResourceName) []corev1.ResourceName {
+	return quota.Intersection(input, httpRouteResources)
+}
+
+// MatchingScopes takes the input specified list of scopes and input object. Returns the set of scopes resource matches.
+func (h *httpRouteEvaluator) MatchingScopes(item runtime.Object, scopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return []corev1.ScopedResourceSelectorRequirement{}, nil
+}
+
+// UncoveredQuotaScopes takes the input matched scopes which are limited by configuration and the matched quota scopes.
+// It returns the scopes which are in limited scopes but dont have a corresponding covering quota scope
+func (h *httpRouteEvaluator) UncoveredQuotaScopes(limitedScopes []corev1.ScopedResourceSelectorRequirement, matchedQuotaScopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return []corev1.ScopedResourceSelectorRequirement{}, nil
+}
+
+// Usage knows how to measure usage associated with http routes
+func (h *httpRouteEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	result := corev1.ResourceList{}
+	route, err := toUnstructuredOrError(item, HTTPRouteGroupVersionKind)
+	if err != nil {
+		return result, err
+	}
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	result[httpRouteObjectCountName] = *(resource.NewQuantity(1, resource.DecimalSI))
+	result[ResourceHTTPRoutesHostnames] = *(resource.NewQuantity(int64(sets.New(hostnames...).Len()), resource.DecimalSI))
+	return result, nil
+}
+
+// UsageStats calculates aggregate usage for the object.
+func (h *httpRouteEvaluator) UsageStats(options quota.UsageStatsOptions) (quota.UsageStats, error) {
+	return generic.CalculateUsageStats(options, listUnstructuredFunc(h.cache, HTTPRouteGroupVersionKind), generic.MatchesNoScopeFunc, h.Usage)
+}
+
+var _ quota.Evaluator = &httpRouteEvaluator{}
+
+// listUnstructuredFunc returns a function that lists the objects of the given kind in a namespace.
+func listUnstructuredFunc(cache client.Reader, gvk schema.GroupVersionKind) generic.ListFuncByNamespace {
+	return func(namespace string) ([]runtime.Object, error) {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		items := make([]runtime.Object, 0)
+		if err := cache.List(context.Background(), list, client.InNamespace(namespace)); err != nil {
+			// no object can use the quota while the CRD serving the resource is not installed
+			if meta.IsNoMatchError(err) {
+				return items, nil
+			}
+			return nil, err
+		}
+		for i := range list.Items {
+			items = append(items, &list.Items[i])
+		}
+		return items, nil
+	}
+}
+
+func toUnstructuredOrError(obj runtime.Object, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u.GroupVersionKind().GroupKind() != gvk.GroupKind() {
+		return nil, fmt.Errorf("expect %s, got %v", gvk.GroupKind(), obj)
+	}
+	return u, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/generic"
+)
+
+// the name used for object count quota
+var ingressObjectCountName = generic.ObjectCountQuotaResourceNameFor(networkingv1.SchemeGroupVersion.WithResource("ingresses").GroupResource())
+
+// ResourceIngressesHostnames is the number of distinct public hostnames served by ingresses
+const ResourceIngressesHostnames corev1.ResourceName = "ingresses.hostnames"
+
+// ingressClassAnnotation is the deprecated annotation that predates spec.ingressClassName
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// ingressResources are the set of resources managed by quota associated with ingresses.
+var ingressResources = []corev1.ResourceName{
+	ingressObjectCountName,
+	ResourceIngressesHostnames,
+}
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+
+// NewIngressEvaluator returns an evaluator that can evaluate ingresses.
+func NewIngressEvaluator(cache client.Reader) quota.Evaluator {
+	return &ingressEvaluator{cache: cache}
+}
+
+// ingressEvaluator knows how to measure usage for ingresses.
+type ingressEvaluator struct {
+	// knows how to list items by namespace
+	cache client.Reader
+}
+
+// Constraints verifies that all required resources are present on the item
+func (i *ingressEvaluator) Constraints(required []corev1.ResourceName, item runtime.Object) error {
+	// this is a no-op for ingresses
+	return nil
+}
+
+// GroupResource that this evaluator tracks
+func (i *ingressEvaluator) GroupResource() schema.GroupResource {
+	return networkingv1.SchemeGroupVersion.WithResource("ingresses").GroupResource()
+}
+
+// Handles returns true of the evaluator should handle the specified operation.
+func (i *ingressEvaluator) Handles(a admission.Attributes) bool {
+	operation := a.GetOperation()
+	// We handle create and update because hostnames can be added to an ingress.
+	return admission.Create == operation || admission.Update == operation
+}
+
+// Matches returns true if the evaluator matches the specified quota with the provided input item
+func (i *ingressEvaluator) Matches(resourceQuota *corev1.ResourceQuota, item runtime.Object) (bool, error) {
+	return generic.Matches(resourceQuota, item, i.MatchingResources, ingressMatchesScopeFunc)
+}
+
+// MatchingResources takes the input specified list of resources and returns the set of resources it matches.
+func (i *ingressEvaluator) MatchingResources(input []corev1.ResourceName) []corev1.ResourceName {
+	return quota.Intersection(input, ingressResources)
+}
+
+// MatchingScopes takes the input specified list of scopes and input object. Returns the set of scopes resource matches.
+func (i *ingressEvaluator) MatchingScopes(item runtime.Object, scopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return matchingScopes(item, scopes, ingressMatchesScopeFunc)
+}
+
+// UncoveredQuotaScopes takes the input matched scopes which are limited by configuration and the matched quota scopes.
+// It returns the scopes which are in limited scopes but dont have a corresponding covering quota scope
+func (i *ingressEvaluator) UncoveredQuotaScopes(limitedScopes []corev1.ScopedResourceSelectorRequirement, matchedQuotaScopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return uncoveredQuotaScopes(limitedScopes, matchedQuotaScopes), nil
+}
+
+// Usage knows how to measure usage associated with ingresses
+func (i *ingressEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	result := corev1.ResourceList{}
+	ingress, err := toExternalIngressOrError(item)
+	if err != nil {
+		return result, err
+	}
+	hostnames := sets.New[string]()
+	for _, rule := range ingress.Spec.Rules {
+		if len(rule.Host) > 0 {
+			hostnames.Insert(rule.Host)
+		}
+	}
+	for _, tls := range ingress.Spec.TLS {
+		for _, host := range tls.Hosts {
+			if len(host) > 0 {
+				hostnames.Insert(host)
+			}
+		}
+	}
+	result[ingressObjectCountName] = *(resource.NewQuantity(1, resource.DecimalSI))
+	result[ResourceIngressesHostnames] = *(resource.NewQuantity(int64(hostnames.Len()), resource.DecimalSI))
+	return result, nil
+}
+
+func (i *ingressEvaluator) listIngresses(namespace string) ([]runtime.Object, error) {
+	ingressList := &networkingv1.IngressList{}
+	if err := i.cache.List(context.Background(), ingressList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	ingresses := make([]runtime.Object, 0)
+	for j := range ingressList.Items {
+		ingresses = append(ingresses, &ingressList.Items[j])
+	}
+	return ingresses, nil
+}
+
+// UsageStats calculates aggregate usage for the object.
+func (i *ingressEvaluator) UsageStats(options quota.UsageStatsOptions) (quota.UsageStats, error) {
+	return generic.CalculateUsageStats(options, i.listIngresses, ingressMatchesScopeFunc, i.Usage)
+}
+
+var _ quota.Evaluator = &ingressEvaluator{}
+
+// ingressMatchesScopeFunc is a function that knows how to evaluate if an ingress matches a scope
+func ingressMatchesScopeFunc(selector corev1.ScopedResourceSelectorRequirement, object runtime.Object) (bool, error) {
+	ingress, err := toExternalIngressOrError(object)
+	if err != nil {
+		return false, err
+	}
+	if selector.ScopeName == ResourceQuotaScopeIngressClass {
+		return classMatchesScope(selector, GetIngressClass(ingress))
+	}
+	return false, nil
+}
+
+// GetIngressClass returns the class of the ingress, taking the deprecated annotation into account.
+func GetIngressClass(ingress *networkingv1.Ingress) string {
+	if ingress.Spec.IngressClassName != nil {
+		return *ingress.Spec.IngressClassName
+	}
+	return ingress.Annotations[ingressClassAnnotation]
+}
+
+func toExternalIngressOrError(obj runtime.Object) (*networkingv1.Ingress, error) {
+	var ingress *networkingv1.Ingress
+	switch t := obj.(type) {
+	case *networkingv1.Ingress:
+		ingress = t
+	default:
+		return nil, fmt.Errorf("expect *networkingv1.Ingress, got %v", t)
+	}
+	return ingress, nil
+}
@@ -25,8 +25,10 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apiserver/pkg/admission"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 
@@ -54,9 +56,10 @@ var pvcResources = []corev1.ResourceName{
 // * bronze.storageclass.storage.k8s.io/requests.storage: 500Gi
 const storageClassSuffix string = ".storageclass.storage.k8s.io/"
 
-// NewPersistentVolumeClaimEvaluator returns an evaluator that can evaluate persistent volume claims
-func NewPersistentVolumeClaimEvaluator(cache client.Reader) quota.Evaluator {
-	pvcEvaluator := &pvcEvaluator{cache: cache}
+// NewPersistentVolumeClaimEvaluator returns an evaluator that can evaluate persistent volume claims.  The pods owning
+// claims are read from apiReader when the cache has not observed them yet, apiReader may be nil.
+func NewPersistentVolumeClaimEvaluator(cache client.Reader, apiReader client.Reader) quota.Evaluator {
+	pvcEvaluator := &pvcEvaluator{cache: cache, apiReader: apiReader}
 	return pvcEvaluator
 }
 
@@ -64,6 +67,8 @@ func NewPersistentVolumeClaimEvaluator(cache client.Reader) quota.Evaluator {
 type pvcEvaluator struct {
 	// listFuncByNamespace knows how to list pvc claims
 	cache client.Reader
+	// apiReader reads the pods the cache has not observed yet
+	apiReader client.Reader
 }
 
 // Constraints verifies that all required resources are present on the item.
@@ -84,11 +89,28 @@ func (p *pvcEvaluator) Handles(a admission.Attributes) bool {
 		return true
 	}
 	if op == admission.Update && utilfeature.DefaultFeatureGate.Enabled(k8sfeatures.ExpandPersistentVolumes) {
-		return true
+		return isPersistentVolumeClaimExpansion(a)
 	}
 	return false
 }
 
+// isPersistentVolumeClaimExpansion returns true if the update increases the storage requested by the claim.
+// Shrinking or unrelated updates (labels, status, etc.) never consume additional quota, so they are not handled.
+func isPersistentVolumeClaimExpansion(a admission.Attributes) bool {
+	pvc, err := toExternalPersistentVolumeClaimOrError(a.GetObject())
+	if err != nil {
+		return false
+	}
+	oldPVC, err := toExternalPersistentVolumeClaimOrError(a.GetOldObject())
+	if err != nil {
+		// without the previous version we cannot compute a delta, let the quota check decide
+		return true
+	}
+	newSize := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	oldSize := oldPVC.Spec.Resources.Requests[corev1.ResourceStorage]
+	return newSize.Cmp(oldSize) > 0
+}
+
 // Matches returns true if the evaluator matches the specified quota with the provided input item
 func (p *pvcEvaluator) Matches(resourceQuota *corev1.ResourceQuota, item runtime.Object) (bool, error) {
 	return generic.Matches(resourceQuota, item, p.MatchingResources, generic.MatchesNoScopeFunc)
@@ -114,34 +136,81 @@ func (p *pvcEvaluator) MatchingResources(items []corev1.ResourceName) []corev1.R
 			result = append(result, item)
 			continue
 		}
-		// match pvc resources
-		if quota.Contains(pvcResources, item) {
+		if isPersistentVolumeClaimResource(item) {
 			result = append(result, item)
-			continue
-		}
-		// match pvc resources scoped by storage class (<storage-class-name>.storage-class.kubernetes.io/<resource>)
-		for _, resource := range pvcResources {
-			byStorageClass := storageClassSuffix + string(resource)
-			if strings.HasSuffix(string(item), byStorageClass) {
-				result = append(result, item)
-				break
-			}
 		}
 	}
 	return result
 }
 
+// isPersistentVolumeClaimResource returns true if the resource name is a pvc resource, either
+// unscoped or scoped by storage class (<storage-class-name>.storageclass.storage.k8s.io/<resource>).
+func isPersistentVolumeClaimResource(item corev1.ResourceName) bool {
+	if quota.Contains(pvcResources, item) {
+		return true
+	}
+	for _, resource := range pvcResources {
+		byStorageClass := storageClassSuffix + string(resource)
+		if strings.HasSuffix(string(item), byStorageClass) {
+			return true
+		}
+	}
+	return false
+}
+
 // Usage knows how to measure usage associated with item.
 func (p *pvcEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	return p.UsageWithContext(context.Background(), item)
+}
+
+// UsageWithContext knows how to measure usage associated with item, reading the pod owning the claim with ctx.
+func (p *pvcEvaluator) UsageWithContext(ctx context.Context, item runtime.Object) (corev1.ResourceList, error) {
 	result := corev1.ResourceList{}
 	pvc, err := toExternalPersistentVolumeClaimOrError(item)
 	if err != nil {
 		return result, err
 	}
 
+	// always quota the object count
+	result[pvcObjectCountName] = *(resource.NewQuantity(1, resource.DecimalSI))
+
+	// claims of generic ephemeral volumes are charged to the pod that owns them, see podEphemeralVolumeUsageHelper,
+	// they are only charged the storage they were expanded by
+	template, err := p.ephemeralVolumeClaimTemplate(ctx, pvc)
+	if err != nil {
+		return result, err
+	}
+	if template != nil {
+		return quota.Add(result, pvcExpansionUsageHelper(pvc, template)), nil
+	}
+	return quota.Add(result, pvcUsageHelper(pvc)), nil
+}
+
+// pvcExpansionUsageHelper summarizes the storage the claim of a generic ephemeral volume requests beyond its template.
+func pvcExpansionUsageHelper(pvc *corev1.PersistentVolumeClaim, template *corev1.PersistentVolumeClaimTemplate) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	request, found := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if !found {
+		return result
+	}
+	request.Sub(template.Spec.Resources.Requests[corev1.ResourceStorage])
+	if request.Sign() <= 0 {
+		return result
+	}
+	result[corev1.ResourceRequestsStorage] = request
+	if storageClassRef := helper.GetPersistentVolumeClaimClass(pvc); len(storageClassRef) > 0 {
+		storageClassStorage := corev1.ResourceName(storageClassRef + storageClassSuffix + string(corev1.ResourceRequestsStorage))
+		result[storageClassStorage] = request
+	}
+	return result
+}
+
+// pvcUsageHelper summarizes the claim and storage usage of a pvc, including the usage charged to its storage class.
+func pvcUsageHelper(pvc *corev1.PersistentVolumeClaim) corev1.ResourceList {
+	result := corev1.ResourceList{}
+
 	// charge for claim
 	result[corev1.ResourcePersistentVolumeClaims] = *(resource.NewQuantity(1, resource.DecimalSI))
-	result[pvcObjectCountName] = *(resource.NewQuantity(1, resource.DecimalSI))
 	storageClassRef := helper.GetPersistentVolumeClaimClass(pvc)
 	if len(storageClassRef) > 0 {
 		storageClassClaim := corev1.ResourceName(storageClassRef + storageClassSuffix + string(corev1.ResourcePersistentVolumeClaims))
@@ -157,7 +226,45 @@ func (p *pvcEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
 			result[storageClassStorage] = request
 		}
 	}
-	return result, nil
+	return result
+}
+
+// ephemeralVolumeClaimTemplate returns the template of the generic ephemeral volume the pvc was created for, i.e. the
+// volume claim template declared for the claim by the pod controlling it, or nil if the pvc is not such a claim.
+// Anyone creating claims can set a pod as their controller, so the owner reference alone is not trusted.  The
+// ephemeral volume controller may create the claim before the cache observes its pod, the pod is then read live.
+func (p *pvcEvaluator) ephemeralVolumeClaimTemplate(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaimTemplate, error) {
+	owner := metav1.GetControllerOf(pvc)
+	if owner == nil || owner.APIVersion != corev1.SchemeGroupVersion.String() || owner.Kind != "Pod" || p.cache == nil {
+		return nil, nil
+	}
+	key := types.NamespacedName{Namespace: pvc.Namespace, Name: owner.Name}
+	pod := &corev1.Pod{}
+	err := p.cache.Get(ctx, key, pod)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if (err != nil || pod.UID != owner.UID) && p.apiReader != nil {
+		pod = &corev1.Pod{}
+		err = p.apiReader.Get(ctx, key, pod)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+	// the claim of a deleted pod is charged until it is garbage collected
+	if err != nil || pod.UID != owner.UID {
+		return nil, nil
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Ephemeral == nil || volume.Ephemeral.VolumeClaimTemplate == nil {
+			continue
+		}
+		// the ephemeral volume controller names the claim <pod>-<volume>
+		if pvc.Name == pod.Name+"-"+volume.Name {
+			return volume.Ephemeral.VolumeClaimTemplate, nil
+		}
+	}
+	return nil, nil
 }
 
 func (p *pvcEvaluator) listPVC(namespace string) ([]runtime.Object, error) {
@@ -177,8 +284,9 @@ func (p *pvcEvaluator) UsageStats(options quota.UsageStatsOptions) (quota.UsageS
 	return generic.CalculateUsageStats(options, p.listPVC, generic.MatchesNoScopeFunc, p.Usage)
 }
 
-// ensure we implement required interface
+// ensure we implement required interfaces
 var _ quota.Evaluator = &pvcEvaluator{}
+var _ quota.ContextEvaluator = &pvcEvaluator{}
 
 func toExternalPersistentVolumeClaimOrError(obj runtime.Object) (*corev1.PersistentVolumeClaim, error) {
 	var pvc *corev1.PersistentVolumeClaim
@@ -0,0 +1,114 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+
+	k8sfeatures "caih.com/pkg/features"
+)
+
+func newPersistentVolumeClaim(storage string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "claim"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+			},
+		},
+	}
+}
+
+func pvcAttributes(operation admission.Operation, pvc, oldPVC runtime.Object) admission.Attributes {
+	return admission.NewAttributesRecord(pvc, oldPVC, corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"),
+		"namespace", "claim", corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"), "", operation, nil, false, nil)
+}
+
+func TestPersistentVolumeClaimEvaluatorHandles(t *testing.T) {
+	labeled := newPersistentVolumeClaim("10Gi")
+	labeled.Labels = map[string]string{"app": "db"}
+
+	testCases := map[string]struct {
+		expand     bool
+		attributes admission.Attributes
+		expected   bool
+	}{
+		"create": {
+			expand:     true,
+			attributes: pvcAttributes(admission.Create, newPersistentVolumeClaim("10Gi"), nil),
+			expected:   true,
+		},
+		"create without expansion": {
+			expand:     false,
+			attributes: pvcAttributes(admission.Create, newPersistentVolumeClaim("10Gi"), nil),
+			expected:   true,
+		},
+		"expansion": {
+			expand:     true,
+			attributes: pvcAttributes(admission.Update, newPersistentVolumeClaim("20Gi"), newPersistentVolumeClaim("10Gi")),
+			expected:   true,
+		},
+		"expansion without the feature": {
+			expand:     false,
+			attributes: pvcAttributes(admission.Update, newPersistentVolumeClaim("20Gi"), newPersistentVolumeClaim("10Gi")),
+			expected:   false,
+		},
+		"shrink": {
+			expand:     true,
+			attributes: pvcAttributes(admission.Update, newPersistentVolumeClaim("5Gi"), newPersistentVolumeClaim("10Gi")),
+			expected:   false,
+		},
+		"unchanged size": {
+			expand:     true,
+			attributes: pvcAttributes(admission.Update, labeled, newPersistentVolumeClaim("10Gi")),
+			expected:   false,
+		},
+		"update without the previous claim": {
+			expand:     true,
+			attributes: pvcAttributes(admission.Update, newPersistentVolumeClaim("10Gi"), nil),
+			expected:   true,
+		},
+		"delete": {
+			expand:     true,
+			attributes: pvcAttributes(admission.Delete, nil, newPersistentVolumeClaim("10Gi")),
+			expected:   false,
+		},
+	}
+	evaluator := NewPersistentVolumeClaimEvaluator(nil, nil)
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, k8sfeatures.ExpandPersistentVolumes, testCase.expand)
+			if actual := evaluator.Handles(testCase.attributes); actual != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpandPersistentVolumesEnabledByDefault(t *testing.T) {
+	if !utilfeature.DefaultFeatureGate.Enabled(k8sfeatures.ExpandPersistentVolumes) {
+		t.Errorf("expected %s to be enabled by default", k8sfeatures.ExpandPersistentVolumes)
+	}
+}
@@ -171,6 +171,10 @@ func (p *podEvaluator) MatchingResources(input []corev1.ResourceName) []corev1.R
 		if isExtendedResourceNameForQuota(resource) {
 			result = append(result, resource)
 		}
+		// for storage claimed by generic ephemeral volumes
+		if isPersistentVolumeClaimResource(resource) {
+			result = append(result, resource)
+		}
 	}
 
 	return result
@@ -295,6 +299,25 @@ func podComputeUsageHelper(requests corev1.ResourceList, limits corev1.ResourceL
 	return result
 }
 
+// podEphemeralVolumeUsageHelper summarizes the claim and storage usage of the generic ephemeral volumes of a pod.
+// The claims are only created by the ephemeral volume controller once the pod has been admitted, so charging
+// them here makes the pod fail admission up front instead of getting stuck waiting for claims that are denied.
+func podEphemeralVolumeUsageHelper(pod *corev1.Pod) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	for i := range pod.Spec.Volumes {
+		ephemeral := pod.Spec.Volumes[i].Ephemeral
+		if ephemeral == nil || ephemeral.VolumeClaimTemplate == nil {
+			continue
+		}
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: ephemeral.VolumeClaimTemplate.ObjectMeta,
+			Spec:       ephemeral.VolumeClaimTemplate.Spec,
+		}
+		result = quota.Add(result, pvcUsageHelper(claim))
+	}
+	return result
+}
+
 func toExternalPodOrError(obj runtime.Object) (*corev1.Pod, error) {
 	var pod *corev1.Pod
 	switch t := obj.(type) {
@@ -345,6 +368,10 @@ func PodUsageFunc(obj runtime.Object, clock clock.Clock) (corev1.ResourceList, e
 		podObjectCountName: *(resource.NewQuantity(1, resource.DecimalSI)),
 	}
 
+	// generic ephemeral volumes live as long as the pod object, regardless of its phase,
+	// so their claims are charged like the object count.
+	result = quota.Add(result, podEphemeralVolumeUsageHelper(pod))
+
 	// by convention, we do not quota compute resources that have reached end-of life
 	// note: the "pods" resource is considered a compute resource since it is tied to life-cycle.
 	if !QuotaV1Pod(pod, clock) {
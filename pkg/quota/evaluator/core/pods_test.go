@@ -0,0 +1,237 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"caih.com/pkg/quota"
+)
+
+func TestPodEphemeralVolumeClaimChargedOnce(t *testing.T) {
+	storageClass := "gold"
+	template := &corev1.PersistentVolumeClaimTemplate{
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod", UID: "pod-uid"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+			Volumes: []corev1.Volume{
+				{Name: "scratch", VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{VolumeClaimTemplate: template}}},
+				{Name: "config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	// the claim created by the ephemeral volume controller for the volume of the pod
+	controller := true
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "namespace",
+			Name:      "pod-scratch",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1", Kind: "Pod", Name: pod.Name, UID: pod.UID, Controller: &controller,
+			}},
+		},
+		Spec: template.Spec,
+	}
+
+	podEvaluator := NewPodEvaluator(nil, clock.RealClock{})
+	podUsage, err := podEvaluator.Usage(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pvcEvaluator := NewPersistentVolumeClaimEvaluator(fake.NewClientBuilder().WithObjects(pod).Build(), nil)
+	claimUsage, err := pvcEvaluator.Usage(claim)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := corev1.ResourceList{
+		corev1.ResourcePersistentVolumeClaims:                     resource.MustParse("1"),
+		corev1.ResourceRequestsStorage:                            resource.MustParse("5Gi"),
+		"gold.storageclass.storage.k8s.io/persistentvolumeclaims": resource.MustParse("1"),
+		"gold.storageclass.storage.k8s.io/requests.storage":       resource.MustParse("5Gi"),
+		"count/persistentvolumeclaims":                            resource.MustParse("1"),
+	}
+	total := quota.Add(podUsage, claimUsage)
+	actual := quota.Mask(total, quota.ResourceNames(expected))
+	if !quota.Equals(expected, actual) {
+		t.Errorf("expected the pod and its claim to charge %v, got %v", expected, actual)
+	}
+	if !quota.Equals(claimUsage, corev1.ResourceList{"count/persistentvolumeclaims": resource.MustParse("1")}) {
+		t.Errorf("expected the claim of the pod to only charge its object count, got %v", claimUsage)
+	}
+
+	// the quota on the storage is evaluated at the admission of the pod
+	matched := podEvaluator.MatchingResources([]corev1.ResourceName{
+		corev1.ResourceRequestsStorage, "gold.storageclass.storage.k8s.io/requests.storage",
+	})
+	if len(matched) != 2 {
+		t.Errorf("expected the pod evaluator to match the storage resources, got %v", matched)
+	}
+}
+
+func TestPersistentVolumeClaimUsageWithoutPodOwner(t *testing.T) {
+	claim := newPersistentVolumeClaim("10Gi")
+	claim.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db"}}
+	usage, err := NewPersistentVolumeClaimEvaluator(nil, nil).Usage(claim)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	storage := usage[corev1.ResourceRequestsStorage]
+	if storage.Cmp(resource.MustParse("10Gi")) != 0 {
+		t.Errorf("expected a claim not owned by a pod to charge its storage, got %v", usage)
+	}
+}
+
+func TestPersistentVolumeClaimUsageWithForgedPodOwner(t *testing.T) {
+	template := &corev1.PersistentVolumeClaimTemplate{Spec: newPersistentVolumeClaim("5Gi").Spec}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod", UID: "pod-uid"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+			Volumes: []corev1.Volume{
+				{Name: "scratch", VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{VolumeClaimTemplate: template}}},
+				{Name: "config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	evaluator := NewPersistentVolumeClaimEvaluator(fake.NewClientBuilder().WithObjects(pod).Build(), nil)
+
+	testCases := map[string]struct {
+		name     string
+		ownerUID string
+		owner    string
+	}{
+		"claim not named after a volume of the pod":   {name: "data", owner: pod.Name, ownerUID: string(pod.UID)},
+		"claim named after a volume without template": {name: "pod-config", owner: pod.Name, ownerUID: string(pod.UID)},
+		"owner uid of another pod":                    {name: "pod-scratch", owner: pod.Name, ownerUID: "other-uid"},
+		"owner not in the cache":                      {name: "missing-scratch", owner: "missing", ownerUID: "missing-uid"},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			controller := true
+			claim := newPersistentVolumeClaim("10Gi")
+			claim.Name = testCase.name
+			claim.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "v1", Kind: "Pod", Name: testCase.owner, UID: types.UID(testCase.ownerUID), Controller: &controller,
+			}}
+			usage, err := evaluator.Usage(claim)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			storage := usage[corev1.ResourceRequestsStorage]
+			if storage.Cmp(resource.MustParse("10Gi")) != 0 {
+				t.Errorf("expected a claim with a forged pod owner to charge its storage, got %v", usage)
+			}
+			claims := usage[corev1.ResourcePersistentVolumeClaims]
+			if claims.Cmp(resource.MustParse("1")) != 0 {
+				t.Errorf("expected a claim with a forged pod owner to charge a claim, got %v", usage)
+			}
+		})
+	}
+}
+
+func TestEphemeralVolumeClaimUsage(t *testing.T) {
+	storageClass := "gold"
+	template := &corev1.PersistentVolumeClaimTemplate{Spec: newPersistentVolumeClaim("5Gi").Spec}
+	template.Spec.StorageClassName = &storageClass
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "pod", UID: "pod-uid"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+			Volumes: []corev1.Volume{
+				{Name: "scratch", VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{VolumeClaimTemplate: template}}},
+			},
+		},
+	}
+	newClaim := func(storage string) *corev1.PersistentVolumeClaim {
+		controller := true
+		claim := newPersistentVolumeClaim(storage)
+		claim.Name = "pod-scratch"
+		claim.Spec.StorageClassName = &storageClass
+		claim.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "v1", Kind: "Pod", Name: pod.Name, UID: pod.UID, Controller: &controller,
+		}}
+		return claim
+	}
+	emptyCache := fake.NewClientBuilder().Build()
+	podCache := fake.NewClientBuilder().WithObjects(pod).Build()
+	count := corev1.ResourceList{"count/persistentvolumeclaims": resource.MustParse("1")}
+
+	testCases := map[string]struct {
+		cache     client.Reader
+		apiReader client.Reader
+		claim     *corev1.PersistentVolumeClaim
+		expected  corev1.ResourceList
+	}{
+		"pod not observed by the cache yet": {
+			cache: emptyCache, apiReader: podCache, claim: newClaim("5Gi"), expected: count,
+		},
+		"deleted pod": {
+			cache: emptyCache, apiReader: emptyCache, claim: newClaim("5Gi"),
+			expected: quota.Add(count, corev1.ResourceList{
+				corev1.ResourcePersistentVolumeClaims:                     resource.MustParse("1"),
+				corev1.ResourceRequestsStorage:                            resource.MustParse("5Gi"),
+				"gold.storageclass.storage.k8s.io/persistentvolumeclaims": resource.MustParse("1"),
+				"gold.storageclass.storage.k8s.io/requests.storage":       resource.MustParse("5Gi"),
+			}),
+		},
+		"expanded claim": {
+			cache: podCache, claim: newClaim("8Gi"),
+			expected: quota.Add(count, corev1.ResourceList{
+				corev1.ResourceRequestsStorage:                      resource.MustParse("3Gi"),
+				"gold.storageclass.storage.k8s.io/requests.storage": resource.MustParse("3Gi"),
+			}),
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			usage, err := NewPersistentVolumeClaimEvaluator(testCase.cache, testCase.apiReader).Usage(testCase.claim)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !quota.Equals(usage, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, usage)
+			}
+		})
+	}
+
+	// the expansion of the claim is charged by the difference of the usage of its versions
+	evaluator := NewPersistentVolumeClaimEvaluator(podCache, nil)
+	oldUsage, _ := evaluator.Usage(newClaim("8Gi"))
+	newUsage, _ := evaluator.Usage(newClaim("10Gi"))
+	delta := quota.SubtractWithNonNegativeResult(newUsage, oldUsage)
+	storage := delta[corev1.ResourceRequestsStorage]
+	if storage.Cmp(resource.MustParse("2Gi")) != 0 {
+		t.Errorf("expected the expansion of the claim to charge 2Gi, got %v", delta)
+	}
+}
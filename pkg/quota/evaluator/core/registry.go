@@ -34,13 +34,18 @@ var legacyObjectCountAliases = map[schema.GroupVersionResource]corev1.ResourceNa
 	corev1.SchemeGroupVersion.WithResource(string(corev1.ResourceSecrets)):                corev1.ResourceSecrets,
 }
 
-// NewEvaluators returns the list of static evaluators that manage more than counts
-func NewEvaluators(client client.Client) []quota.Evaluator {
+// NewEvaluators returns the list of static evaluators that manage more than counts.  apiReader reads the objects the
+// cache of client has not observed yet, it may be nil.
+func NewEvaluators(client client.Client, apiReader client.Reader) []quota.Evaluator {
 	// these evaluators have special logic
 	result := []quota.Evaluator{
 		NewPodEvaluator(client, clock.RealClock{}),
 		NewServiceEvaluator(client),
-		NewPersistentVolumeClaimEvaluator(client),
+		NewPersistentVolumeClaimEvaluator(client, apiReader),
+		NewVolumeSnapshotEvaluator(client),
+		NewIngressEvaluator(client),
+		NewGatewayEvaluator(client),
+		NewHTTPRouteEvaluator(client),
 	}
 	// these evaluators require an alias for backwards compatibility
 	for gvk, alias := range legacyObjectCountAliases {
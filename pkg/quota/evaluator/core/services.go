@@ -27,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/ptr"
 
 	"caih.com/pkg/quota"
 	"caih.com/pkg/quota/generic"
@@ -75,7 +76,7 @@ func (p *serviceEvaluator) Handles(a admission.Attributes) bool {
 
 // Matches returns true if the evaluator matches the specified quota with the provided input item
 func (p *serviceEvaluator) Matches(resourceQuota *corev1.ResourceQuota, item runtime.Object) (bool, error) {
-	return generic.Matches(resourceQuota, item, p.MatchingResources, generic.MatchesNoScopeFunc)
+	return generic.Matches(resourceQuota, item, p.MatchingResources, serviceMatchesScopeFunc)
 }
 
 // MatchingResources takes the input specified list of resources and returns the set of resources it matches.
@@ -85,13 +86,25 @@ func (p *serviceEvaluator) MatchingResources(input []corev1.ResourceName) []core
 
 // MatchingScopes takes the input specified list of scopes and input object. Returns the set of scopes resource matches.
 func (p *serviceEvaluator) MatchingScopes(item runtime.Object, scopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
-	return []corev1.ScopedResourceSelectorRequirement{}, nil
+	return matchingScopes(item, scopes, serviceMatchesScopeFunc)
 }
 
 // UncoveredQuotaScopes takes the input matched scopes which are limited by configuration and the matched quota scopes.
 // It returns the scopes which are in limited scopes but dont have a corresponding covering quota scope
 func (p *serviceEvaluator) UncoveredQuotaScopes(limitedScopes []corev1.ScopedResourceSelectorRequirement, matchedQuotaScopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
-	return []corev1.ScopedResourceSelectorRequirement{}, nil
+	return uncoveredQuotaScopes(limitedScopes, matchedQuotaScopes), nil
+}
+
+// serviceMatchesScopeFunc is a function that knows how to evaluate if a service matches a scope
+func serviceMatchesScopeFunc(selector corev1.ScopedResourceSelectorRequirement, object runtime.Object) (bool, error) {
+	svc, err := toExternalServiceOrError(object)
+	if err != nil {
+		return false, err
+	}
+	if selector.ScopeName == ResourceQuotaScopeLoadBalancerClass {
+		return classMatchesScope(selector, ptr.Deref(svc.Spec.LoadBalancerClass, ""))
+	}
+	return false, nil
 }
 
 // convert the input object to an internal service object or error.
@@ -147,7 +160,7 @@ func (p *serviceEvaluator) listServices(namespace string) ([]runtime.Object, err
 
 // UsageStats calculates aggregate usage for the object.
 func (p *serviceEvaluator) UsageStats(options quota.UsageStatsOptions) (quota.UsageStats, error) {
-	return generic.CalculateUsageStats(options, p.listServices, generic.MatchesNoScopeFunc, p.Usage)
+	return generic.CalculateUsageStats(options, p.listServices, serviceMatchesScopeFunc, p.Usage)
 }
 
 var _ quota.Evaluator = &serviceEvaluator{}
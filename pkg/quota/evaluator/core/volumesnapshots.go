@@ -0,0 +1,319 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/admission"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"caih.com/pkg/apis/core/v1/helper"
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/generic"
+)
+
+// VolumeSnapshotClassGroupVersionKind is the kind of the CSI external-snapshotter VolumeSnapshotClass.
+var VolumeSnapshotClassGroupVersionKind = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshotClass"}
+
+// isDefaultSnapshotClassAnnotation marks the VolumeSnapshotClass the snapshot controller assigns to the snapshots of
+// its driver that do not name a class.
+const isDefaultSnapshotClassAnnotation = "snapshot.storage.kubernetes.io/is-default-class"
+
+// VolumeSnapshotGroupVersionKind is the kind of the CSI external-snapshotter VolumeSnapshot.  The snapshot API is a CRD,
+// so snapshots are handled as unstructured objects rather than pulling in the external-snapshotter client.
+var VolumeSnapshotGroupVersionKind = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+// the name used for object count quota
+var volumeSnapshotObjectCountName = generic.ObjectCountQuotaResourceNameFor(
+	VolumeSnapshotGroupVersionKind.GroupVersion().WithResource("volumesnapshots").GroupResource())
+
+const (
+	// ResourceVolumeSnapshots is the number of volume snapshots
+	ResourceVolumeSnapshots corev1.ResourceName = "volumesnapshots"
+	// ResourceSnapshotsStorage is the total restore size of volume snapshots
+	ResourceSnapshotsStorage corev1.ResourceName = "snapshots.storage"
+)
+
+// volumeSnapshotResources are the set of static resources managed by quota associated with volume snapshots.
+// for each resource in this list, it may be refined dynamically based on volume snapshot class.
+var volumeSnapshotResources = []corev1.ResourceName{
+	ResourceVolumeSnapshots,
+	ResourceSnapshotsStorage,
+}
+
+// volumeSnapshotClassSuffix is the suffix to the qualified portion of volume snapshot class resource name.
+// It mirrors the storage class naming of persistent volume claims, for example:
+// * gold.volumesnapshotclass.snapshot.storage.k8s.io/volumesnapshots: 10
+// * gold.volumesnapshotclass.snapshot.storage.k8s.io/snapshots.storage: 500Gi
+const volumeSnapshotClassSuffix string = ".volumesnapshotclass.snapshot.storage.k8s.io/"
+
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots;volumesnapshotclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+
+// NewVolumeSnapshotEvaluator returns an evaluator that can evaluate volume snapshots
+func NewVolumeSnapshotEvaluator(cache client.Reader) quota.Evaluator {
+	return &volumeSnapshotEvaluator{cache: cache}
+}
+
+// volumeSnapshotEvaluator knows how to evaluate quota usage for volume snapshots
+type volumeSnapshotEvaluator struct {
+	// cache knows how to list snapshots and get their source claims
+	cache client.Reader
+}
+
+// Constraints verifies that all required resources are present on the item.
+func (v *volumeSnapshotEvaluator) Constraints(required []corev1.ResourceName, item runtime.Object) error {
+	return v.ConstraintsWithContext(context.Background(), required, item)
+}
+
+// ConstraintsWithContext verifies that all required resources are present on the item, reading its source claim with
+// ctx.  A snapshot that names no class is given the default class of its driver by the snapshot controller after
+// admission, so it is rejected by quotas limiting classes when that default class cannot be resolved at admission.
+func (v *volumeSnapshotEvaluator) ConstraintsWithContext(ctx context.Context, required []corev1.ResourceName, item runtime.Object) error {
+	snapshot, err := toVolumeSnapshotOrError(item)
+	if err != nil {
+		return err
+	}
+	var byClass []string
+	for _, resource := range required {
+		if strings.Contains(string(resource), volumeSnapshotClassSuffix) {
+			byClass = append(byClass, string(resource))
+		}
+	}
+	if len(byClass) == 0 {
+		return nil
+	}
+	className, err := v.snapshotClassName(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	if len(className) == 0 {
+		return fmt.Errorf("must specify volumeSnapshotClassName or have a default VolumeSnapshotClass for the driver of its source claim, required by %s", strings.Join(byClass, ","))
+	}
+	return nil
+}
+
+// GroupResource that this evaluator tracks
+func (v *volumeSnapshotEvaluator) GroupResource() schema.GroupResource {
+	return VolumeSnapshotGroupVersionKind.GroupVersion().WithResource("volumesnapshots").GroupResource()
+}
+
+// Handles returns true if the evaluator should handle the specified operation.
+// The spec of a volume snapshot is immutable, so only creation can consume quota.
+func (v *volumeSnapshotEvaluator) Handles(a admission.Attributes) bool {
+	return a.GetOperation() == admission.Create
+}
+
+// Matches returns true if the evaluator matches the specified quota with the provided input item
+func (v *volumeSnapshotEvaluator) Matches(resourceQuota *corev1.ResourceQuota, item runtime.Object) (bool, error) {
+	return generic.Matches(resourceQuota, item, v.MatchingResources, generic.MatchesNoScopeFunc)
+}
+
+// MatchingScopes takes the input specified list of scopes and input object. Returns the set of scopes resource matches.
+func (v *volumeSnapshotEvaluator) MatchingScopes(item runtime.Object, scopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return []corev1.ScopedResourceSelectorRequirement{}, nil
+}
+
+// UncoveredQuotaScopes takes the input matched scopes which are limited by configuration and the matched quota scopes.
+// It returns the scopes which are in limited scopes but dont have a corresponding covering quota scope
+func (v *volumeSnapshotEvaluator) UncoveredQuotaScopes(limitedScopes []corev1.ScopedResourceSelectorRequirement, matchedQuotaScopes []corev1.ScopedResourceSelectorRequirement) ([]corev1.ScopedResourceSelectorRequirement, error) {
+	return []corev1.ScopedResourceSelectorRequirement{}, nil
+}
+
+// MatchingResources takes the input specified list of resources and returns the set of resources it matches.
+func (v *volumeSnapshotEvaluator) MatchingResources(items []corev1.ResourceName) []corev1.ResourceName {
+	var result []corev1.ResourceName
+	for _, item := range items {
+		// match object count quota fields
+		if quota.Contains([]corev1.ResourceName{volumeSnapshotObjectCountName}, item) {
+			result = append(result, item)
+			continue
+		}
+		// match volume snapshot resources
+		if quota.Contains(volumeSnapshotResources, item) {
+			result = append(result, item)
+			continue
+		}
+		// match volume snapshot resources scoped by class (<class-name>.volumesnapshotclass.snapshot.storage.k8s.io/<resource>)
+		for _, resource := range volumeSnapshotResources {
+			byClass := volumeSnapshotClassSuffix + string(resource)
+			if strings.HasSuffix(string(item), byClass) {
+				result = append(result, item)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Usage knows how to measure usage associated with item.
+func (v *volumeSnapshotEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	return v.UsageWithContext(context.Background(), item)
+}
+
+// UsageWithContext knows how to measure usage associated with item, reading its source claim with ctx.
+// A snapshot is charged its status.restoreSize once the snapshot controller reports it.  Before that, which is
+// always the case at admission, it is charged the size of its source claim.  A snapshot that names no class is
+// charged to the default class of the driver of its source claim.
+func (v *volumeSnapshotEvaluator) UsageWithContext(ctx context.Context, item runtime.Object) (corev1.ResourceList, error) {
+	result := corev1.ResourceList{}
+	snapshot, err := toVolumeSnapshotOrError(item)
+	if err != nil {
+		return result, err
+	}
+
+	// charge for snapshot
+	result[volumeSnapshotObjectCountName] = *(resource.NewQuantity(1, resource.DecimalSI))
+	result[ResourceVolumeSnapshots] = *(resource.NewQuantity(1, resource.DecimalSI))
+	className, err := v.snapshotClassName(ctx, snapshot)
+	if err != nil {
+		return result, err
+	}
+	if len(className) > 0 {
+		classSnapshots := corev1.ResourceName(className + volumeSnapshotClassSuffix + string(ResourceVolumeSnapshots))
+		result[classSnapshots] = *(resource.NewQuantity(1, resource.DecimalSI))
+	}
+
+	// charge for storage
+	restoreSize, found, err := v.restoreSize(ctx, snapshot)
+	if err != nil {
+		return result, err
+	}
+	if found {
+		result[ResourceSnapshotsStorage] = restoreSize
+		// charge usage to the volume snapshot class (if present)
+		if len(className) > 0 {
+			classStorage := corev1.ResourceName(className + volumeSnapshotClassSuffix + string(ResourceSnapshotsStorage))
+			result[classStorage] = restoreSize
+		}
+	}
+	return result, nil
+}
+
+// snapshotClassName returns the class of the snapshot, or the default class of the driver of its source claim if it
+// names none.  It is empty if the default class cannot be resolved.
+func (v *volumeSnapshotEvaluator) snapshotClassName(ctx context.Context, snapshot *unstructured.Unstructured) (string, error) {
+	if className, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName"); len(className) > 0 {
+		return className, nil
+	}
+	claimName, found, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	if !found || v.cache == nil {
+		return "", nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := v.cache.Get(ctx, types.NamespacedName{Namespace: snapshot.GetNamespace(), Name: claimName}, pvc); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	driver, err := v.claimDriver(ctx, pvc)
+	if err != nil || len(driver) == 0 {
+		return "", err
+	}
+	classes := &unstructured.UnstructuredList{}
+	classes.SetGroupVersionKind(VolumeSnapshotClassGroupVersionKind.GroupVersion().WithKind(VolumeSnapshotClassGroupVersionKind.Kind + "List"))
+	if err := v.cache.List(ctx, classes); err != nil {
+		if meta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	var defaults []string
+	for _, class := range classes.Items {
+		classDriver, _, _ := unstructured.NestedString(class.Object, "driver")
+		if classDriver == driver && class.GetAnnotations()[isDefaultSnapshotClassAnnotation] == "true" {
+			defaults = append(defaults, class.GetName())
+		}
+	}
+	// the snapshot controller fails the snapshots of a driver with several default classes
+	if len(defaults) != 1 {
+		return "", nil
+	}
+	return defaults[0], nil
+}
+
+// claimDriver returns the CSI driver of the volume bound to the claim, or the provisioner of its storage class while
+// it is not bound.
+func (v *volumeSnapshotEvaluator) claimDriver(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	if len(pvc.Spec.VolumeName) > 0 {
+		pv := &corev1.PersistentVolume{}
+		if err := v.cache.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+		if pv.Spec.CSI != nil {
+			return pv.Spec.CSI.Driver, nil
+		}
+	}
+	storageClassName := helper.GetPersistentVolumeClaimClass(pvc)
+	if len(storageClassName) == 0 {
+		return "", nil
+	}
+	storageClass := &storagev1.StorageClass{}
+	if err := v.cache.Get(ctx, types.NamespacedName{Name: storageClassName}, storageClass); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	return storageClass.Provisioner, nil
+}
+
+// restoreSize returns the size of the volume restored from the snapshot, if it can be determined.
+func (v *volumeSnapshotEvaluator) restoreSize(ctx context.Context, snapshot *unstructured.Unstructured) (resource.Quantity, bool, error) {
+	if size, found, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); found {
+		quantity, err := resource.ParseQuantity(size)
+		if err != nil {
+			return resource.Quantity{}, false, fmt.Errorf("invalid restoreSize of volume snapshot %s/%s: %v", snapshot.GetNamespace(), snapshot.GetName(), err)
+		}
+		return quantity, true, nil
+	}
+	// pre-provisioned snapshots reference a content we know nothing about
+	claimName, found, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	if !found || v.cache == nil {
+		return resource.Quantity{}, false, nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := v.cache.Get(ctx, types.NamespacedName{Namespace: snapshot.GetNamespace(), Name: claimName}, pvc); err != nil {
+		return resource.Quantity{}, false, client.IgnoreNotFound(err)
+	}
+	if capacity, found := pvc.Status.Capacity[corev1.ResourceStorage]; found {
+		return capacity, true, nil
+	}
+	request, found := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	return request, found, nil
+}
+
+// UsageStats calculates aggregate usage for the object.
+func (v *volumeSnapshotEvaluator) UsageStats(options quota.UsageStatsOptions) (quota.UsageStats, error) {
+	return generic.CalculateUsageStats(options, listUnstructuredFunc(v.cache, VolumeSnapshotGroupVersionKind), generic.MatchesNoScopeFunc, v.Usage)
+}
+
+// ensure we implement required interfaces
+var _ quota.Evaluator = &volumeSnapshotEvaluator{}
+var _ quota.ContextEvaluator = &volumeSnapshotEvaluator{}
+var _ quota.ContextConstrainer = &volumeSnapshotEvaluator{}
+
+func toVolumeSnapshotOrError(obj runtime.Object) (*unstructured.Unstructured, error) {
+	return toUnstructuredOrError(obj, VolumeSnapshotGroupVersionKind)
+}
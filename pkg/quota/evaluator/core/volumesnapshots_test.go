@@ -0,0 +1,298 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"caih.com/pkg/quota"
+)
+
+func newVolumeSnapshot(className, claimName, restoreSize string) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGroupVersionKind)
+	snapshot.SetNamespace("namespace")
+	snapshot.SetName("snapshot")
+	if len(className) > 0 {
+		_ = unstructured.SetNestedField(snapshot.Object, className, "spec", "volumeSnapshotClassName")
+	}
+	if len(claimName) > 0 {
+		_ = unstructured.SetNestedField(snapshot.Object, claimName, "spec", "source", "persistentVolumeClaimName")
+	} else {
+		_ = unstructured.SetNestedField(snapshot.Object, "content", "spec", "source", "volumeSnapshotContentName")
+	}
+	if len(restoreSize) > 0 {
+		_ = unstructured.SetNestedField(snapshot.Object, restoreSize, "status", "restoreSize")
+	}
+	return snapshot
+}
+
+func TestVolumeSnapshotUsage(t *testing.T) {
+	boundClaim := newPersistentVolumeClaim("10Gi")
+	boundClaim.Name = "bound"
+	boundClaim.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("12Gi")}
+	pendingClaim := newPersistentVolumeClaim("10Gi")
+	pendingClaim.Name = "pending"
+	cache := fake.NewClientBuilder().WithObjects(boundClaim, pendingClaim).Build()
+
+	snapshots := corev1.ResourceName("count/volumesnapshots.snapshot.storage.k8s.io")
+	testCases := map[string]struct {
+		snapshot runtime.Object
+		expected corev1.ResourceList
+		err      bool
+	}{
+		"restore size reported": {
+			snapshot: newVolumeSnapshot("", "bound", "5Gi"),
+			expected: corev1.ResourceList{
+				snapshots:                resource.MustParse("1"),
+				ResourceVolumeSnapshots:  resource.MustParse("1"),
+				ResourceSnapshotsStorage: resource.MustParse("5Gi"),
+			},
+		},
+		"charged to its class": {
+			snapshot: newVolumeSnapshot("gold", "", "5Gi"),
+			expected: corev1.ResourceList{
+				snapshots:                resource.MustParse("1"),
+				ResourceVolumeSnapshots:  resource.MustParse("1"),
+				ResourceSnapshotsStorage: resource.MustParse("5Gi"),
+				"gold.volumesnapshotclass.snapshot.storage.k8s.io/volumesnapshots":   resource.MustParse("1"),
+				"gold.volumesnapshotclass.snapshot.storage.k8s.io/snapshots.storage": resource.MustParse("5Gi"),
+			},
+		},
+		"capacity of the bound source claim": {
+			snapshot: newVolumeSnapshot("", "bound", ""),
+			expected: corev1.ResourceList{
+				snapshots:                resource.MustParse("1"),
+				ResourceVolumeSnapshots:  resource.MustParse("1"),
+				ResourceSnapshotsStorage: resource.MustParse("12Gi"),
+			},
+		},
+		"request of the pending source claim": {
+			snapshot: newVolumeSnapshot("", "pending", ""),
+			expected: corev1.ResourceList{
+				snapshots:                resource.MustParse("1"),
+				ResourceVolumeSnapshots:  resource.MustParse("1"),
+				ResourceSnapshotsStorage: resource.MustParse("10Gi"),
+			},
+		},
+		"missing source claim": {
+			snapshot: newVolumeSnapshot("", "missing", ""),
+			expected: corev1.ResourceList{
+				snapshots:               resource.MustParse("1"),
+				ResourceVolumeSnapshots: resource.MustParse("1"),
+			},
+		},
+		"pre-provisioned": {
+			snapshot: newVolumeSnapshot("", "", ""),
+			expected: corev1.ResourceList{
+				snapshots:               resource.MustParse("1"),
+				ResourceVolumeSnapshots: resource.MustParse("1"),
+			},
+		},
+		"invalid restore size": {
+			snapshot: newVolumeSnapshot("", "", "large"),
+			err:      true,
+		},
+		"not a snapshot": {
+			snapshot: newPersistentVolumeClaim("10Gi"),
+			err:      true,
+		},
+	}
+	evaluator := NewVolumeSnapshotEvaluator(cache)
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			usage, err := quota.UsageWithContext(context.Background(), evaluator, testCase.snapshot)
+			if testCase.err {
+				if err == nil {
+					t.Errorf("expected an error, got usage %v", usage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !quota.Equals(usage, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, usage)
+			}
+		})
+	}
+}
+
+func TestVolumeSnapshotUsageWithContext(t *testing.T) {
+	cache := fake.NewClientBuilder().WithObjects(newPersistentVolumeClaim("10Gi")).Build()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var reads []context.Context
+	evaluator := NewVolumeSnapshotEvaluator(readerFunc(func(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+		reads = append(reads, ctx)
+		return cache.Get(ctx, key, obj)
+	}))
+	if _, err := quota.UsageWithContext(ctx, evaluator, newVolumeSnapshot("", "claim", "")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reads) == 0 {
+		t.Errorf("expected the source claim to be read")
+	}
+	for _, read := range reads {
+		if read != ctx {
+			t.Errorf("expected the source claim to be read with the admission context")
+		}
+	}
+}
+
+// readerFunc is a client.Reader getting objects with the function, its lists fail as if the CRD was not installed.
+type readerFunc func(ctx context.Context, key client.ObjectKey, obj client.Object) error
+
+func (f readerFunc) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return f(ctx, key, obj)
+}
+
+func (f readerFunc) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return &meta.NoKindMatchError{GroupKind: list.GetObjectKind().GroupVersionKind().GroupKind()}
+}
+
+func TestVolumeSnapshotMatchingResources(t *testing.T) {
+	input := []corev1.ResourceName{
+		"count/volumesnapshots.snapshot.storage.k8s.io",
+		ResourceVolumeSnapshots,
+		ResourceSnapshotsStorage,
+		"gold.volumesnapshotclass.snapshot.storage.k8s.io/volumesnapshots",
+		"gold.volumesnapshotclass.snapshot.storage.k8s.io/snapshots.storage",
+		corev1.ResourceRequestsStorage,
+		"gold.storageclass.storage.k8s.io/requests.storage",
+		"gold.volumesnapshotclass.snapshot.storage.k8s.io/requests.storage",
+	}
+	actual := NewVolumeSnapshotEvaluator(nil).MatchingResources(input)
+	if !quota.Equals(quota.Mask(toUsage(input), actual), toUsage(input[:5])) {
+		t.Errorf("expected %v, got %v", input[:5], actual)
+	}
+}
+
+// toUsage returns a usage of one of every resource, to compare sets of resource names.
+func toUsage(names []corev1.ResourceName) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	for _, name := range names {
+		result[name] = resource.MustParse("1")
+	}
+	return result
+}
+
+func TestVolumeSnapshotUsageStatsWithoutCRD(t *testing.T) {
+	// the cache cannot map snapshots to a resource
+	cache := readerFunc(func(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+		return &meta.NoKindMatchError{GroupKind: VolumeSnapshotGroupVersionKind.GroupKind()}
+	})
+	stats, err := NewVolumeSnapshotEvaluator(cache).UsageStats(quota.UsageStatsOptions{
+		Namespace: "namespace",
+		Resources: []corev1.ResourceName{ResourceVolumeSnapshots, ResourceSnapshotsStorage},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := corev1.ResourceList{ResourceVolumeSnapshots: resource.MustParse("0"), ResourceSnapshotsStorage: resource.MustParse("0")}
+	if !quota.Equals(stats.Used, expected) {
+		t.Errorf("expected %v, got %v", expected, stats.Used)
+	}
+}
+
+func newVolumeSnapshotClass(name, driver string, isDefault bool) *unstructured.Unstructured {
+	class := &unstructured.Unstructured{Object: map[string]interface{}{"driver": driver}}
+	class.SetGroupVersionKind(VolumeSnapshotClassGroupVersionKind)
+	class.SetName(name)
+	if isDefault {
+		class.SetAnnotations(map[string]string{isDefaultSnapshotClassAnnotation: "true"})
+	}
+	return class
+}
+
+func TestVolumeSnapshotWithoutClass(t *testing.T) {
+	boundClaim := newPersistentVolumeClaim("10Gi")
+	boundClaim.Name = "bound"
+	boundClaim.Spec.VolumeName = "volume"
+	volume := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "volume"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: "csi.example.com"}},
+		},
+	}
+	fast := "fast"
+	pendingClaim := newPersistentVolumeClaim("10Gi")
+	pendingClaim.Name = "pending"
+	pendingClaim.Spec.StorageClassName = &fast
+	storageClass := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: fast}, Provisioner: "csi.example.com"}
+	otherClaim := newPersistentVolumeClaim("10Gi")
+	otherClaim.Name = "other"
+	cache := fake.NewClientBuilder().WithObjects(boundClaim, volume, pendingClaim, storageClass, otherClaim,
+		newVolumeSnapshotClass("gold", "csi.example.com", true),
+		newVolumeSnapshotClass("silver", "csi.example.com", false),
+		newVolumeSnapshotClass("bronze", "other.example.com", true),
+	).Build()
+	evaluator := NewVolumeSnapshotEvaluator(cache)
+	byClass := []corev1.ResourceName{ResourceVolumeSnapshots, "gold.volumesnapshotclass.snapshot.storage.k8s.io/volumesnapshots"}
+
+	testCases := map[string]struct {
+		snapshot  *unstructured.Unstructured
+		className string
+	}{
+		"default class of the driver of the bound volume":       {snapshot: newVolumeSnapshot("", "bound", ""), className: "gold"},
+		"default class of the provisioner of the storage class": {snapshot: newVolumeSnapshot("", "pending", ""), className: "gold"},
+		"no driver of the source claim":                         {snapshot: newVolumeSnapshot("", "other", "")},
+		"missing source claim":                                  {snapshot: newVolumeSnapshot("", "missing", "")},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			usage, err := quota.UsageWithContext(context.Background(), evaluator, testCase.snapshot)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			classSnapshots := corev1.ResourceName(testCase.className + volumeSnapshotClassSuffix + string(ResourceVolumeSnapshots))
+			_, charged := usage[classSnapshots]
+			if len(testCase.className) > 0 && !charged {
+				t.Errorf("expected the snapshot to be charged to %s, got %v", testCase.className, usage)
+			}
+			for resourceName := range usage {
+				if strings.Contains(string(resourceName), volumeSnapshotClassSuffix) && resourceName != classSnapshots &&
+					resourceName != corev1.ResourceName(testCase.className+volumeSnapshotClassSuffix+string(ResourceSnapshotsStorage)) {
+					t.Errorf("expected the snapshot not to be charged to %s", resourceName)
+				}
+			}
+
+			err = quota.ConstraintsWithContext(context.Background(), evaluator, byClass, testCase.snapshot)
+			if len(testCase.className) > 0 && err != nil {
+				t.Errorf("expected the snapshot to satisfy a quota limiting classes, got %v", err)
+			}
+			if len(testCase.className) == 0 && err == nil {
+				t.Errorf("expected a snapshot without class to be rejected by a quota limiting classes")
+			}
+			if err := quota.ConstraintsWithContext(context.Background(), evaluator, byClass[:1], testCase.snapshot); err != nil {
+				t.Errorf("expected the snapshot to satisfy a quota not limiting classes, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/clock"
+
+	"caih.com/pkg/quota"
+)
+
+// defaultMaxSurge is the default maxSurge of a rolling update deployment
+var defaultMaxSurge = intstr.FromString("25%")
+
+// NewDeploymentEvaluator returns an evaluator that projects the usage of deployments.
+func NewDeploymentEvaluator(clock clock.Clock) Evaluator {
+	return &deploymentEvaluator{clock: clock}
+}
+
+// deploymentEvaluator projects the usage of deployments.
+type deploymentEvaluator struct {
+	clock clock.Clock
+}
+
+// GroupResource that this evaluator tracks
+func (d *deploymentEvaluator) GroupResource() schema.GroupResource {
+	return appsv1.SchemeGroupVersion.WithResource("deployments").GroupResource()
+}
+
+// Handles returns true if the evaluator should handle the specified attributes.
+func (d *deploymentEvaluator) Handles(a admission.Attributes) bool {
+	return handlesCreateOrUpdate(a)
+}
+
+// PodTemplate returns a pod built from the deployment's pod template.
+func (d *deploymentEvaluator) PodTemplate(item runtime.Object) (*corev1.Pod, error) {
+	deployment, err := toDeploymentOrError(item)
+	if err != nil {
+		return nil, err
+	}
+	return podForTemplate(deployment.Namespace, &deployment.Spec.Template), nil
+}
+
+// ProjectedUsage returns replicas × pod usage.  When an update rolls out a new template, the surge pods
+// that co-exist with the old replica set during a rolling update are charged on top of it.
+func (d *deploymentEvaluator) ProjectedUsage(a admission.Attributes) (corev1.ResourceList, error) {
+	deployment, err := toDeploymentOrError(a.GetObject())
+	if err != nil {
+		return nil, err
+	}
+	replicas := replicasOrDefault(deployment.Spec.Replicas)
+	usage, err := replicaUsage(a.GetNamespace(), &deployment.Spec.Template, replicas, d.clock)
+	if err != nil {
+		return nil, err
+	}
+	if a.GetOperation() != admission.Update || a.GetOldObject() == nil {
+		return usage, nil
+	}
+
+	oldDeployment, err := toDeploymentOrError(a.GetOldObject())
+	if err != nil {
+		return nil, err
+	}
+	if templateChanged(&oldDeployment.Spec.Template, &deployment.Spec.Template) {
+		surge, err := maxSurge(deployment, replicas)
+		if err != nil {
+			return nil, err
+		}
+		surgeUsage, err := replicaUsage(a.GetNamespace(), &deployment.Spec.Template, surge, d.clock)
+		if err != nil {
+			return nil, err
+		}
+		usage = quota.Add(usage, surgeUsage)
+	}
+	oldUsage, err := replicaUsage(a.GetNamespace(), &oldDeployment.Spec.Template, replicasOrDefault(oldDeployment.Spec.Replicas), d.clock)
+	if err != nil {
+		return nil, err
+	}
+	return quota.SubtractWithNonNegativeResult(usage, oldUsage), nil
+}
+
+// maxSurge returns the number of pods a rolling update may create above the desired number of replicas.
+func maxSurge(deployment *appsv1.Deployment, replicas int64) (int64, error) {
+	if deployment.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return 0, nil
+	}
+	surge := &defaultMaxSurge
+	if deployment.Spec.Strategy.RollingUpdate != nil && deployment.Spec.Strategy.RollingUpdate.MaxSurge != nil {
+		surge = deployment.Spec.Strategy.RollingUpdate.MaxSurge
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(surge, int(replicas), true)
+	if err != nil {
+		return 0, err
+	}
+	return int64(value), nil
+}
+
+func toDeploymentOrError(obj runtime.Object) (*appsv1.Deployment, error) {
+	switch t := obj.(type) {
+	case *appsv1.Deployment:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("expect *appsv1.Deployment, got %v", t)
+	}
+}
+
+// NewReplicaSetEvaluator returns an evaluator that projects the usage of replica sets.
+func NewReplicaSetEvaluator(clock clock.Clock) Evaluator {
+	return &replicaSetEvaluator{clock: clock}
+}
+
+// replicaSetEvaluator projects the usage of replica sets.
+type replicaSetEvaluator struct {
+	clock clock.Clock
+}
+
+// GroupResource that this evaluator tracks
+func (r *replicaSetEvaluator) GroupResource() schema.GroupResource {
+	return appsv1.SchemeGroupVersion.WithResource("replicasets").GroupResource()
+}
+
+// Handles returns true if the evaluator should handle the specified attributes.
+// Replica sets managed by a deployment are projected as part of the deployment.
+func (r *replicaSetEvaluator) Handles(a admission.Attributes) bool {
+	if !handlesCreateOrUpdate(a) {
+		return false
+	}
+	replicaSet, err := toReplicaSetOrError(a.GetObject())
+	if err != nil {
+		return false
+	}
+	owner := metav1.GetControllerOf(replicaSet)
+	return owner == nil || owner.Kind != "Deployment"
+}
+
+// PodTemplate returns a pod built from the replica set's pod template.
+func (r *replicaSetEvaluator) PodTemplate(item runtime.Object) (*corev1.Pod, error) {
+	replicaSet, err := toReplicaSetOrError(item)
+	if err != nil {
+		return nil, err
+	}
+	return podForTemplate(replicaSet.Namespace, &replicaSet.Spec.Template), nil
+}
+
+// ProjectedUsage returns replicas × pod usage.  A replica set never replaces running pods when its
+// template changes, so on update only the additional replicas are charged.
+func (r *replicaSetEvaluator) ProjectedUsage(a admission.Attributes) (corev1.ResourceList, error) {
+	replicaSet, err := toReplicaSetOrError(a.GetObject())
+	if err != nil {
+		return nil, err
+	}
+	replicas := replicasOrDefault(replicaSet.Spec.Replicas)
+	if a.GetOperation() == admission.Update && a.GetOldObject() != nil {
+		oldReplicaSet, err := toReplicaSetOrError(a.GetOldObject())
+		if err != nil {
+			return nil, err
+		}
+		replicas = max(replicas-replicasOrDefault(oldReplicaSet.Spec.Replicas), 0)
+	}
+	return replicaUsage(a.GetNamespace(), &replicaSet.Spec.Template, replicas, r.clock)
+}
+
+func toReplicaSetOrError(obj runtime.Object) (*appsv1.ReplicaSet, error) {
+	switch t := obj.(type) {
+	case *appsv1.ReplicaSet:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("expect *appsv1.ReplicaSet, got %v", t)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/clock"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+)
+
+// Evaluator knows how to project the usage of the pods a workload is going to create.
+// Unlike quota.Evaluator, it never charges usage: the pods are charged when they are admitted.
+type Evaluator interface {
+	// GroupResource returns the groupResource that this object knows how to evaluate
+	GroupResource() schema.GroupResource
+	// Handles determines if the projected usage could be impacted by the specified attribute.
+	Handles(a admission.Attributes) bool
+	// PodTemplate returns a pod built from the workload's pod template, used to match quota scopes
+	PodTemplate(item runtime.Object) (*corev1.Pod, error)
+	// ProjectedUsage returns the usage the operation adds once the workload is fully rolled out
+	ProjectedUsage(a admission.Attributes) (corev1.ResourceList, error)
+}
+
+// Registry maintains a list of workload evaluators
+type Registry interface {
+	// Get by group resource
+	Get(gr schema.GroupResource) Evaluator
+}
+
+type simpleRegistry map[schema.GroupResource]Evaluator
+
+// NewRegistry creates a registry with the workload evaluators of apps/v1 and batch/v1.
+func NewRegistry(clock clock.Clock) Registry {
+	registry := simpleRegistry{}
+	for _, evaluator := range []Evaluator{
+		NewDeploymentEvaluator(clock),
+		NewReplicaSetEvaluator(clock),
+		NewStatefulSetEvaluator(clock),
+		NewJobEvaluator(clock),
+		NewCronJobEvaluator(clock),
+	} {
+		registry[evaluator.GroupResource()] = evaluator
+	}
+	return registry
+}
+
+func (r simpleRegistry) Get(gr schema.GroupResource) Evaluator {
+	return r[gr]
+}
+
+// podForTemplate builds the pod a controller would create from the template.
+func podForTemplate(namespace string, template *corev1.PodTemplateSpec) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	pod.Namespace = namespace
+	return pod
+}
+
+// templateUsage returns the usage of a single pod created from the template.
+func templateUsage(namespace string, template *corev1.PodTemplateSpec, clock clock.Clock) (corev1.ResourceList, error) {
+	return core.PodUsageFunc(podForTemplate(namespace, template), clock)
+}
+
+// replicaUsage returns the usage of the given number of pods created from the template.
+func replicaUsage(namespace string, template *corev1.PodTemplateSpec, replicas int64, clock clock.Clock) (corev1.ResourceList, error) {
+	usage, err := templateUsage(namespace, template, clock)
+	if err != nil {
+		return nil, err
+	}
+	return quota.Multiply(usage, replicas), nil
+}
+
+// templateChanged returns true if the update rolls out a new pod template.
+func templateChanged(oldTemplate, newTemplate *corev1.PodTemplateSpec) bool {
+	return !equality.Semantic.DeepEqual(oldTemplate, newTemplate)
+}
+
+// handlesCreateOrUpdate returns true for the operations that may increase the projected usage.
+func handlesCreateOrUpdate(a admission.Attributes) bool {
+	op := a.GetOperation()
+	return op == admission.Create || op == admission.Update
+}
+
+// replicasOrDefault returns the number of replicas, which defaults to one when unset.
+func replicasOrDefault(replicas *int32) int64 {
+	if replicas == nil {
+		return 1
+	}
+	return int64(*replicas)
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	"caih.com/pkg/quota"
+)
+
+func newTemplate(cpu string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:      "app",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}},
+			}},
+		},
+	}
+}
+
+func newDeployment(replicas int32, cpu string, strategy appsv1.DeploymentStrategy) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "deployment"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: newTemplate(cpu), Strategy: strategy},
+	}
+}
+
+func newStatefulSet(replicas int32, cpu, storage string) *appsv1.StatefulSet {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "statefulset"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas, Template: newTemplate(cpu)},
+	}
+	if len(storage) > 0 {
+		statefulSet.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Name: "data"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+				},
+			},
+		}}
+	}
+	return statefulSet
+}
+
+func newJobSpec(parallelism, completions *int32, suspend bool, cpu string) batchv1.JobSpec {
+	return batchv1.JobSpec{Parallelism: parallelism, Completions: completions, Suspend: &suspend, Template: newTemplate(cpu)}
+}
+
+func newJob(parallelism, completions *int32, suspend bool, cpu string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "job"},
+		Spec:       newJobSpec(parallelism, completions, suspend, cpu),
+	}
+}
+
+func newCronJob(parallelism int32, cpu string) *batchv1.CronJob {
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "cronjob"},
+		Spec: batchv1.CronJobSpec{
+			Schedule:    "*/5 * * * *",
+			JobTemplate: batchv1.JobTemplateSpec{Spec: newJobSpec(&parallelism, nil, false, cpu)},
+		},
+	}
+}
+
+func workloadAttributes(evaluator Evaluator, operation admission.Operation, obj, oldObj runtime.Object) admission.Attributes {
+	resource := evaluator.GroupResource().WithVersion("v1")
+	return admission.NewAttributesRecord(obj, oldObj, resource.GroupVersion().WithKind(""), "namespace", "workload", resource,
+		"", operation, nil, false, nil)
+}
+
+// withoutZeros drops the resources the usage does not change.
+func withoutZeros(usage corev1.ResourceList) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	for name, quantity := range usage {
+		if !quantity.IsZero() {
+			result[name] = quantity
+		}
+	}
+	return result
+}
+
+func TestProjectedUsage(t *testing.T) {
+	rollingUpdate := func(maxSurge intstr.IntOrString) appsv1.DeploymentStrategy {
+		return appsv1.DeploymentStrategy{
+			Type:          appsv1.RollingUpdateDeploymentStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &maxSurge},
+		}
+	}
+	recreate := appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	deployments := NewDeploymentEvaluator(clock.RealClock{})
+	replicaSets := NewReplicaSetEvaluator(clock.RealClock{})
+	statefulSets := NewStatefulSetEvaluator(clock.RealClock{})
+	jobs := NewJobEvaluator(clock.RealClock{})
+	cronJobs := NewCronJobEvaluator(clock.RealClock{})
+
+	testCases := map[string]struct {
+		evaluator Evaluator
+		operation admission.Operation
+		obj       runtime.Object
+		oldObj    runtime.Object
+		expected  corev1.ResourceList
+	}{
+		"deployment create": {
+			evaluator: deployments,
+			operation: admission.Create,
+			obj:       newDeployment(4, "100m", appsv1.DeploymentStrategy{}),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("400m"), corev1.ResourcePods: resource.MustParse("4")},
+		},
+		"deployment scale up": {
+			evaluator: deployments,
+			operation: admission.Update,
+			obj:       newDeployment(6, "100m", appsv1.DeploymentStrategy{}),
+			oldObj:    newDeployment(4, "100m", appsv1.DeploymentStrategy{}),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("200m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"deployment scale down": {
+			evaluator: deployments,
+			operation: admission.Update,
+			obj:       newDeployment(2, "100m", appsv1.DeploymentStrategy{}),
+			oldObj:    newDeployment(4, "100m", appsv1.DeploymentStrategy{}),
+			expected:  corev1.ResourceList{},
+		},
+		"deployment rollout with the default surge": {
+			evaluator: deployments,
+			operation: admission.Update,
+			obj:       newDeployment(4, "200m", appsv1.DeploymentStrategy{}),
+			oldObj:    newDeployment(4, "100m", appsv1.DeploymentStrategy{}),
+			// 4 × 200m + 1 surge pod × 200m - 4 × 100m
+			expected: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("600m"), corev1.ResourcePods: resource.MustParse("1")},
+		},
+		"deployment rollout with an absolute surge": {
+			evaluator: deployments,
+			operation: admission.Update,
+			obj:       newDeployment(4, "100m", rollingUpdate(intstr.FromInt32(2))),
+			oldObj:    newDeployment(4, "50m", rollingUpdate(intstr.FromInt32(2))),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("400m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"deployment rollout with a percentage surge rounded up": {
+			evaluator: deployments,
+			operation: admission.Update,
+			obj:       newDeployment(3, "100m", rollingUpdate(intstr.FromString("50%"))),
+			oldObj:    newDeployment(3, "50m", rollingUpdate(intstr.FromString("50%"))),
+			// 3 × 100m + 2 surge pods × 100m - 3 × 50m
+			expected: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("350m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"deployment recreate rollout": {
+			evaluator: deployments,
+			operation: admission.Update,
+			obj:       newDeployment(4, "200m", recreate),
+			oldObj:    newDeployment(4, "100m", recreate),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("400m")},
+		},
+		"replica set scale up": {
+			evaluator: replicaSets,
+			operation: admission.Update,
+			obj:       &appsv1.ReplicaSet{Spec: appsv1.ReplicaSetSpec{Replicas: ptr.To[int32](3), Template: newTemplate("100m")}},
+			oldObj:    &appsv1.ReplicaSet{Spec: appsv1.ReplicaSetSpec{Replicas: ptr.To[int32](1), Template: newTemplate("100m")}},
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("200m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"stateful set create with claims": {
+			evaluator: statefulSets,
+			operation: admission.Create,
+			obj:       newStatefulSet(3, "100m", "10Gi"),
+			expected: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:            resource.MustParse("300m"),
+				corev1.ResourcePods:                   resource.MustParse("3"),
+				corev1.ResourcePersistentVolumeClaims: resource.MustParse("3"),
+				corev1.ResourceRequestsStorage:        resource.MustParse("30Gi"),
+			},
+		},
+		"stateful set rollout keeps its claims": {
+			evaluator: statefulSets,
+			operation: admission.Update,
+			obj:       newStatefulSet(3, "200m", "10Gi"),
+			oldObj:    newStatefulSet(3, "100m", "10Gi"),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("300m")},
+		},
+		"stateful set scale up charges the claims of the new replicas": {
+			evaluator: statefulSets,
+			operation: admission.Update,
+			obj:       newStatefulSet(5, "100m", "10Gi"),
+			oldObj:    newStatefulSet(3, "100m", "10Gi"),
+			expected: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:            resource.MustParse("200m"),
+				corev1.ResourcePods:                   resource.MustParse("2"),
+				corev1.ResourcePersistentVolumeClaims: resource.MustParse("2"),
+				corev1.ResourceRequestsStorage:        resource.MustParse("20Gi"),
+			},
+		},
+		"job limited by its parallelism": {
+			evaluator: jobs,
+			operation: admission.Create,
+			obj:       newJob(ptr.To[int32](3), ptr.To[int32](10), false, "100m"),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("300m"), corev1.ResourcePods: resource.MustParse("3")},
+		},
+		"job limited by its completions": {
+			evaluator: jobs,
+			operation: admission.Create,
+			obj:       newJob(ptr.To[int32](5), ptr.To[int32](2), false, "100m"),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("200m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"suspended job": {
+			evaluator: jobs,
+			operation: admission.Create,
+			obj:       newJob(ptr.To[int32](5), nil, true, "100m"),
+			expected:  corev1.ResourceList{},
+		},
+		"resumed job": {
+			evaluator: jobs,
+			operation: admission.Update,
+			obj:       newJob(ptr.To[int32](2), nil, false, "100m"),
+			oldObj:    newJob(ptr.To[int32](2), nil, true, "100m"),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("200m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"cron job create": {
+			evaluator: cronJobs,
+			operation: admission.Create,
+			obj:       newCronJob(2, "250m"),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("500m"), corev1.ResourcePods: resource.MustParse("2")},
+		},
+		"cron job update of its job template": {
+			evaluator: cronJobs,
+			operation: admission.Update,
+			obj:       newCronJob(2, "500m"),
+			oldObj:    newCronJob(2, "250m"),
+			expected:  corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("500m")},
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			attributes := workloadAttributes(testCase.evaluator, testCase.operation, testCase.obj, testCase.oldObj)
+			if !testCase.evaluator.Handles(attributes) {
+				t.Fatalf("expected the evaluator to handle the request")
+			}
+			usage, err := testCase.evaluator.ProjectedUsage(attributes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			actual := quota.Mask(usage, []corev1.ResourceName{corev1.ResourceRequestsCPU, corev1.ResourcePods,
+				corev1.ResourcePersistentVolumeClaims, corev1.ResourceRequestsStorage})
+			if !quota.Equals(withoutZeros(actual), testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHandles(t *testing.T) {
+	controller := true
+	ownedReplicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "deployment", Controller: &controller}},
+	}}
+	ownedJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", Name: "cronjob", Controller: &controller}},
+	}}
+	registry := NewRegistry(clock.RealClock{})
+	testCases := map[string]struct {
+		evaluator Evaluator
+		operation admission.Operation
+		obj       runtime.Object
+		expected  bool
+	}{
+		"deployment delete": {
+			evaluator: registry.Get(appsv1.SchemeGroupVersion.WithResource("deployments").GroupResource()),
+			operation: admission.Delete,
+			expected:  false,
+		},
+		"replica set of a deployment": {
+			evaluator: registry.Get(appsv1.SchemeGroupVersion.WithResource("replicasets").GroupResource()),
+			operation: admission.Create,
+			obj:       ownedReplicaSet,
+			expected:  false,
+		},
+		"replica set": {
+			evaluator: registry.Get(appsv1.SchemeGroupVersion.WithResource("replicasets").GroupResource()),
+			operation: admission.Create,
+			obj:       &appsv1.ReplicaSet{},
+			expected:  true,
+		},
+		"job of a cron job": {
+			evaluator: registry.Get(batchv1.SchemeGroupVersion.WithResource("jobs").GroupResource()),
+			operation: admission.Create,
+			obj:       ownedJob,
+			expected:  false,
+		},
+		"job": {
+			evaluator: registry.Get(batchv1.SchemeGroupVersion.WithResource("jobs").GroupResource()),
+			operation: admission.Update,
+			obj:       &batchv1.Job{},
+			expected:  true,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			attributes := workloadAttributes(testCase.evaluator, testCase.operation, testCase.obj, nil)
+			if actual := testCase.evaluator.Handles(attributes); actual != testCase.expected {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/clock"
+
+	"caih.com/pkg/quota"
+)
+
+// NewJobEvaluator returns an evaluator that projects the usage of jobs.
+func NewJobEvaluator(clock clock.Clock) Evaluator {
+	return &jobEvaluator{clock: clock}
+}
+
+// jobEvaluator projects the usage of jobs.
+type jobEvaluator struct {
+	clock clock.Clock
+}
+
+// GroupResource that this evaluator tracks
+func (j *jobEvaluator) GroupResource() schema.GroupResource {
+	return batchv1.SchemeGroupVersion.WithResource("jobs").GroupResource()
+}
+
+// Handles returns true if the evaluator should handle the specified attributes.
+// Jobs created by a cron job are projected as part of the cron job.
+func (j *jobEvaluator) Handles(a admission.Attributes) bool {
+	if !handlesCreateOrUpdate(a) {
+		return false
+	}
+	job, err := toJobOrError(a.GetObject())
+	if err != nil {
+		return false
+	}
+	owner := metav1.GetControllerOf(job)
+	return owner == nil || owner.Kind != "CronJob"
+}
+
+// PodTemplate returns a pod built from the job's pod template.
+func (j *jobEvaluator) PodTemplate(item runtime.Object) (*corev1.Pod, error) {
+	job, err := toJobOrError(item)
+	if err != nil {
+		return nil, err
+	}
+	return podForTemplate(job.Namespace, &job.Spec.Template), nil
+}
+
+// ProjectedUsage returns the usage of the pods the job runs in parallel.
+func (j *jobEvaluator) ProjectedUsage(a admission.Attributes) (corev1.ResourceList, error) {
+	job, err := toJobOrError(a.GetObject())
+	if err != nil {
+		return nil, err
+	}
+	usage, err := replicaUsage(a.GetNamespace(), &job.Spec.Template, activePods(&job.Spec), j.clock)
+	if err != nil {
+		return nil, err
+	}
+	if a.GetOperation() != admission.Update || a.GetOldObject() == nil {
+		return usage, nil
+	}
+	oldJob, err := toJobOrError(a.GetOldObject())
+	if err != nil {
+		return nil, err
+	}
+	oldUsage, err := replicaUsage(a.GetNamespace(), &oldJob.Spec.Template, activePods(&oldJob.Spec), j.clock)
+	if err != nil {
+		return nil, err
+	}
+	return quota.SubtractWithNonNegativeResult(usage, oldUsage), nil
+}
+
+// activePods returns the maximum number of pods the job runs at the same time.
+func activePods(spec *batchv1.JobSpec) int64 {
+	if spec.Suspend != nil && *spec.Suspend {
+		return 0
+	}
+	parallelism := replicasOrDefault(spec.Parallelism)
+	if spec.Completions != nil {
+		parallelism = min(parallelism, int64(*spec.Completions))
+	}
+	return parallelism
+}
+
+func toJobOrError(obj runtime.Object) (*batchv1.Job, error) {
+	switch t := obj.(type) {
+	case *batchv1.Job:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("expect *batchv1.Job, got %v", t)
+	}
+}
+
+// NewCronJobEvaluator returns an evaluator that projects the usage of cron jobs.
+func NewCronJobEvaluator(clock clock.Clock) Evaluator {
+	return &cronJobEvaluator{clock: clock}
+}
+
+// cronJobEvaluator projects the usage of cron jobs.
+type cronJobEvaluator struct {
+	clock clock.Clock
+}
+
+// GroupResource that this evaluator tracks
+func (c *cronJobEvaluator) GroupResource() schema.GroupResource {
+	return batchv1.SchemeGroupVersion.WithResource("cronjobs").GroupResource()
+}
+
+// Handles returns true if the evaluator should handle the specified attributes.
+func (c *cronJobEvaluator) Handles(a admission.Attributes) bool {
+	return handlesCreateOrUpdate(a)
+}
+
+// PodTemplate returns a pod built from the pod template of the cron job's job template.
+func (c *cronJobEvaluator) PodTemplate(item runtime.Object) (*corev1.Pod, error) {
+	cronJob, err := toCronJobOrError(item)
+	if err != nil {
+		return nil, err
+	}
+	return podForTemplate(cronJob.Namespace, &cronJob.Spec.JobTemplate.Spec.Template), nil
+}
+
+// ProjectedUsage returns the usage of the pods a single scheduled job runs in parallel.
+func (c *cronJobEvaluator) ProjectedUsage(a admission.Attributes) (corev1.ResourceList, error) {
+	cronJob, err := toCronJobOrError(a.GetObject())
+	if err != nil {
+		return nil, err
+	}
+	jobSpec := &cronJob.Spec.JobTemplate.Spec
+	usage, err := replicaUsage(a.GetNamespace(), &jobSpec.Template, activePods(jobSpec), c.clock)
+	if err != nil {
+		return nil, err
+	}
+	if a.GetOperation() != admission.Update || a.GetOldObject() == nil {
+		return usage, nil
+	}
+	oldCronJob, err := toCronJobOrError(a.GetOldObject())
+	if err != nil {
+		return nil, err
+	}
+	oldJobSpec := &oldCronJob.Spec.JobTemplate.Spec
+	oldUsage, err := replicaUsage(a.GetNamespace(), &oldJobSpec.Template, activePods(oldJobSpec), c.clock)
+	if err != nil {
+		return nil, err
+	}
+	return quota.SubtractWithNonNegativeResult(usage, oldUsage), nil
+}
+
+func toCronJobOrError(obj runtime.Object) (*batchv1.CronJob, error) {
+	switch t := obj.(type) {
+	case *batchv1.CronJob:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("expect *batchv1.CronJob, got %v", t)
+	}
+}
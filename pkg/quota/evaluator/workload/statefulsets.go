@@ -0,0 +1,109 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/utils/clock"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+)
+
+// NewStatefulSetEvaluator returns an evaluator that projects the usage of stateful sets.
+func NewStatefulSetEvaluator(clock clock.Clock) Evaluator {
+	return &statefulSetEvaluator{clock: clock, pvcEvaluator: core.NewPersistentVolumeClaimEvaluator(nil, nil)}
+}
+
+// statefulSetEvaluator projects the usage of stateful sets, including the claims of their volume claim templates.
+type statefulSetEvaluator struct {
+	clock clock.Clock
+	// measures the usage of the claims created from volume claim templates
+	pvcEvaluator quota.Evaluator
+}
+
+// GroupResource that this evaluator tracks
+func (s *statefulSetEvaluator) GroupResource() schema.GroupResource {
+	return appsv1.SchemeGroupVersion.WithResource("statefulsets").GroupResource()
+}
+
+// Handles returns true if the evaluator should handle the specified attributes.
+func (s *statefulSetEvaluator) Handles(a admission.Attributes) bool {
+	return handlesCreateOrUpdate(a)
+}
+
+// PodTemplate returns a pod built from the stateful set's pod template.
+func (s *statefulSetEvaluator) PodTemplate(item runtime.Object) (*corev1.Pod, error) {
+	statefulSet, err := toStatefulSetOrError(item)
+	if err != nil {
+		return nil, err
+	}
+	return podForTemplate(statefulSet.Namespace, &statefulSet.Spec.Template), nil
+}
+
+// ProjectedUsage returns replicas × (pod usage + volume claim template usage).  Stateful sets replace
+// pods one at a time without surge, and claims are kept across updates, so on update only the change
+// in pod usage and the claims of additional replicas are charged.
+func (s *statefulSetEvaluator) ProjectedUsage(a admission.Attributes) (corev1.ResourceList, error) {
+	statefulSet, err := toStatefulSetOrError(a.GetObject())
+	if err != nil {
+		return nil, err
+	}
+	replicas := replicasOrDefault(statefulSet.Spec.Replicas)
+	usage, err := replicaUsage(a.GetNamespace(), &statefulSet.Spec.Template, replicas, s.clock)
+	if err != nil {
+		return nil, err
+	}
+	claimReplicas := replicas
+	if a.GetOperation() == admission.Update && a.GetOldObject() != nil {
+		oldStatefulSet, err := toStatefulSetOrError(a.GetOldObject())
+		if err != nil {
+			return nil, err
+		}
+		oldReplicas := replicasOrDefault(oldStatefulSet.Spec.Replicas)
+		oldUsage, err := replicaUsage(a.GetNamespace(), &oldStatefulSet.Spec.Template, oldReplicas, s.clock)
+		if err != nil {
+			return nil, err
+		}
+		usage = quota.SubtractWithNonNegativeResult(usage, oldUsage)
+		claimReplicas = max(replicas-oldReplicas, 0)
+	}
+	claimUsage := corev1.ResourceList{}
+	for i := range statefulSet.Spec.VolumeClaimTemplates {
+		claimTemplateUsage, err := s.pvcEvaluator.Usage(&statefulSet.Spec.VolumeClaimTemplates[i])
+		if err != nil {
+			return nil, err
+		}
+		claimUsage = quota.Add(claimUsage, claimTemplateUsage)
+	}
+	return quota.Add(usage, quota.Multiply(claimUsage, claimReplicas)), nil
+}
+
+func toStatefulSetOrError(obj runtime.Object) (*appsv1.StatefulSet, error) {
+	switch t := obj.(type) {
+	case *appsv1.StatefulSet:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("expect *appsv1.StatefulSet, got %v", t)
+	}
+}
@@ -18,6 +18,7 @@ package generic
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
@@ -25,6 +26,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/admission"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -70,6 +72,41 @@ type UsageFunc func(object runtime.Object) (corev1.ResourceList, error)
 // MatchingResourceNamesFunc is a function that returns the list of resources matched
 type MatchingResourceNamesFunc func(input []corev1.ResourceName) []corev1.ResourceName
 
+// ScopeMatchError is returned when an object cannot be matched against a scope of a quota.  It is a configuration
+// error of the quota, the usage of the quota cannot be calculated until the scope is fixed.
+type ScopeMatchError struct {
+	Scope corev1.ScopedResourceSelectorRequirement
+	Err   error
+}
+
+func (e *ScopeMatchError) Error() string {
+	return fmt.Sprintf("failed to match scope %s: %v", e.Scope.ScopeName, e.Err)
+}
+
+func (e *ScopeMatchError) Unwrap() error {
+	return e.Err
+}
+
+// IsScopeMatchError returns true if err, or any error aggregated in it, is a ScopeMatchError.
+func IsScopeMatchError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var scopeErr *ScopeMatchError
+	if errors.As(err, &scopeErr) {
+		return true
+	}
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		for _, err := range agg.Errors() {
+			if IsScopeMatchError(err) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // MatchesNoScopeFunc returns false on all match checks
 func MatchesNoScopeFunc(scope corev1.ScopedResourceSelectorRequirement, object runtime.Object) (bool, error) {
 	return false, nil
@@ -89,7 +126,7 @@ func Matches(
 	for _, scope := range getScopeSelectorsFromQuota(resourceQuota) {
 		innerMatch, err := scopeFunc(scope, item)
 		if err != nil {
-			return false, err
+			return false, &ScopeMatchError{Scope: scope, Err: err}
 		}
 		matchScope = matchScope && innerMatch
 	}
@@ -127,9 +164,10 @@ func CalculateUsageStats(options quota.UsageStatsOptions,
 		// need to verify that the item matches the set of scopes
 		matchesScopes := true
 		for _, scope := range options.Scopes {
-			innerMatch, err := scopeFunc(corev1.ScopedResourceSelectorRequirement{ScopeName: scope}, item)
+			selector := corev1.ScopedResourceSelectorRequirement{ScopeName: scope}
+			innerMatch, err := scopeFunc(selector, item)
 			if err != nil {
-				return result, nil
+				return result, &ScopeMatchError{Scope: selector, Err: err}
 			}
 			if !innerMatch {
 				matchesScopes = false
@@ -139,7 +177,7 @@ func CalculateUsageStats(options quota.UsageStatsOptions,
 			for _, selector := range options.ScopeSelector.MatchExpressions {
 				innerMatch, err := scopeFunc(selector, item)
 				if err != nil {
-					return result, nil
+					return result, &ScopeMatchError{Scope: selector, Err: err}
 				}
 				matchesScopes = matchesScopes && innerMatch
 			}
@@ -26,14 +26,16 @@ import (
 )
 
 // NewQuotaConfigurationForAdmission returns a quota configuration for admission control.
-func NewQuotaConfigurationForAdmission() quota.Configuration {
-	evaluators := core.NewEvaluators(nil)
+// Admission never lists objects, the client is only used by evaluators that need to read a related object, and
+// apiReader when the related object is not in the cache yet.
+func NewQuotaConfigurationForAdmission(client client.Client, apiReader client.Reader) quota.Configuration {
+	evaluators := core.NewEvaluators(client, apiReader)
 	return generic.NewConfiguration(evaluators, DefaultIgnoredResources())
 }
 
 // NewQuotaConfigurationForControllers returns a quota configuration for controllers.
-func NewQuotaConfigurationForControllers(client client.Client) quota.Configuration {
-	evaluators := core.NewEvaluators(client)
+func NewQuotaConfigurationForControllers(client client.Client, apiReader client.Reader) quota.Configuration {
+	evaluators := core.NewEvaluators(client, apiReader)
 	return generic.NewConfiguration(evaluators, DefaultIgnoredResources())
 }
 
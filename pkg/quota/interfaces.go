@@ -17,6 +17,8 @@ limitations under the License.
 package quota
 
 import (
+	"context"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -63,6 +65,36 @@ type Evaluator interface {
 	UsageStats(options UsageStatsOptions) (UsageStats, error)
 }
 
+// ContextEvaluator is implemented by evaluators that read other objects to measure the usage of an object, so that
+// admission bounds these reads by its own deadline.
+type ContextEvaluator interface {
+	// UsageWithContext returns the resource usage for the specified object, reading other objects with ctx
+	UsageWithContext(ctx context.Context, item runtime.Object) (corev1.ResourceList, error)
+}
+
+// UsageWithContext returns the usage of item measured by evaluator, with ctx if the evaluator reads other objects.
+func UsageWithContext(ctx context.Context, evaluator Evaluator, item runtime.Object) (corev1.ResourceList, error) {
+	if contextEvaluator, ok := evaluator.(ContextEvaluator); ok {
+		return contextEvaluator.UsageWithContext(ctx, item)
+	}
+	return evaluator.Usage(item)
+}
+
+// ContextConstrainer is implemented by evaluators that read other objects to check the constraints of an object, so
+// that admission bounds these reads by its own deadline.
+type ContextConstrainer interface {
+	// ConstraintsWithContext ensures that each required resource is present on item, reading other objects with ctx
+	ConstraintsWithContext(ctx context.Context, required []corev1.ResourceName, item runtime.Object) error
+}
+
+// ConstraintsWithContext checks the constraints of item with evaluator, with ctx if the evaluator reads other objects.
+func ConstraintsWithContext(ctx context.Context, evaluator Evaluator, required []corev1.ResourceName, item runtime.Object) error {
+	if contextConstrainer, ok := evaluator.(ContextConstrainer); ok {
+		return contextConstrainer.ConstraintsWithContext(ctx, required, item)
+	}
+	return evaluator.Constraints(required, item)
+}
+
 // Configuration defines how the quota system is configured.
 type Configuration interface {
 	// IgnoredResources are ignored by quota.
@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// DefaultReservationGracePeriod is how long a reservation is kept after a recalculation of the quota status
+// started.  It covers the time for an admitted object to be persisted and observed by the controller's cache, and
+// the clock skew between webhook and controller replicas.
+const DefaultReservationGracePeriod = 10 * time.Second
+
+// ReservedUsage returns the sum of the reservations of the ledgers.
+func ReservedUsage(ledgers ...*quotav1.SharedQuotaLedger) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	for _, ledger := range ledgers {
+		if ledger == nil {
+			continue
+		}
+		for _, reservation := range ledger.Spec.Reservations {
+			result = Add(result, reservation.Used)
+		}
+	}
+	return result
+}
+
+// AddReservation records the usage admitted in the namespace of the ledger.  The reservations of an object are
+// merged and dropped once the last admitted operation is counted.  Reservations without object of the same second
+// are merged, which bounds the size of the ledger by the number of seconds they are kept for.
+func AddReservation(ledger *quotav1.SharedQuotaLedger, reservation quotav1.Reservation) {
+	reservation.Timestamp.Time = reservation.Timestamp.Truncate(time.Second)
+	for i := range ledger.Spec.Reservations {
+		existing := &ledger.Spec.Reservations[i]
+		if !sameReservation(existing, &reservation) {
+			continue
+		}
+		existing.Used = Add(existing.Used, reservation.Used)
+		existing.Object = reservation.Object
+		// the merged usage is kept as long as the last reservation would be
+		if existing.Timestamp.Before(&reservation.Timestamp) {
+			existing.Timestamp = reservation.Timestamp
+		}
+		return
+	}
+	ledger.Spec.Reservations = append(ledger.Spec.Reservations, reservation)
+}
+
+// sameReservation returns true if the reservations are merged: they are for the same object, or both are without
+// object and of the same second.
+func sameReservation(a, b *quotav1.Reservation) bool {
+	if a.Object == nil || b.Object == nil {
+		return a.Object == nil && b.Object == nil && a.Timestamp.Equal(&b.Timestamp)
+	}
+	return a.Object.Group == b.Object.Group && a.Object.Resource == b.Object.Resource &&
+		a.Object.Name == b.Object.Name && a.Object.UID == b.Object.UID
+}
+
+// PruneReservations removes the reservations made before the given time, and the reservations whose object is
+// counted.  counted may be nil.  It returns true if the ledger changed.
+func PruneReservations(ledger *quotav1.SharedQuotaLedger, before time.Time, counted func(quotav1.ReservedObject) bool) bool {
+	kept := ledger.Spec.Reservations[:0]
+	for _, reservation := range ledger.Spec.Reservations {
+		if reservation.Timestamp.Time.Before(before) {
+			continue
+		}
+		if reservation.Object != nil && counted != nil && counted(*reservation.Object) {
+			continue
+		}
+		kept = append(kept, reservation)
+	}
+	changed := len(kept) != len(ledger.Spec.Reservations)
+	ledger.Spec.Reservations = kept
+	return changed
+}
+
+// ObjectCounted returns true if a usage calculated from the objects of the reserved object's resource counts the
+// admitted operation, given the object of the same name observed before the calculation, nil if there was none.
+func ObjectCounted(object quotav1.ReservedObject, observed metav1.Object) bool {
+	if len(object.ResourceVersion) == 0 {
+		// the created object was observed
+		return observed != nil && (len(object.UID) == 0 || observed.GetUID() == object.UID)
+	}
+	if observed == nil || observed.GetUID() != object.UID {
+		// the updated or deleted object is gone
+		return true
+	}
+	if object.Deleted {
+		// the object is counted until it is gone
+		return false
+	}
+	// a version following the updated one was observed
+	return observed.GetResourceVersion() != object.ResourceVersion
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	quotav1 "caih.com/api/v1"
+)
+
+var ledgerNow = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func pods(count string) corev1.ResourceList {
+	return corev1.ResourceList{corev1.ResourcePods: resource.MustParse(count)}
+}
+
+func reservation(object *quotav1.ReservedObject, used corev1.ResourceList, at time.Time) quotav1.Reservation {
+	return quotav1.Reservation{Object: object, Used: used, Timestamp: metav1.NewTime(at)}
+}
+
+func createdPod(name string) *quotav1.ReservedObject {
+	return &quotav1.ReservedObject{Resource: "pods", Name: name}
+}
+
+func updatedPod(name string, uid types.UID, resourceVersion string) *quotav1.ReservedObject {
+	return &quotav1.ReservedObject{Resource: "pods", Name: name, UID: uid, ResourceVersion: resourceVersion}
+}
+
+func deletedPod(name string, uid types.UID, resourceVersion string) *quotav1.ReservedObject {
+	return &quotav1.ReservedObject{Resource: "pods", Name: name, UID: uid, ResourceVersion: resourceVersion, Deleted: true}
+}
+
+func observedPod(name string, uid types.UID, resourceVersion string) metav1.Object {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, UID: uid, ResourceVersion: resourceVersion}}
+}
+
+func TestAddReservation(t *testing.T) {
+	testCases := map[string]struct {
+		reservations []quotav1.Reservation
+		expected     []quotav1.Reservation
+	}{
+		"objects are kept apart": {
+			reservations: []quotav1.Reservation{
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+				reservation(createdPod("b"), pods("1"), ledgerNow),
+			},
+			expected: []quotav1.Reservation{
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+				reservation(createdPod("b"), pods("1"), ledgerNow),
+			},
+		},
+		"operations on an object are merged": {
+			reservations: []quotav1.Reservation{
+				reservation(updatedPod("a", "uid-a", "1"), pods("1"), ledgerNow),
+				reservation(deletedPod("a", "uid-a", "2"), pods("-2"), ledgerNow.Add(5*time.Second)),
+			},
+			expected: []quotav1.Reservation{
+				reservation(deletedPod("a", "uid-a", "2"), pods("-1"), ledgerNow.Add(5*time.Second)),
+			},
+		},
+		"creation and update of an object are kept apart": {
+			reservations: []quotav1.Reservation{
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+				reservation(updatedPod("a", "uid-a", "1"), pods("1"), ledgerNow),
+			},
+			expected: []quotav1.Reservation{
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+				reservation(updatedPod("a", "uid-a", "1"), pods("1"), ledgerNow),
+			},
+		},
+		"objects of other resources are kept apart": {
+			reservations: []quotav1.Reservation{
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+				reservation(&quotav1.ReservedObject{Resource: "persistentvolumeclaims", Name: "a"}, pods("1"), ledgerNow),
+			},
+			expected: []quotav1.Reservation{
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+				reservation(&quotav1.ReservedObject{Resource: "persistentvolumeclaims", Name: "a"}, pods("1"), ledgerNow),
+			},
+		},
+		"reservations without object of the same second are merged": {
+			reservations: []quotav1.Reservation{
+				reservation(nil, pods("1"), ledgerNow.Add(100*time.Millisecond)),
+				reservation(nil, pods("2"), ledgerNow.Add(900*time.Millisecond)),
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+			},
+			expected: []quotav1.Reservation{
+				reservation(nil, pods("3"), ledgerNow),
+				reservation(createdPod("a"), pods("1"), ledgerNow),
+			},
+		},
+		"reservations without object of other seconds are kept apart": {
+			reservations: []quotav1.Reservation{
+				reservation(nil, pods("1"), ledgerNow),
+				reservation(nil, pods("2"), ledgerNow.Add(time.Second)),
+			},
+			expected: []quotav1.Reservation{
+				reservation(nil, pods("1"), ledgerNow),
+				reservation(nil, pods("2"), ledgerNow.Add(time.Second)),
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ledger := &quotav1.SharedQuotaLedger{}
+			for _, reservation := range tc.reservations {
+				AddReservation(ledger, reservation)
+			}
+			if len(ledger.Spec.Reservations) != len(tc.expected) {
+				t.Fatalf("expected %d reservations, got %+v", len(tc.expected), ledger.Spec.Reservations)
+			}
+			for i, expected := range tc.expected {
+				actual := ledger.Spec.Reservations[i]
+				if !Equals(actual.Used, expected.Used) || !actual.Timestamp.Equal(&expected.Timestamp) ||
+					(actual.Object == nil) != (expected.Object == nil) || (actual.Object != nil && *actual.Object != *expected.Object) {
+					t.Errorf("reservation %d: expected %+v, got %+v", i, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneReservations(t *testing.T) {
+	ledger := func() *quotav1.SharedQuotaLedger {
+		return &quotav1.SharedQuotaLedger{Spec: quotav1.SharedQuotaLedgerSpec{Reservations: []quotav1.Reservation{
+			reservation(nil, pods("1"), ledgerNow.Add(-time.Minute)),
+			reservation(nil, pods("2"), ledgerNow),
+			reservation(createdPod("a"), pods("4"), ledgerNow),
+			reservation(createdPod("b"), pods("8"), ledgerNow.Add(-time.Minute)),
+		}}}
+	}
+	testCases := map[string]struct {
+		counted         func(quotav1.ReservedObject) bool
+		expectedChanged bool
+		expectedUsage   corev1.ResourceList
+	}{
+		"old reservations are dropped": {
+			expectedChanged: true,
+			expectedUsage:   pods("6"),
+		},
+		"counted reservations are dropped": {
+			counted: func(object quotav1.ReservedObject) bool {
+				return object.Name == "a"
+			},
+			expectedChanged: true,
+			expectedUsage:   pods("2"),
+		},
+		"reservations without object are only dropped when old": {
+			counted: func(object quotav1.ReservedObject) bool {
+				return true
+			},
+			expectedChanged: true,
+			expectedUsage:   pods("2"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ledger := ledger()
+			changed := PruneReservations(ledger, ledgerNow.Add(-10*time.Second), tc.counted)
+			if changed != tc.expectedChanged {
+				t.Errorf("expected changed %v, got %v", tc.expectedChanged, changed)
+			}
+			if usage := ReservedUsage(ledger); !Equals(usage, tc.expectedUsage) {
+				t.Errorf("expected usage %v, got %v", tc.expectedUsage, usage)
+			}
+		})
+	}
+
+	unchanged := ledger()
+	if PruneReservations(unchanged, ledgerNow.Add(-2*time.Minute), nil) {
+		t.Errorf("expected no change without old or counted reservations, got %+v", unchanged.Spec.Reservations)
+	}
+}
+
+func TestObjectCounted(t *testing.T) {
+	testCases := map[string]struct {
+		object   *quotav1.ReservedObject
+		observed metav1.Object
+		expected bool
+	}{
+		"created object observed": {
+			object:   createdPod("a"),
+			observed: observedPod("a", "uid-a", "1"),
+			expected: true,
+		},
+		"created object not observed yet": {
+			object:   createdPod("a"),
+			expected: false,
+		},
+		"updated object observed at the updated version": {
+			object:   updatedPod("a", "uid-a", "1"),
+			observed: observedPod("a", "uid-a", "1"),
+			expected: false,
+		},
+		"updated object observed at a later version": {
+			object:   updatedPod("a", "uid-a", "1"),
+			observed: observedPod("a", "uid-a", "2"),
+			expected: true,
+		},
+		"updated object gone": {
+			object:   updatedPod("a", "uid-a", "1"),
+			expected: true,
+		},
+		"updated object replaced": {
+			object:   updatedPod("a", "uid-a", "1"),
+			observed: observedPod("a", "uid-b", "3"),
+			expected: true,
+		},
+		"deleted object still observed": {
+			object:   deletedPod("a", "uid-a", "1"),
+			observed: observedPod("a", "uid-a", "2"),
+			expected: false,
+		},
+		"deleted object gone": {
+			object:   deletedPod("a", "uid-a", "1"),
+			expected: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if counted := ObjectCounted(*tc.object, tc.observed); counted != tc.expected {
+				t.Errorf("expected counted %v, got %v", tc.expected, counted)
+			}
+		})
+	}
+}
+
+// TestFoldReservations checks that the usage of a quota, its recalculated status plus its remaining reservations,
+// counts every admitted object once.
+func TestFoldReservations(t *testing.T) {
+	// pod a was created before the recalculation, c was created and d was deleted after it
+	observed := map[string]metav1.Object{
+		"a": observedPod("a", "uid-a", "1"),
+		"d": observedPod("d", "uid-d", "1"),
+	}
+	recalculated := pods("2")
+	ledger := &quotav1.SharedQuotaLedger{}
+	AddReservation(ledger, reservation(createdPod("a"), pods("1"), ledgerNow))
+	AddReservation(ledger, reservation(createdPod("c"), pods("1"), ledgerNow))
+	AddReservation(ledger, reservation(deletedPod("d", "uid-d", "1"), pods("-1"), ledgerNow))
+	// a is counted by the status and by its reservation
+	if usage := Add(recalculated, ReservedUsage(ledger)); !Equals(usage, pods("3")) {
+		t.Fatalf("expected usage %v before folding, got %v", pods("3"), usage)
+	}
+
+	PruneReservations(ledger, ledgerNow.Add(-10*time.Second), func(object quotav1.ReservedObject) bool {
+		return ObjectCounted(object, observed[object.Name])
+	})
+	// a is only counted by the status, c is reserved and d is released by their reservations
+	if usage := Add(recalculated, ReservedUsage(ledger)); !Equals(usage, pods("2")) {
+		t.Errorf("expected usage %v after folding, got %v", pods("2"), usage)
+	}
+	if len(ledger.Spec.Reservations) != 2 {
+		t.Errorf("expected the reservations of c and d to remain, got %+v", ledger.Spec.Reservations)
+	}
+}
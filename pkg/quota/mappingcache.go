@@ -0,0 +1,219 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	ctrlcache "sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quotav1 "caih.com/api/v1"
+)
+
+// QuotaMappingCache indexes the shared quotas selecting every namespace.  It is maintained from the Namespace and
+// SharedQuota informers, so that a lookup only costs the number of matched quotas instead of listing every quota
+// and evaluating its selector.
+type QuotaMappingCache struct {
+	lock sync.RWMutex
+	// namespaceLabels holds the labels of every observed namespace
+	namespaceLabels map[string]labels.Set
+	// quotaSelectors holds the selector of every observed quota that selects namespaces
+	quotaSelectors map[string]labels.Selector
+	// namespaceToQuotas and quotaToNamespaces hold the matches in both directions
+	namespaceToQuotas map[string]sets.Set[string]
+	quotaToNamespaces map[string]sets.Set[string]
+
+	registrations []toolscache.ResourceEventHandlerRegistration
+}
+
+// NewQuotaMappingCache returns a mapping cache fed by the Namespace and SharedQuota informers of the cache.
+func NewQuotaMappingCache(ctx context.Context, cache ctrlcache.Cache) (*QuotaMappingCache, error) {
+	m := &QuotaMappingCache{
+		namespaceLabels:   map[string]labels.Set{},
+		quotaSelectors:    map[string]labels.Selector{},
+		namespaceToQuotas: map[string]sets.Set[string]{},
+		quotaToNamespaces: map[string]sets.Set[string]{},
+	}
+	handlers := map[client.Object]toolscache.ResourceEventHandlerFuncs{
+		&corev1.Namespace{}: {
+			AddFunc: func(obj interface{}) {
+				m.updateNamespace(obj.(*corev1.Namespace))
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				m.updateNamespace(obj.(*corev1.Namespace))
+			},
+			DeleteFunc: func(obj interface{}) {
+				m.deleteNamespace(objectName(obj))
+			},
+		},
+		&quotav1.SharedQuota{}: {
+			AddFunc: func(obj interface{}) {
+				m.updateQuota(obj.(*quotav1.SharedQuota))
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				m.updateQuota(obj.(*quotav1.SharedQuota))
+			},
+			DeleteFunc: func(obj interface{}) {
+				m.deleteQuota(objectName(obj))
+			},
+		},
+	}
+	for obj, handler := range handlers {
+		informer, err := cache.GetInformer(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+		registration, err := informer.AddEventHandler(handler)
+		if err != nil {
+			return nil, err
+		}
+		m.registrations = append(m.registrations, registration)
+	}
+	return m, nil
+}
+
+// HasSynced returns true once the mapping reflects the initial content of both informers.
+func (m *QuotaMappingCache) HasSynced() bool {
+	for _, registration := range m.registrations {
+		if !registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// ResourceQuotaNamesFor returns the names of the shared quotas selecting the namespace, sorted.  It returns a
+// NotFound error if the namespace has not been observed yet.
+func (m *QuotaMappingCache) ResourceQuotaNamesFor(namespaceName string) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if _, found := m.namespaceLabels[namespaceName]; !found || !m.HasSynced() {
+		return nil, apierrors.NewNotFound(corev1.Resource("namespaces"), namespaceName)
+	}
+	return sets.List(m.namespaceToQuotas[namespaceName]), nil
+}
+
+// NamespacesFor returns the names of the namespaces selected by the shared quota, sorted.
+func (m *QuotaMappingCache) NamespacesFor(quotaName string) []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return sets.List(m.quotaToNamespaces[quotaName])
+}
+
+func (m *QuotaMappingCache) updateNamespace(namespace *corev1.Namespace) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeNamespaceMatches(namespace.Name)
+	namespaceLabels := labels.Set(namespace.Labels)
+	m.namespaceLabels[namespace.Name] = namespaceLabels
+	for quotaName, selector := range m.quotaSelectors {
+		if selector.Matches(namespaceLabels) {
+			m.addMatch(namespace.Name, quotaName)
+		}
+	}
+}
+
+func (m *QuotaMappingCache) deleteNamespace(namespaceName string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeNamespaceMatches(namespaceName)
+	delete(m.namespaceLabels, namespaceName)
+}
+
+func (m *QuotaMappingCache) updateQuota(quota *quotav1.SharedQuota) {
+	selector, err := quota.NamespaceSelector()
+	if err != nil {
+		// the namespaces selected before stay matched, the controller marks the usage of the quota as not calculated
+		// so that their requests are rejected until the selector is fixed
+		klog.Errorf("invalid namespace selector of quota %s, keeping the previous selector: %v", quota.Name, err)
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeQuotaMatches(quota.Name)
+	// a quota without selector selects no namespace
+	if selector == nil {
+		delete(m.quotaSelectors, quota.Name)
+		return
+	}
+	m.quotaSelectors[quota.Name] = selector
+	for namespaceName, namespaceLabels := range m.namespaceLabels {
+		if selector.Matches(namespaceLabels) {
+			m.addMatch(namespaceName, quota.Name)
+		}
+	}
+}
+
+func (m *QuotaMappingCache) deleteQuota(quotaName string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeQuotaMatches(quotaName)
+	delete(m.quotaSelectors, quotaName)
+}
+
+// addMatch records that the quota selects the namespace.  Must be called with the lock held.
+func (m *QuotaMappingCache) addMatch(namespaceName, quotaName string) {
+	if m.namespaceToQuotas[namespaceName] == nil {
+		m.namespaceToQuotas[namespaceName] = sets.New[string]()
+	}
+	m.namespaceToQuotas[namespaceName].Insert(quotaName)
+	if m.quotaToNamespaces[quotaName] == nil {
+		m.quotaToNamespaces[quotaName] = sets.New[string]()
+	}
+	m.quotaToNamespaces[quotaName].Insert(namespaceName)
+}
+
+// removeNamespaceMatches forgets the quotas selecting the namespace.  Must be called with the lock held.
+func (m *QuotaMappingCache) removeNamespaceMatches(namespaceName string) {
+	for quotaName := range m.namespaceToQuotas[namespaceName] {
+		m.quotaToNamespaces[quotaName].Delete(namespaceName)
+		if m.quotaToNamespaces[quotaName].Len() == 0 {
+			delete(m.quotaToNamespaces, quotaName)
+		}
+	}
+	delete(m.namespaceToQuotas, namespaceName)
+}
+
+// removeQuotaMatches forgets the namespaces selected by the quota.  Must be called with the lock held.
+func (m *QuotaMappingCache) removeQuotaMatches(quotaName string) {
+	for namespaceName := range m.quotaToNamespaces[quotaName] {
+		m.namespaceToQuotas[namespaceName].Delete(quotaName)
+		if m.namespaceToQuotas[namespaceName].Len() == 0 {
+			delete(m.namespaceToQuotas, namespaceName)
+		}
+	}
+	delete(m.quotaToNamespaces, quotaName)
+}
+
+// objectName returns the name of a deleted object, which may be wrapped in a tombstone.
+func objectName(obj interface{}) string {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if object, ok := obj.(client.Object); ok {
+		return object.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	quotav1 "caih.com/api/v1"
+)
+
+func TestUpdateQuotaWithInvalidSelector(t *testing.T) {
+	m := &QuotaMappingCache{
+		namespaceLabels:   map[string]labels.Set{},
+		quotaSelectors:    map[string]labels.Selector{},
+		namespaceToQuotas: map[string]sets.Set[string]{},
+		quotaToNamespaces: map[string]sets.Set[string]{},
+	}
+	m.updateNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace", Labels: map[string]string{"team": "a"}}})
+	sharedQuota := &quotav1.SharedQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota"},
+		Spec:       quotav1.SharedQuotaSpec{LabelSelector: map[string]string{"team": "a"}},
+	}
+	m.updateQuota(sharedQuota)
+
+	invalidQuota := sharedQuota.DeepCopy()
+	invalidQuota.Annotations = map[string]string{quotav1.NamespaceSelectorAnnotation: "{"}
+	m.updateQuota(invalidQuota)
+	if names, err := m.ResourceQuotaNamesFor("namespace"); err != nil || !slices.Equal(names, []string{"quota"}) {
+		t.Errorf("expected the namespace to stay selected by the quota, got %v, %v", names, err)
+	}
+	if namespaces := m.NamespacesFor("quota"); !slices.Equal(namespaces, []string{"namespace"}) {
+		t.Errorf("expected the quota to keep selecting the namespace, got %v", namespaces)
+	}
+}
+
+func BenchmarkResourceQuotaNamesFor(b *testing.B) {
+	for _, size := range []struct{ namespaces, quotas int }{{100, 10}, {5000, 500}} {
+		m := &QuotaMappingCache{
+			namespaceLabels:   map[string]labels.Set{},
+			quotaSelectors:    map[string]labels.Selector{},
+			namespaceToQuotas: map[string]sets.Set[string]{},
+			quotaToNamespaces: map[string]sets.Set[string]{},
+		}
+		for i := 0; i < size.quotas; i++ {
+			m.updateQuota(&quotav1.SharedQuota{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("quota-%d", i)},
+				Spec:       quotav1.SharedQuotaSpec{LabelSelector: map[string]string{"team": fmt.Sprintf("team-%d", i)}},
+			})
+		}
+		for i := 0; i < size.namespaces; i++ {
+			m.updateNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("namespace-%d", i),
+				Labels: map[string]string{"team": fmt.Sprintf("team-%d", i%size.quotas)},
+			}})
+		}
+		b.Run(fmt.Sprintf("namespaces=%d,quotas=%d", size.namespaces, size.quotas), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				names, err := m.ResourceQuotaNamesFor(fmt.Sprintf("namespace-%d", i%size.namespaces))
+				if err != nil || len(names) != 1 {
+					b.Fatalf("unexpected quotas %v: %v", names, err)
+				}
+			}
+		})
+	}
+}
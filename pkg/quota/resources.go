@@ -99,6 +99,17 @@ func Add(a corev1.ResourceList, b corev1.ResourceList) corev1.ResourceList {
 	return result
 }
 
+// Multiply returns the result of a * n for each named resource
+func Multiply(a corev1.ResourceList, n int64) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	for key, value := range a {
+		quantity := value.DeepCopy()
+		quantity.Mul(n)
+		result[key] = quantity
+	}
+	return result
+}
+
 // SubtractWithNonNegativeResult - subtracts and returns result of a - b but
 // makes sure we don't return negative values to prevent negative resource usage.
 func SubtractWithNonNegativeResult(a corev1.ResourceList, b corev1.ResourceList) corev1.ResourceList {
@@ -0,0 +1,74 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota_test
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"caih.com/pkg/quota"
+	"caih.com/pkg/quota/evaluator/core"
+	"caih.com/pkg/quota/generic"
+)
+
+func BenchmarkCalculateUsage(b *testing.B) {
+	hard := corev1.ResourceList{
+		corev1.ResourcePods:           resource.MustParse("10000"),
+		corev1.ResourceRequestsCPU:    resource.MustParse("1000"),
+		corev1.ResourceRequestsMemory: resource.MustParse("1000Gi"),
+	}
+	for _, count := range []int{10, 1000} {
+		objects := make([]client.Object, 0, count)
+		for i := 0; i < count; i++ {
+			objects = append(objects, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: fmt.Sprintf("pod-%d", i)},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "app",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("100m"),
+								corev1.ResourceMemory: resource.MustParse("128Mi"),
+							},
+						},
+					}},
+				},
+			})
+		}
+		cache := fake.NewClientBuilder().WithObjects(objects...).Build()
+		registry := generic.NewRegistry([]quota.Evaluator{core.NewPodEvaluator(cache, clock.RealClock{})})
+		b.Run(fmt.Sprintf("pods=%d", count), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				usage, err := quota.CalculateUsage("namespace", nil, hard, registry, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if pods := usage[corev1.ResourcePods]; pods.Value() != int64(count) {
+					b.Fatalf("expected %d pods, got %s", count, pods.String())
+				}
+			}
+		})
+	}
+}